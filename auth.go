@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// WithBasicAuth sends user and password with basic authentication. It replaces
+// an Authorization header from the headers map, the token argument of the Auth
+// wrappers replaces it in turn.
+func WithBasicAuth(user, password string) Option {
+	return func(o *options) {
+		o.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	}
+}
+
+// WithBearerToken sends token with the Bearer scheme, prefixed exactly once
+// whether or not it already starts with "Bearer ". It takes precedence like
+// WithBasicAuth.
+func WithBearerToken(token string) Option {
+	return func(o *options) {
+		o.authorization = bearer(token)
+	}
+}
+
+func bearer(token string) string {
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	return "Bearer " + token
+}
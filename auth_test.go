@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerTokenIsPrefixedOnce(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	for _, token := range []string{"abc", "Bearer abc", "bearer abc", " Bearer  abc "} {
+		if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, WithBearerToken(token)); err != nil {
+			t.Fatal(err)
+		}
+		if authorization != "Bearer abc" {
+			t.Errorf("WithBearerToken(%q) sent %q", token, authorization)
+		}
+	}
+
+	// The token argument is still sent verbatim.
+	if _, _, err := HttpReqAuthJSON("GET", srv.URL, "abc", nil, nil, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "abc" {
+		t.Errorf("token argument sent as %q", authorization)
+	}
+}
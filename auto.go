@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// HttpReqAuto decodes the response as JSON, XML or a format added with
+// RegisterFormat according to its Content-Type.
+// A response without Content-Type is decoded as JSON, see WithAutoDefault.
+// The request Content-Type is left to the caller.
+func HttpReqAuto(method, urlString, token string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReq(formatAuto, "", method, urlString, token, body, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+// WithAutoDefault sets the format HttpReqAuto uses when the response has no Content-Type.
+func WithAutoDefault(format Format) Option {
+	return func(o *options) {
+		o.autoDefault = format
+	}
+}
+
+// formatFromResponse maps the response Content-Type to a format.
+func (o *options) formatFromResponse() (Format, error) {
+	contentType := o.info.Header.Get("Content-Type")
+	if contentType == "" {
+		if o.autoDefault != "" {
+			return o.autoDefault, nil
+		}
+		return FormatJSON, nil
+	}
+
+	if format, ok := formatFor(contentType); ok {
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported response content type %q", contentType)
+}
+
+func formatFor(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return FormatJSON, true
+	case mediaType == "application/xml", mediaType == "text/xml", strings.HasSuffix(mediaType, "+xml"):
+		return FormatXML, true
+	}
+	return registeredFormatFor(mediaType)
+}
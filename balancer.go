@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// BalanceStrategy picks the base URL tried first.
+type BalanceStrategy int
+
+const (
+	// RoundRobin rotates the base URLs from one request to the next.
+	RoundRobin BalanceStrategy = iota
+	// LeastPending prefers the base URL with the fewest requests in flight.
+	LeastPending
+)
+
+// BalancePolicy configures WithBalancer.
+type BalancePolicy struct {
+	Strategy BalanceStrategy
+	// EjectAfter consecutive failures move a base URL to the end of the order,
+	// 3 by default.
+	EjectAfter int
+	// EjectFor is how long an ejected base URL stays at the end before a
+	// request probes it again, 30 seconds by default.
+	EjectFor time.Duration
+}
+
+// WithBalancer spreads requests over the WithBaseURLs URLs instead of always
+// starting with the first one. Failing URLs are ejected for a while and then
+// probed again. Like WithRateLimit the state lives in the Option, so pass it
+// to NewClient. The URL used is reported in ResponseInfo.Endpoint.
+func WithBalancer(policy BalancePolicy) Option {
+	if policy.EjectAfter <= 0 {
+		policy.EjectAfter = 3
+	}
+	if policy.EjectFor <= 0 {
+		policy.EjectFor = 30 * time.Second
+	}
+
+	b := &balancer{policy: policy, nodes: make(map[string]*node)}
+	return func(o *options) {
+		o.balancer = b
+	}
+}
+
+type balancer struct {
+	policy BalancePolicy
+
+	mu    sync.Mutex
+	next  int
+	nodes map[string]*node
+}
+
+type node struct {
+	pending      int
+	failures     int
+	ejectedUntil time.Time
+}
+
+func (b *balancer) node(base string) *node {
+	n, ok := b.nodes[base]
+	if !ok {
+		n = &node{}
+		b.nodes[base] = n
+	}
+	return n
+}
+
+// order sorts endpoints by preference: healthy ones by strategy, then the
+// ejected ones. An ejected node whose time is up is healthy again for a probe.
+func (b *balancer) order(endpoints []endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.policy.Strategy == RoundRobin {
+		start := b.next % len(endpoints)
+		b.next++
+		rotated := append(append([]endpoint(nil), endpoints[start:]...), endpoints[:start]...)
+		copy(endpoints, rotated)
+	}
+
+	now := time.Now()
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		ni, nj := b.node(endpoints[i].base), b.node(endpoints[j].base)
+
+		ejectedI, ejectedJ := now.Before(ni.ejectedUntil), now.Before(nj.ejectedUntil)
+		if ejectedI != ejectedJ {
+			return ejectedJ
+		}
+
+		if b.policy.Strategy == LeastPending {
+			return ni.pending < nj.pending
+		}
+		return false
+	})
+}
+
+func (b *balancer) start(base string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.node(base).pending++
+}
+
+func (b *balancer) done(base string, healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := b.node(base)
+	n.pending--
+
+	if healthy {
+		n.failures = 0
+		n.ejectedUntil = time.Time{}
+		return
+	}
+
+	n.failures++
+	if n.failures >= b.policy.EjectAfter {
+		n.ejectedUntil = time.Now().Add(b.policy.EjectFor)
+	}
+}
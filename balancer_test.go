@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBalancerEjectsFailingURL(t *testing.T) {
+	var broken int32 = 1
+	var badHits, goodHits int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&badHits, 1)
+		if atomic.LoadInt32(&broken) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&goodHits, 1)
+	}))
+	defer good.Close()
+
+	const ejectFor = 100 * time.Millisecond
+	c := NewClient(WithBaseURLs(bad.URL, good.URL), WithBalancer(BalancePolicy{EjectAfter: 1, EjectFor: ejectFor}))
+	send := func() string {
+		var info ResponseInfo
+		if _, _, err := HttpReqJSON("GET", "/items", nil, nil, nil, nil, 5, nil, WithClient(c), WithResponseInfo(&info)); err != nil {
+			t.Fatal(err)
+		}
+		return info.Endpoint
+	}
+	hits := func() (int32, int32) {
+		return atomic.LoadInt32(&badHits), atomic.LoadInt32(&goodHits)
+	}
+
+	// the first request fails over to the good URL and ejects the bad one
+	if endpoint := send(); endpoint != good.URL+"/items" {
+		t.Errorf("answered by %s", endpoint)
+	}
+	if badCount, goodCount := hits(); badCount != 1 || goodCount != 1 {
+		t.Fatalf("bad got %d requests, good %d", badCount, goodCount)
+	}
+
+	// while ejected, round robin no longer starts with the bad URL
+	for i := 0; i < 4; i++ {
+		send()
+	}
+	if badCount, goodCount := hits(); badCount != 1 || goodCount != 5 {
+		t.Errorf("while ejected, bad got %d requests, good %d", badCount, goodCount)
+	}
+
+	// once the time is up, the bad URL is probed and back in the rotation
+	atomic.StoreInt32(&broken, 0)
+	time.Sleep(ejectFor)
+	endpoints := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		endpoints[send()] = true
+	}
+	if !endpoints[bad.URL+"/items"] || !endpoints[good.URL+"/items"] {
+		t.Errorf("after the cooldown, answered by %v", endpoints)
+	}
+}
+
+func TestBalancerLeastPending(t *testing.T) {
+	b := &balancer{policy: BalancePolicy{Strategy: LeastPending, EjectAfter: 1, EjectFor: time.Minute}, nodes: make(map[string]*node)}
+	endpoints := []endpoint{{base: "a"}, {base: "b"}, {base: "c"}}
+
+	b.start("a")
+	b.start("b")
+	b.start("b")
+	b.order(endpoints)
+	if endpoints[0].base != "c" || endpoints[1].base != "a" || endpoints[2].base != "b" {
+		t.Errorf("order %v", endpoints)
+	}
+
+	// an ejected URL is last whatever its load
+	b.start("c")
+	b.done("c", false)
+	b.order(endpoints)
+	if endpoints[2].base != "c" {
+		t.Errorf("order %v", endpoints)
+	}
+}
@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BatchOperation is a request of an OData $batch.
+type BatchOperation struct {
+	Method string
+	// URL is relative to the service root, e.g. "Products(1)".
+	URL     string
+	Headers map[string]string
+	Body    []byte
+	// ContentID identifies the operation within the batch, it is set to the
+	// position of the operation when left empty in a changeset.
+	ContentID string
+	// TransferEncoding is the Content-Transfer-Encoding of the part, "binary"
+	// by default, or "base64".
+	TransferEncoding string
+}
+
+// BatchResult is the response to a BatchOperation. Headers, ContentType and
+// Body are those of the embedded response, not of the MIME part.
+type BatchResult struct {
+	StatusCode int
+	ContentID  string
+	ResponsePart
+}
+
+// BatchBuilder accumulates the operations of an OData $batch request, sent as
+// one multipart/mixed POST. The zero value is ready to use.
+type BatchBuilder struct {
+	entries    []batchEntry
+	operations int
+}
+
+// batchEntry is a top-level part of the batch: an operation or a changeset.
+type batchEntry struct {
+	ops       []BatchOperation
+	changeset bool
+}
+
+// Add appends an operation outside of any changeset.
+func (b *BatchBuilder) Add(op BatchOperation) *BatchBuilder {
+	b.entries = append(b.entries, batchEntry{ops: []BatchOperation{op}})
+	b.operations++
+	return b
+}
+
+// AddChangeset appends operations which the service applies atomically.
+func (b *BatchBuilder) AddChangeset(ops ...BatchOperation) *BatchBuilder {
+	ops = append([]BatchOperation(nil), ops...)
+	for i := range ops {
+		if ops[i].ContentID == "" {
+			ops[i].ContentID = strconv.Itoa(b.operations + i + 1)
+		}
+	}
+	b.entries = append(b.entries, batchEntry{ops: ops, changeset: true})
+	b.operations += len(ops)
+	return b
+}
+
+// Send posts the batch to urlString, the $batch endpoint of the service, and
+// returns a result per operation in the order they were added. Responses are
+// matched by Content-ID when the service echoes it and by order otherwise. An
+// operation failing doesn't fail the batch, its status is in its result. The
+// single response of a failed changeset is the result of each operation of
+// the changeset. The results of operations the service didn't answer have a
+// StatusCode of 0.
+func (b *BatchBuilder) Send(urlString string, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, results []BatchResult, err error) {
+	contentType, body, err := b.encode()
+	if err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+	}
+
+	// the boundary is generated here, so a caller supplied Content-Type can't be kept
+	key, ok := headerKey(headers, "Content-Type")
+	if !ok {
+		key = "Content-Type"
+	}
+	headers = withHeader(headers, key, contentType)
+
+	o := newOptions(opts)
+	results = make([]BatchResult, b.operations)
+	start, entry := 0, 0
+	httpStatus, err = HttpReqMultipartFunc("POST", urlString, body, func(part *multipart.Part) error {
+		if entry >= len(b.entries) {
+			return nil
+		}
+		ops := b.entries[entry].ops
+		err := o.readBatchPart(part, ops, results[start:start+len(ops)])
+		if err != nil {
+			return &DecodeError{Err: fmt.Errorf("batch part %d: %w", entry+1, err)}
+		}
+		start, entry = start+len(ops), entry+1
+		return nil
+	}, headers, cookie, transport, timeout, opts...)
+	return httpStatus, results, err
+}
+
+// readBatchPart fills the results of the operations of a top-level part.
+func (o *options) readBatchPart(part *multipart.Part, ops []BatchOperation, results []BatchResult) error {
+	mediaType, params, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		result, err := o.readBatchResponse(part)
+		if err != nil {
+			return err
+		}
+		// a failed changeset is answered by a single response
+		for i, op := range ops {
+			results[i] = result
+			results[i].ContentID = op.ContentID
+		}
+		return nil
+	}
+
+	r := multipart.NewReader(part, params["boundary"])
+	for n := 0; ; n++ {
+		changesetPart, err := r.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := o.readBatchResponse(changesetPart)
+		changesetPart.Close()
+		if err != nil {
+			return err
+		}
+
+		i := n
+		for j, op := range ops {
+			if result.ContentID != "" && op.ContentID == result.ContentID {
+				i = j
+				break
+			}
+		}
+		if i < len(results) {
+			if result.ContentID == "" {
+				result.ContentID = ops[i].ContentID
+			}
+			results[i] = result
+		}
+	}
+}
+
+// readBatchResponse parses the HTTP response embedded in an application/http part.
+func (o *options) readBatchResponse(part *multipart.Part) (result BatchResult, err error) {
+	var r io.Reader = part
+	if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(r), nil)
+	if err != nil {
+		return result, err
+	}
+	defer response.Body.Close()
+
+	body, err := o.readPart(response.Body)
+	if err != nil {
+		return result, err
+	}
+
+	return BatchResult{
+		StatusCode: response.StatusCode,
+		ContentID:  part.Header.Get("Content-ID"),
+		ResponsePart: ResponsePart{
+			Headers:     response.Header,
+			ContentType: response.Header.Get("Content-Type"),
+			Body:        body,
+		},
+	}, nil
+}
+
+// encode serializes the batch as multipart/mixed, changesets being nested
+// multipart/mixed parts with their own boundary.
+func (b *BatchBuilder) encode() (contentType string, body []byte, err error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	for _, entry := range b.entries {
+		if !entry.changeset {
+			if err = writeBatchOperation(writer, entry.ops[0]); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+
+		var changeset bytes.Buffer
+		changesetWriter := multipart.NewWriter(&changeset)
+		for _, op := range entry.ops {
+			if err = writeBatchOperation(changesetWriter, op); err != nil {
+				return "", nil, err
+			}
+		}
+		if err = changesetWriter.Close(); err != nil {
+			return "", nil, err
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/mixed; boundary=" + changesetWriter.Boundary()}})
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err = part.Write(changeset.Bytes()); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return "", nil, err
+	}
+	return "multipart/mixed; boundary=" + writer.Boundary(), buf.Bytes(), nil
+}
+
+func writeBatchOperation(writer *multipart.Writer, op BatchOperation) error {
+	encoding := op.TransferEncoding
+	if encoding == "" {
+		encoding = "binary"
+	}
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "%s %s HTTP/1.1\r\n", strings.TrimSpace(strings.ToUpper(op.Method)), op.URL)
+
+	keys := make([]string, 0, len(op.Headers))
+	for k := range op.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&request, "%s: %s\r\n", k, op.Headers[k])
+	}
+	if _, ok := headerKey(op.Headers, "Content-Length"); !ok && len(op.Body) != 0 {
+		fmt.Fprintf(&request, "Content-Length: %d\r\n", len(op.Body))
+	}
+	request.WriteString("\r\n")
+	request.Write(op.Body)
+
+	content := request.Bytes()
+	switch strings.ToLower(encoding) {
+	case "binary", "8bit", "7bit":
+	case "base64":
+		content = wrapBase64(content)
+	default:
+		return fmt.Errorf("unsupported Content-Transfer-Encoding %q", encoding)
+	}
+
+	header := textproto.MIMEHeader{
+		"Content-Type":              {"application/http"},
+		"Content-Transfer-Encoding": {encoding},
+	}
+	if op.ContentID != "" {
+		header.Set("Content-ID", op.ContentID)
+	}
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(content)
+	return err
+}
+
+// wrapBase64 encodes data in lines of 76 characters, as MIME requires.
+func wrapBase64(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var buf bytes.Buffer
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	return buf.Bytes()
+}
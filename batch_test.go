@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// batchServer answers an OData $batch: 404 to single operations, 201 to the
+// operations of a changeset in reverse order, and a single 400 to a changeset
+// with an operation on failURL. It records the operations it received.
+func batchServer(t *testing.T, failURL string, seen *[]string) http.HandlerFunc {
+	writeResponse := func(w *multipart.Writer, contentID, response string) {
+		header := textproto.MIMEHeader{"Content-Type": {"application/http"}}
+		if contentID != "" {
+			header.Set("Content-ID", contentID)
+		}
+		part, _ := w.CreatePart(header)
+		io.WriteString(part, response)
+	}
+	readOperation := func(part *multipart.Part) *http.Request {
+		var r io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			r = base64.NewDecoder(base64.StdEncoding, r)
+		}
+		request, err := http.ReadRequest(bufio.NewReader(r))
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		*seen = append(*seen, strings.TrimSpace(fmt.Sprintf("%s %s %s %s", part.Header.Get("Content-ID"), request.Method, request.URL, body)))
+		return request
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		var out bytes.Buffer
+		writer := multipart.NewWriter(&out)
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			_, changesetParams, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if changesetParams["boundary"] == "" {
+				readOperation(part)
+				writeResponse(writer, "", "HTTP/1.1 404 Not Found\r\nContent-Type: application/json\r\n\r\n{}")
+				continue
+			}
+
+			changesetReader := multipart.NewReader(part, changesetParams["boundary"])
+			var ids []string
+			failed := false
+			for {
+				operation, err := changesetReader.NextPart()
+				if err != nil {
+					break
+				}
+				if request := readOperation(operation); request != nil && request.URL.String() == failURL {
+					failed = true
+				}
+				ids = append(ids, operation.Header.Get("Content-ID"))
+			}
+			if failed {
+				writeResponse(writer, "", "HTTP/1.1 400 Bad Request\r\nContent-Type: application/json\r\n\r\n{\"error\":\"rolled back\"}")
+				continue
+			}
+
+			var changeset bytes.Buffer
+			changesetWriter := multipart.NewWriter(&changeset)
+			for i := len(ids) - 1; i >= 0; i-- {
+				writeResponse(changesetWriter, ids[i], fmt.Sprintf("HTTP/1.1 201 Created\r\nContent-Type: application/json\r\n\r\n{\"id\":%q}", ids[i]))
+			}
+			changesetWriter.Close()
+			nested, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/mixed; boundary=" + changesetWriter.Boundary()}})
+			nested.Write(changeset.Bytes())
+		}
+		writer.Close()
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(out.Bytes())
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	var seen []string
+	srv := httptest.NewServer(batchServer(t, "/Products(8)", &seen))
+	defer srv.Close()
+
+	var b BatchBuilder
+	b.Add(BatchOperation{Method: "get", URL: "/Products(1)"})
+	b.AddChangeset(
+		BatchOperation{Method: "POST", URL: "/Products", Body: []byte(`{"a":1}`)},
+		BatchOperation{Method: "POST", URL: "/Products", Body: []byte(`{"a":2}`), TransferEncoding: "base64"},
+	)
+	b.AddChangeset(
+		BatchOperation{Method: "DELETE", URL: "/Products(9)"},
+		BatchOperation{Method: "DELETE", URL: "/Products(8)", ContentID: "x"},
+	)
+
+	status, results, err := b.Send(srv.URL+"/$batch", nil, nil, nil, 5)
+	if err != nil || status != http.StatusAccepted {
+		t.Fatal(status, err)
+	}
+
+	wantSeen := []string{
+		"GET /Products(1)",
+		`2 POST /Products {"a":1}`,
+		`3 POST /Products {"a":2}`,
+		"4 DELETE /Products(9)",
+		"x DELETE /Products(8)",
+	}
+	if strings.Join(seen, "\n") != strings.Join(wantSeen, "\n") {
+		t.Errorf("the service received\n%s", strings.Join(seen, "\n"))
+	}
+
+	// results are in the order of the operations, whatever the order of the
+	// responses, and a failed operation doesn't fail the others
+	want := []struct {
+		status    int
+		contentID string
+		body      string
+	}{
+		{http.StatusNotFound, "", "{}"},
+		{http.StatusCreated, "2", `{"id":"2"}`},
+		{http.StatusCreated, "3", `{"id":"3"}`},
+		{http.StatusBadRequest, "4", `{"error":"rolled back"}`},
+		{http.StatusBadRequest, "x", `{"error":"rolled back"}`},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.StatusCode != w.status || r.ContentID != w.contentID || string(r.Body) != w.body {
+			t.Errorf("result %d: %d %q %s, want %d %q %s", i, r.StatusCode, r.ContentID, r.Body, w.status, w.contentID, w.body)
+		}
+	}
+
+	var created struct{ ID string }
+	if err := results[1].Decode(&created); err != nil || created.ID != "2" {
+		t.Errorf("decoded %+v, %v", created, err)
+	}
+}
+
+func TestBatchUnansweredOperations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var out bytes.Buffer
+		writer := multipart.NewWriter(&out)
+		part, _ := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/http"}})
+		io.WriteString(part, "HTTP/1.1 200 OK\r\n\r\nfirst")
+		writer.Close()
+		w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+		w.Write(out.Bytes())
+	}))
+	defer srv.Close()
+
+	var b BatchBuilder
+	b.Add(BatchOperation{Method: "GET", URL: "/a"}).Add(BatchOperation{Method: "GET", URL: "/b"})
+	_, results, err := b.Send(srv.URL, nil, nil, nil, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].StatusCode != http.StatusOK || results[1].StatusCode != 0 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestBatchRejectsUnknownEncoding(t *testing.T) {
+	var b BatchBuilder
+	b.Add(BatchOperation{Method: "GET", URL: "/a", TransferEncoding: "quoted-printable"})
+	_, _, err := b.Send("http://127.0.0.1:1", nil, nil, nil, 5)
+	if err == nil || !strings.Contains(err.Error(), "quoted-printable") {
+		t.Errorf("got %v", err)
+	}
+}
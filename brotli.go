@@ -0,0 +1,18 @@
+//go:build brotli
+// +build brotli
+
+package utils
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Building with the brotli tag decodes Content-Encoding: br with a pure Go
+// decoder; the module using this package must require github.com/andybalholm/brotli.
+func init() {
+	RegisterEncoding("br", func(r io.Reader) (io.Reader, error) {
+		return brotli.NewReader(r), nil
+	})
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const (
+	// maxPresize caps the buffer allocated up front from Content-Length, which
+	// the server may set to anything.
+	maxPresize = 32 << 20
+	// maxPooledBuffer keeps buffers grown by rare huge responses out of the pool.
+	maxPooledBuffer = 16 << 20
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// WithBuffer reads the response body into buf, which is reset first. The
+// returned body aliases buf and is only valid until buf is reused.
+func WithBuffer(buf *bytes.Buffer) Option {
+	return func(o *options) {
+		o.buffer = buf
+	}
+}
+
+// WithBufferRelease reads the response body into a pooled buffer and stores in
+// release the func returning it to the pool. The returned body must not be used
+// after calling release, which is safe to call more than once or when no body was read.
+func WithBufferRelease(release *func()) Option {
+	return func(o *options) {
+		*release = func() {}
+		o.release = release
+	}
+}
+
+// readBody reads the response body, sized up front by its Content-Length.
+func (o *options) readBody(r io.Reader, contentLength int64) ([]byte, error) {
+	b := o.buffer
+	switch {
+	case b != nil:
+		b.Reset()
+	case o.release != nil:
+		b = bufferPool.Get().(*bytes.Buffer)
+		b.Reset()
+		o.setRelease(b)
+	default:
+		b = new(bytes.Buffer)
+	}
+
+	if o.truncateBody > 0 && contentLength > o.truncateBody {
+		contentLength = o.truncateBody
+	}
+	if contentLength > 0 && contentLength <= maxPresize {
+		// the extra MinRead spares ReadFrom a final grow before seeing EOF
+		b.Grow(int(contentLength) + bytes.MinRead)
+	}
+
+	_, err := b.ReadFrom(r)
+	return b.Bytes(), err
+}
+
+// setRelease hands b to the caller, releasing the buffer of an earlier attempt.
+func (o *options) setRelease(b *bytes.Buffer) {
+	(*o.release)()
+
+	var once sync.Once
+	*o.release = func() {
+		once.Do(func() {
+			if b.Cap() <= maxPooledBuffer {
+				bufferPool.Put(b)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func BenchmarkHttpReqBuffer(b *testing.B) {
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		w.Write(payload)
+	}))
+	defer srv.Close()
+
+	b.Run("default", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("WithBuffer", func(b *testing.B) {
+		var buf bytes.Buffer
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, WithBuffer(&buf)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("WithBufferRelease", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			var release func()
+			if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, WithBufferRelease(&release)); err != nil {
+				b.Fatal(err)
+			}
+			release()
+		}
+	})
+}
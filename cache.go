@@ -0,0 +1,461 @@
+package utils
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultCacheEntries bounds a MemoryCache created without a size.
+const defaultCacheEntries = 256
+
+// CacheStore keeps the responses of WithETagCache and ResponseCache. It must be
+// safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, response *CachedResponse)
+	Delete(key string)
+}
+
+// CachedResponse is a response kept in a CacheStore, which must not modify it.
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// Stored is when the response was received or last revalidated.
+	Stored time.Time
+	// Vary names the request headers the response depends on. The entry kept
+	// for the URL then only holds Vary, each variant has a key of its own.
+	Vary []string
+}
+
+// MemoryCache is a CacheStore holding a bounded number of entries in memory,
+// evicting the least recently used.
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type memoryEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewMemoryCache returns a MemoryCache of at most maxEntries entries, 256 when
+// maxEntries is not positive.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheEntries
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get returns the response kept for key.
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).response, true
+}
+
+// Set keeps response for key, evicting the least recently used entry when
+// the cache is full.
+func (c *MemoryCache) Set(key string, response *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*memoryEntry).response = response
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, response: response})
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// Delete forgets the response kept for key.
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Len returns the number of entries.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// WithETagCache keeps the successful GET responses carrying an ETag or a
+// Last-Modified header in store. Later GETs of the same URL, and of the same
+// values of the headers named by Vary, send If-None-Match and If-Modified-Since;
+// a 304 is then answered with the stored response and ResponseInfo.Cached. It
+// is left to the caller when a request sets one of these headers itself.
+func WithETagCache(store CacheStore) Option {
+	return func(o *options) {
+		o.etagCache = store
+	}
+}
+
+// WithForceRefresh makes the request ignore and replace the response stored by
+// WithETagCache or WithResponseCache.
+func WithForceRefresh() Option {
+	return func(o *options) {
+		o.forceRefresh = true
+	}
+}
+
+// ResponseCache answers GET and HEAD requests with the responses it keeps
+// while Cache-Control max-age, or else Expires, says they are fresh, taking
+// their Age into account, without sending the request. Responses to requests
+// with credentials are only served to requests with the same ones. Responses with no-store are not kept,
+// those with no-cache are always revalidated. Once stale, responses are
+// revalidated as WithETagCache does.
+type ResponseCache struct {
+	store        CacheStore
+	staleIfError time.Duration
+
+	hits, misses, revalidated, stale int64
+}
+
+// CacheStats counts the lookups of a ResponseCache. Misses include the requests
+// sent to revalidate a response, those the server confirmed are Revalidated.
+// Stale counts the stale responses served in place of an error.
+type CacheStats struct {
+	Hits        int64
+	Misses      int64
+	Revalidated int64
+	Stale       int64
+}
+
+// NewResponseCache returns a ResponseCache keeping the responses in store, a
+// NewMemoryCache(0) when nil. When the server fails with a 5xx status or can't
+// be reached, a stale response is served for staleIfError after it expired,
+// or for the stale-if-error the response gave.
+func NewResponseCache(store CacheStore, staleIfError time.Duration) *ResponseCache {
+	if store == nil {
+		store = NewMemoryCache(0)
+	}
+	return &ResponseCache{store: store, staleIfError: staleIfError}
+}
+
+// Stats returns the counts of the lookups so far.
+func (c *ResponseCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:        atomic.LoadInt64(&c.hits),
+		Misses:      atomic.LoadInt64(&c.misses),
+		Revalidated: atomic.LoadInt64(&c.revalidated),
+		Stale:       atomic.LoadInt64(&c.stale),
+	}
+}
+
+// WithResponseCache serves GET and HEAD requests from cache, see ResponseCache.
+// It replaces WithETagCache.
+func WithResponseCache(cache *ResponseCache) Option {
+	return func(o *options) {
+		o.responseCache = cache
+	}
+}
+
+// cacheStore returns the store of WithResponseCache or WithETagCache.
+func (o *options) cacheStore() CacheStore {
+	if o.responseCache != nil {
+		return o.responseCache.store
+	}
+	return o.etagCache
+}
+
+// caches reports whether the request goes through the cache of
+// WithResponseCache or WithETagCache. Downloads, spilled and streamed bodies
+// are never stored.
+func (o *options) caches(method string, headers map[string]string) bool {
+	switch {
+	case o.responseCache != nil:
+		if method != "GET" && method != "HEAD" {
+			return false
+		}
+	case o.etagCache != nil:
+		if method != "GET" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if o.download != nil || o.spill != nil || o.stream != nil {
+		return false
+	}
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "Range"} {
+		if _, ok := headerKey(headers, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sendCached answers the request with its stored response while it is fresh,
+// else sends it with the validators of the stored response, which a 304 answer
+// returns instead.
+func (o *options) sendCached(method, urlString, token string, headers map[string]string, send func(headers map[string]string) (int, []byte, error)) (httpStatus int, buf []byte, err error) {
+	store, cache := o.cacheStore(), o.responseCache
+	key := o.cacheKey(method, urlString, token, headers)
+
+	cached, variantKey := o.cached(key, token, headers)
+	if o.forceRefresh && cached != nil {
+		store.Delete(variantKey)
+		cached = nil
+	}
+
+	if cache != nil {
+		if cached != nil && cacheAge(cached) < freshness(cached.Header) {
+			atomic.AddInt64(&cache.hits, 1)
+			return o.serveCached(cached)
+		}
+		atomic.AddInt64(&cache.misses, 1)
+	}
+
+	conditional := headers
+	if cached != nil {
+		conditional = make(map[string]string, len(headers)+2)
+		for k, v := range headers {
+			conditional[k] = v
+		}
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			conditional["If-None-Match"] = etag
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			conditional["If-Modified-Since"] = modified
+		}
+	}
+
+	httpStatus, buf, err = send(conditional)
+	if err != nil {
+		if cache != nil && cached != nil && (httpStatus == 0 || httpStatus >= 500) && cache.servesStale(cached) {
+			atomic.AddInt64(&cache.stale, 1)
+			return o.serveCached(cached)
+		}
+		return httpStatus, buf, err
+	}
+
+	if httpStatus == http.StatusNotModified && cached != nil {
+		// the 304 updates the stored headers, except for the length of the body
+		header := cached.Header.Clone()
+		for k, v := range o.info.Header {
+			if k != "Content-Length" {
+				header[k] = v
+			}
+		}
+
+		updated := *cached
+		updated.Header, updated.Stored = header, time.Now()
+		store.Set(variantKey, &updated)
+
+		if cache != nil {
+			atomic.AddInt64(&cache.revalidated, 1)
+		}
+		return o.serveCached(&updated)
+	}
+
+	if httpStatus == http.StatusOK {
+		o.store(key, token, headers, buf)
+	}
+	return httpStatus, buf, err
+}
+
+// cacheKey keys the stored responses by method and URL, and by the credentials
+// of the request so that a response is never served to another user. The
+// credentials are hashed, keeping them out of the store.
+func (o *options) cacheKey(method, urlString, token string, headers map[string]string) string {
+	key := method + " " + urlString
+
+	var b strings.Builder
+	for _, value := range o.requestHeader("Authorization", token, headers) {
+		fmt.Fprintf(&b, "authorization: %q\n", value)
+	}
+	if o.tokenSource != nil {
+		fmt.Fprintf(&b, "tokens: %p\n", o.tokenSource)
+	}
+	if o.digest != nil {
+		fmt.Fprintf(&b, "digest: %q\n", o.digest[0]+":"+o.digest[1])
+	}
+	if b.Len() == 0 {
+		return key
+	}
+	return fmt.Sprintf("%s\nCredentials: %x", key, sha256.Sum256([]byte(b.String())))
+}
+
+// serveCached answers the request with a stored response.
+func (o *options) serveCached(cached *CachedResponse) (int, []byte, error) {
+	o.info.Status, o.info.Header, o.info.Cached = cached.Status, cached.Header.Clone(), true
+	return cached.Status, copyBytes(cached.Body), nil
+}
+
+// servesStale reports whether the stale response may replace an error.
+func (c *ResponseCache) servesStale(cached *CachedResponse) bool {
+	window := c.staleIfError
+	if value, ok := cacheControl(cached.Header)["stale-if-error"]; ok {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			window = time.Duration(seconds) * time.Second
+		}
+	}
+	return cacheAge(cached) < freshness(cached.Header)+window
+}
+
+// cached returns the response stored for the request and its key.
+func (o *options) cached(key, token string, headers map[string]string) (*CachedResponse, string) {
+	store := o.cacheStore()
+	cached, ok := store.Get(key)
+	if !ok {
+		return nil, key
+	}
+	if len(cached.Vary) == 0 {
+		return cached, key
+	}
+
+	variantKey := o.variantKey(key, cached.Vary, token, headers)
+	if cached, ok = store.Get(variantKey); !ok || len(cached.Vary) != 0 {
+		return nil, variantKey
+	}
+	return cached, variantKey
+}
+
+// store keeps the response just received, unless it can neither be fresh nor
+// be revalidated.
+func (o *options) store(key, token string, headers map[string]string, body []byte) {
+	header := o.info.Header
+	directives := cacheControl(header)
+	if _, ok := directives["no-store"]; ok {
+		return
+	}
+	if header.Get("ETag") == "" && header.Get("Last-Modified") == "" && (o.responseCache == nil || freshness(header) <= 0) {
+		return
+	}
+
+	var vary []string
+	for _, name := range headerList(header, "Vary") {
+		if name == "*" {
+			return
+		}
+		vary = append(vary, http.CanonicalHeaderKey(name))
+	}
+
+	store := o.cacheStore()
+	response := &CachedResponse{Status: o.info.Status, Header: header.Clone(), Body: copyBytes(body), Stored: time.Now()}
+	if len(vary) == 0 {
+		store.Set(key, response)
+		return
+	}
+	store.Set(key, &CachedResponse{Vary: vary, Stored: response.Stored})
+	store.Set(o.variantKey(key, vary, token, headers), response)
+}
+
+// cacheControl returns the directives of the Cache-Control header, by their
+// lower case names.
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range headerList(header, "Cache-Control") {
+		name, value := directive, ""
+		if i := strings.IndexByte(directive, '='); i >= 0 {
+			name, value = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return directives
+}
+
+// freshness is how long the response is fresh for: its max-age, else the time
+// from Date to Expires, 0 with no-cache or without either.
+func freshness(header http.Header) time.Duration {
+	directives := cacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	// an invalid Expires, such as "0", means already expired
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0
+	}
+	return expires.Sub(date)
+}
+
+// cacheAge is the age of the response, counting the Age it was received with.
+func cacheAge(cached *CachedResponse) time.Duration {
+	age := time.Since(cached.Stored)
+	if seconds, err := strconv.Atoi(cached.Header.Get("Age")); err == nil && seconds > 0 {
+		age += time.Duration(seconds) * time.Second
+	}
+	return age
+}
+
+// variantKey extends key with the values the request has for the headers of vary.
+func (o *options) variantKey(key string, vary []string, token string, headers map[string]string) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n" + name + ": " + strings.Join(o.requestHeader(name, token, headers), ", "))
+	}
+	return b.String()
+}
+
+// requestHeader returns the values the request is sent with for name, as far
+// as they are known before sending it.
+func (o *options) requestHeader(name, token string, headers map[string]string) (values []string) {
+	if name == "Authorization" {
+		if token != "" {
+			return []string{token}
+		}
+		if o.authorization != "" {
+			return []string{o.authorization}
+		}
+	}
+
+	if key, ok := headerKey(headers, name); ok {
+		values = append(values, headers[key])
+	}
+	for _, h := range o.addedHeaders {
+		if http.CanonicalHeaderKey(h.key) == name {
+			values = append(values, h.value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheKeepsCredentialsApart(t *testing.T) {
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	cache := NewResponseCache(nil, 0)
+	get := func(token string, opts ...Option) string {
+		_, body, err := HttpReqAuthJSON("GET", srv.URL, token, nil, nil, nil, nil, 5, nil, append(opts, WithResponseCache(cache))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	requests := []struct {
+		token string
+		opts  []Option
+	}{
+		{"Bearer alice", nil},
+		{"Bearer bob", nil},
+		{"", nil},
+		{"", []Option{WithBearerToken("carol")}},
+		{"", []Option{WithBasicAuth("dave", "secret")}},
+		{"Bearer alice", nil},
+		{"", []Option{WithBearerToken("carol")}},
+	}
+	for _, r := range requests {
+		get(r.token, r.opts...)
+	}
+
+	// only the repeated credentials are served from the cache
+	if len(seen) != 5 {
+		t.Errorf("server saw %q, want each credential once", seen)
+	}
+	if body := get("Bearer bob"); body != "Bearer bob" {
+		t.Errorf("bob got the response of %q", body)
+	}
+}
+
+func TestResponseCacheFreshness(t *testing.T) {
+	requests := make(map[string]int)
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+
+		now := time.Now().UTC()
+		w.Header().Set("Date", now.Format(http.TimeFormat))
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "max-age=300")
+		case "/aged":
+			w.Header().Set("Cache-Control", "max-age=300")
+			w.Header().Set("Age", "300")
+		case "/expires":
+			w.Header().Set("Expires", now.Add(time.Hour).Format(http.TimeFormat))
+		case "/expired":
+			w.Header().Set("Expires", now.Add(-time.Hour).Format(http.TimeFormat))
+		case "/max-age-wins":
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("Expires", now.Add(time.Hour).Format(http.TimeFormat))
+		case "/no-store":
+			w.Header().Set("Cache-Control", "max-age=300, no-store")
+		case "/no-cache":
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path     string
+		requests int
+	}{
+		{"/max-age", 1},
+		{"/aged", 3},
+		{"/expires", 1},
+		{"/expired", 3},
+		{"/max-age-wins", 3},
+		{"/no-store", 3},
+		{"/no-cache", 3},
+	}
+	cache := NewResponseCache(nil, 0)
+	for _, tt := range tests {
+		for i := 0; i < 3; i++ {
+			var info ResponseInfo
+			_, body, err := HttpReqJSON("GET", srv.URL+tt.path, nil, nil, nil, nil, 5, nil, WithResponseCache(cache), WithResponseInfo(&info))
+			if err != nil || string(body) != "body" {
+				t.Fatalf("%s: %q %v", tt.path, body, err)
+			}
+			if info.Cached != (i >= tt.requests) {
+				t.Errorf("%s: request %d has Cached %v", tt.path, i+1, info.Cached)
+			}
+		}
+		mu.Lock()
+		sent := requests[tt.path]
+		mu.Unlock()
+		if sent != tt.requests {
+			t.Errorf("%s: %d requests sent, want %d", tt.path, sent, tt.requests)
+		}
+	}
+}
+
+func TestETagCacheRevalidates(t *testing.T) {
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := r.Header.Get("Accept-Language")
+		etag := `"v1-` + lang + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Vary", "Accept-Language")
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Write([]byte(`{"lang":"` + lang + `"}`))
+	}))
+	defer srv.Close()
+
+	store := NewMemoryCache(10)
+	get := func(lang string, opts ...Option) (string, ResponseInfo) {
+		var out struct{ Lang string }
+		var info ResponseInfo
+		headers := map[string]string{"Accept-Language": lang}
+		status, _, err := HttpReqJSON("GET", srv.URL, nil, headers, nil, nil, 5, &out, append(opts, WithETagCache(store), WithResponseInfo(&info))...)
+		if err != nil || status != http.StatusOK {
+			t.Fatal(status, err)
+		}
+		return out.Lang, info
+	}
+
+	steps := []struct {
+		lang    string
+		opts    []Option
+		cached  bool
+		comment string
+	}{
+		{"en", nil, false, "first request"},
+		{"en", nil, true, "revalidated"},
+		{"de", nil, false, "another variant"},
+		{"de", nil, true, "its own validator"},
+		{"en", []Option{WithForceRefresh()}, false, "forced refresh"},
+		{"en", nil, true, "the refreshed entry"},
+	}
+	for _, step := range steps {
+		lang, info := get(step.lang, step.opts...)
+		if lang != step.lang || info.Cached != step.cached {
+			t.Errorf("%s: got %q with Cached %v", step.comment, lang, info.Cached)
+		}
+	}
+	if full != 3 || notModified != 3 {
+		t.Errorf("%d full responses and %d 304s, want 3 and 3", full, notModified)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", &CachedResponse{})
+	c.Set("b", &CachedResponse{})
+	c.Get("a")
+	c.Set("c", &CachedResponse{})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b was kept")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a was evicted")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len %d", c.Len())
+	}
+}
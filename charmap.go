@@ -0,0 +1,23 @@
+//go:build charmap
+// +build charmap
+
+package utils
+
+import (
+	"fmt"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Building with the charmap tag decodes the charsets of the WHATWG Encoding
+// standard which have no built-in table; the module using this package must
+// require golang.org/x/text.
+func init() {
+	extraCharsets = func(charset string, data []byte) ([]byte, error) {
+		encoding, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported charset %q", charset)
+		}
+		return encoding.NewDecoder().Bytes(data)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build charmap
+// +build charmap
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCharmapCharsets(t *testing.T) {
+	tests := []struct {
+		charset string
+		body    []byte
+		want    string
+	}{
+		{"windows-1250", []byte("\x8alu\x9dou\xe8k\xfd"), "Šluťoučký"},
+		{"koi8-r", []byte("\xf0\xd2\xc9\xd7\xc5\xd4"), "Привет"},
+		{"shift_jis", []byte("\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd"), "こんにちは"},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset="+tt.charset)
+			w.Write(append(append([]byte(`{"name":"`), tt.body...), `"}`...))
+		}))
+
+		var doc struct{ Name string }
+		_, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, &doc)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.charset, err)
+			continue
+		}
+		if doc.Name != tt.want {
+			t.Errorf("%s: decoded %q, want %q", tt.charset, doc.Name, tt.want)
+		}
+	}
+}
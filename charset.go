@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CharsetReader converts input in charset to UTF-8, see xml.Decoder.CharsetReader.
+type CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+// WithCharsetReader replaces the built-in charset support used for XML bodies
+// declaring a non UTF-8 encoding.
+func WithCharsetReader(fn CharsetReader) Option {
+	return func(o *options) {
+		o.charsetReader = fn
+	}
+}
+
+// WithoutTranscoding returns JSON bodies in the charset the server sent instead
+// of converting them to UTF-8.
+func WithoutTranscoding() Option {
+	return func(o *options) {
+		o.noTranscode = true
+	}
+}
+
+// transcode converts body to UTF-8 according to the charset parameter of the
+// response Content-Type and keeps the original in ResponseInfo.RawBody. Bodies
+// in unknown charsets are returned unchanged.
+func (o *options) transcode(body []byte) []byte {
+	if o.noTranscode || len(body) == 0 {
+		return body
+	}
+
+	_, params, err := mime.ParseMediaType(o.info.Header.Get("Content-Type"))
+	if err != nil {
+		return body
+	}
+
+	charset := strings.ToLower(params["charset"])
+	if charset == "" || charset == "utf-8" || charset == "utf8" {
+		return body
+	}
+
+	converted, err := decodeCharset(charset, body)
+	if err != nil {
+		return body
+	}
+
+	o.info.RawBody = body
+	return converted
+}
+
+// singleByteCharsets maps bytes 0x80-0xFF of single byte charsets to runes.
+// Other charsets need the package built with the charmap tag.
+var singleByteCharsets = map[string]*[128]rune{
+	"windows-1251": &windows1251,
+	"cp1251":       &windows1251,
+	"windows-1252": &windows1252,
+	"cp1252":       &windows1252,
+	"iso-8859-1":   &iso88591,
+	"latin1":       &iso88591,
+	"us-ascii":     &iso88591,
+}
+
+var windows1251 = [128]rune{
+	0x0402, 0x0403, 0x201A, 0x0453, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x20AC, 0x2030, 0x0409, 0x2039, 0x040A, 0x040C, 0x040B, 0x040F,
+	0x0452, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0xFFFD, 0x2122, 0x0459, 0x203A, 0x045A, 0x045C, 0x045B, 0x045F,
+	0x00A0, 0x040E, 0x045E, 0x0408, 0x00A4, 0x0490, 0x00A6, 0x00A7,
+	0x0401, 0x00A9, 0x0404, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x0407,
+	0x00B0, 0x00B1, 0x0406, 0x0456, 0x0491, 0x00B5, 0x00B6, 0x00B7,
+	0x0451, 0x2116, 0x0454, 0x00BB, 0x0458, 0x0405, 0x0455, 0x0457,
+	0x0410, 0x0411, 0x0412, 0x0413, 0x0414, 0x0415, 0x0416, 0x0417,
+	0x0418, 0x0419, 0x041A, 0x041B, 0x041C, 0x041D, 0x041E, 0x041F,
+	0x0420, 0x0421, 0x0422, 0x0423, 0x0424, 0x0425, 0x0426, 0x0427,
+	0x0428, 0x0429, 0x042A, 0x042B, 0x042C, 0x042D, 0x042E, 0x042F,
+	0x0430, 0x0431, 0x0432, 0x0433, 0x0434, 0x0435, 0x0436, 0x0437,
+	0x0438, 0x0439, 0x043A, 0x043B, 0x043C, 0x043D, 0x043E, 0x043F,
+	0x0440, 0x0441, 0x0442, 0x0443, 0x0444, 0x0445, 0x0446, 0x0447,
+	0x0448, 0x0449, 0x044A, 0x044B, 0x044C, 0x044D, 0x044E, 0x044F,
+}
+
+var windows1252 = [128]rune{
+	0x20AC, 0xFFFD, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0xFFFD, 0x017D, 0xFFFD,
+	0xFFFD, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0xFFFD, 0x017E, 0x0178,
+	0x00A0, 0x00A1, 0x00A2, 0x00A3, 0x00A4, 0x00A5, 0x00A6, 0x00A7,
+	0x00A8, 0x00A9, 0x00AA, 0x00AB, 0x00AC, 0x00AD, 0x00AE, 0x00AF,
+	0x00B0, 0x00B1, 0x00B2, 0x00B3, 0x00B4, 0x00B5, 0x00B6, 0x00B7,
+	0x00B8, 0x00B9, 0x00BA, 0x00BB, 0x00BC, 0x00BD, 0x00BE, 0x00BF,
+	0x00C0, 0x00C1, 0x00C2, 0x00C3, 0x00C4, 0x00C5, 0x00C6, 0x00C7,
+	0x00C8, 0x00C9, 0x00CA, 0x00CB, 0x00CC, 0x00CD, 0x00CE, 0x00CF,
+	0x00D0, 0x00D1, 0x00D2, 0x00D3, 0x00D4, 0x00D5, 0x00D6, 0x00D7,
+	0x00D8, 0x00D9, 0x00DA, 0x00DB, 0x00DC, 0x00DD, 0x00DE, 0x00DF,
+	0x00E0, 0x00E1, 0x00E2, 0x00E3, 0x00E4, 0x00E5, 0x00E6, 0x00E7,
+	0x00E8, 0x00E9, 0x00EA, 0x00EB, 0x00EC, 0x00ED, 0x00EE, 0x00EF,
+	0x00F0, 0x00F1, 0x00F2, 0x00F3, 0x00F4, 0x00F5, 0x00F6, 0x00F7,
+	0x00F8, 0x00F9, 0x00FA, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+}
+
+var iso88591 = func() (t [128]rune) {
+	for i := range t {
+		t[i] = rune(0x80 + i)
+	}
+	return
+}()
+
+// extraCharsets decodes the charsets without a table, when set by building with
+// the charmap tag.
+var extraCharsets func(charset string, data []byte) ([]byte, error)
+
+// charsetReader is the built-in CharsetReader.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = decodeCharset(charset, data)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// decodeCharset converts data in charset to UTF-8.
+func decodeCharset(charset string, data []byte) ([]byte, error) {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+
+	switch charset {
+	case "", "utf-8", "utf8":
+		return data, nil
+	case "utf-16", "utf-16le", "utf-16be":
+		return decodeUTF16(charset, data)
+	}
+
+	table, ok := singleByteCharsets[charset]
+	if !ok && extraCharsets != nil {
+		return extraCharsets(charset, data)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+
+	out := make([]byte, 0, len(data)+len(data)/2)
+	for _, b := range data {
+		if b < 0x80 {
+			out = append(out, b)
+			continue
+		}
+		out = utf8.AppendRune(out, table[b-0x80])
+	}
+	return out, nil
+}
+
+// decodeUTF16 converts UTF-16 to UTF-8. A BOM wins over the byte order of the
+// charset name, plain "utf-16" without BOM is read as big endian.
+func decodeUTF16(charset string, data []byte) ([]byte, error) {
+	var order binary.ByteOrder = binary.BigEndian
+	if charset == "utf-16le" {
+		order = binary.LittleEndian
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order, data = binary.LittleEndian, data[2:]
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order, data = binary.BigEndian, data[2:]
+	}
+
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("%s body has odd length %d", charset, len(data))
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+
+	out := make([]byte, 0, len(data))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+	return out, nil
+}
+
+// utf16Charset guesses a UTF-16 charset from the BOM or the leading "<" of an
+// XML document, which encoding declarations can't describe before decoding.
+func utf16Charset(data []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{'<', 0}):
+		return "utf-16le", true
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}), bytes.HasPrefix(data, []byte{0, '<'}):
+		return "utf-16be", true
+	}
+	return "", false
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// stripBOM drops a UTF-8 byte order mark and converts BOM marked UTF-16 to
+// UTF-8. Other data is returned unchanged.
+func stripBOM(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return data[len(utf8BOM):], nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16("utf-16le", data)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16("utf-16be", data)
+	}
+	return data, nil
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"unicode/utf16"
+)
+
+type charsetDoc struct {
+	Name string `xml:"name"`
+}
+
+func utf16LE(s string) []byte {
+	b := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func TestXMLCharsets(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want string
+	}{
+		{
+			"windows-1251",
+			[]byte("<?xml version=\"1.0\" encoding=\"windows-1251\"?><doc><name>\xcf\xf0\xe8\xe2\xe5\xf2</name></doc>"),
+			"Привет",
+		},
+		{
+			"ISO-8859-1",
+			[]byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><doc><name>Gr\xfc\xdfe</name></doc>"),
+			"Grüße",
+		},
+		{
+			"UTF-16",
+			utf16LE(`<?xml version="1.0" encoding="UTF-16"?><doc><name>héllo</name></doc>`),
+			"héllo",
+		},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write(tt.body)
+		}))
+
+		var doc charsetDoc
+		_, raw, err := HttpReqXML("GET", srv.URL, nil, nil, nil, nil, 5, &doc)
+		srv.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if doc.Name != tt.want {
+			t.Errorf("%s: decoded %q, want %q", tt.name, doc.Name, tt.want)
+		}
+		if !bytes.Equal(raw, tt.body) {
+			t.Errorf("%s: the body was returned converted", tt.name)
+		}
+	}
+}
+
+func TestBOMIsSkipped(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		body   []byte
+		want   string
+	}{
+		{"JSON with UTF-8 BOM", FormatJSON, []byte("\xef\xbb\xbf{\"name\":\"a\"}"), "a"},
+		{"JSON with UTF-16 BOM", FormatJSON, utf16LE(`{"name":"b"}`), "b"},
+		{"JSON without BOM", FormatJSON, []byte(`{"name":"c"}`), "c"},
+		{"JSON starting with a BOM in a string", FormatJSON, []byte("{\"name\":\"\xef\xbb\xbfd\"}"), "\ufeffd"},
+		{"JSON starting with the BOM as Latin-1 text", FormatJSON, []byte(`{"name":"ï»¿e"}`), "ï»¿e"},
+		{"XML with UTF-8 BOM", FormatXML, []byte("\xef\xbb\xbf<doc><name>f</name></doc>"), "f"},
+		{"XML without BOM", FormatXML, []byte("<doc><name>g</name></doc>"), "g"},
+	}
+
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// no charset parameter, which would have the body transcoded
+			w.Header().Set("Content-Type", "application/json")
+			if tt.format == FormatXML {
+				w.Header().Set("Content-Type", "application/xml")
+			}
+			w.Write(tt.body)
+		}))
+
+		var out struct {
+			Name string `json:"name" xml:"name"`
+		}
+		var raw []byte
+		var err error
+		if tt.format == FormatXML {
+			_, raw, err = HttpReqXML("GET", srv.URL, nil, nil, nil, nil, 5, &out)
+		} else {
+			_, raw, err = HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, &out)
+		}
+		srv.Close()
+
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if out.Name != tt.want {
+			t.Errorf("%s: decoded %q, want %q", tt.name, out.Name, tt.want)
+		}
+		if !bytes.Equal(raw, tt.body) {
+			t.Errorf("%s: the body was returned without its BOM", tt.name)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "net/http"
+
+// WithChunked sends the request body with Transfer-Encoding: chunked and no
+// Content-Length, even when its length is known. Empty bodies are not affected.
+func WithChunked() Option {
+	return func(o *options) {
+		o.chunked = true
+	}
+}
+
+// applyChunked hides the length of the request body from net/http.
+func (o *options) applyChunked(request *http.Request) {
+	if !o.chunked || request.Body == nil || request.Body == http.NoBody {
+		return
+	}
+	request.ContentLength = -1
+	request.TransferEncoding = []string{"chunked"}
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChunkedHasNoContentLength(t *testing.T) {
+	type seen struct {
+		transferEncoding []string
+		contentLength    int64
+		header           []string
+		body             string
+	}
+	var got seen
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = seen{r.TransferEncoding, r.ContentLength, r.Header["Content-Length"], string(body)}
+	}))
+	defer srv.Close()
+
+	body := []byte(`{"event":"a"}`)
+	if _, _, err := HttpReqJSON("POST", srv.URL, body, nil, nil, nil, 5, nil, WithChunked()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.transferEncoding) != 1 || got.transferEncoding[0] != "chunked" || got.contentLength != -1 || got.header != nil {
+		t.Errorf("WithChunked sent Transfer-Encoding %v, Content-Length %v", got.transferEncoding, got.header)
+	}
+	if got.body != string(body) {
+		t.Errorf("received %q", got.body)
+	}
+
+	if _, _, err := HttpReqJSON("POST", srv.URL, body, nil, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got.transferEncoding != nil || got.contentLength != int64(len(body)) {
+		t.Errorf("without WithChunked sent Transfer-Encoding %v, length %d", got.transferEncoding, got.contentLength)
+	}
+}
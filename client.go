@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedClients bounds the http.Client cache of a Client. Requests with
+// further transports get a fresh http.Client, as they did before caching.
+const maxCachedClients = 64
+
+// Client holds configuration and state shared by the requests made through it.
+// The zero value is not usable, create clients with NewClient.
+//
+// A Client keeps one http.Client per transport and timeout, so connections are
+// reused between requests. Passing a new *http.Transport on every call defeats
+// that: transports with identical plain settings are detected and the first
+// one is reused, but build the transport once (see NewClient and WithClient)
+// instead.
+type Client struct {
+	opts []Option
+
+	inFlight int64
+	closed   int32
+
+	clientsMu  sync.Mutex
+	clients    map[httpClientKey]*http.Client
+	transports map[derivedKey]*http.Transport
+	// keys of the transports of clients, net/http sets fields of a transport
+	// on first use, reading them again would race
+	transportKeys map[*http.Transport]string
+
+	flightsMu sync.Mutex
+	flights   map[string]*flight
+
+	violationsMu sync.Mutex
+	violations   map[violationKey]*Violation
+
+	digestsMu sync.Mutex
+	digests   map[string]*digestChallenge
+}
+
+type httpClientKey struct {
+	transport string
+	timeout   time.Duration
+	jar       uintptr
+}
+
+// defaultClient serves requests which were not given WithClient.
+var defaultClient = NewClient()
+
+// NewClient returns a Client applying opts to every request sent with WithClient.
+func NewClient(opts ...Option) *Client {
+	return &Client{
+		opts:          opts,
+		clients:       make(map[httpClientKey]*http.Client),
+		transports:    make(map[derivedKey]*http.Transport),
+		transportKeys: make(map[*http.Transport]string),
+		flights:       make(map[string]*flight),
+		violations:    make(map[violationKey]*Violation),
+		digests:       make(map[string]*digestChallenge),
+	}
+}
+
+// WithCookieJar stores and sends cookies through jar. A jar which is not a
+// pointer, unlike *cookiejar.Jar, gets a new http.Client for every request.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(o *options) {
+		o.jar = jar
+	}
+}
+
+// httpClient returns the cached http.Client for the transport and timeout.
+func (c *Client) httpClient(transport *http.Transport, timeout time.Duration, jar http.CookieJar) *http.Client {
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+
+	transportID, ok := c.transportKeys[transport]
+	if !ok {
+		transportID = transportKey(transport)
+	}
+	jarID, cacheable := jarKey(jar)
+	key := httpClientKey{transport: transportID, timeout: timeout, jar: jarID}
+
+	if client, ok := c.clients[key]; ok && cacheable {
+		return client
+	}
+
+	client := &http.Client{
+		Timeout:       timeout,
+		CheckRedirect: checkRedirect,
+		Jar:           jar,
+	}
+	if transport != nil {
+		client.Transport = transport
+	} else {
+		client.Transport = defaultTransport
+	}
+
+	if cacheable && len(c.clients) < maxCachedClients {
+		c.clients[key] = client
+	}
+	if transport != nil && len(c.transportKeys) < maxCachedClients {
+		c.transportKeys[transport] = transportID
+	}
+	return client
+}
+
+// jarKey identifies jar by its address. Jars of other kinds, which may not even
+// be comparable, can't be told apart and their http.Client is not cached.
+func jarKey(jar http.CookieJar) (key uintptr, cacheable bool) {
+	if jar == nil {
+		return 0, true
+	}
+	if v := reflect.ValueOf(jar); v.Kind() == reflect.Ptr {
+		return v.Pointer(), true
+	}
+	return 0, false
+}
+
+// transportKey identifies a transport. Transports without funcs, pointers or
+// other references are fingerprinted by their settings, so that transports
+// built the same way on every call share one http.Client. Others are told
+// apart by their address: closures such as http.ProxyURL can't be compared.
+func transportKey(transport *http.Transport) string {
+	if transport == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	v := reflect.ValueOf(transport).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Func, reflect.Ptr, reflect.Map, reflect.Chan, reflect.Slice, reflect.Interface:
+			if !field.IsNil() {
+				return fmt.Sprintf("%p", transport)
+			}
+		default:
+			fmt.Fprintf(&b, "%v;", field.Interface())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestTransportKey(t *testing.T) {
+	plain1 := &http.Transport{MaxIdleConns: 7}
+	plain2 := &http.Transport{MaxIdleConns: 7}
+	if transportKey(plain1) != transportKey(plain2) {
+		t.Error("transports with identical plain settings have different keys")
+	}
+	if transportKey(plain1) == transportKey(&http.Transport{MaxIdleConns: 8}) {
+		t.Error("transports with different settings share a key")
+	}
+
+	u1, _ := url.Parse("http://proxy1:8080")
+	u2, _ := url.Parse("http://proxy2:8080")
+	proxied1 := &http.Transport{Proxy: http.ProxyURL(u1)}
+	proxied2 := &http.Transport{Proxy: http.ProxyURL(u2)}
+	if transportKey(proxied1) == transportKey(proxied2) {
+		t.Error("transports with different proxies share a key")
+	}
+	if transportKey(proxied1) != transportKey(proxied1) {
+		t.Error("the key of a transport changes")
+	}
+
+	c := NewClient()
+	if c.httpClient(proxied1, 0, nil) == c.httpClient(proxied2, 0, nil) {
+		t.Error("transports with different proxies share an http.Client")
+	}
+	if c.httpClient(plain1, 0, nil) != c.httpClient(plain2, 0, nil) {
+		t.Error("identical transports don't share an http.Client")
+	}
+}
+
+// hostJar is a cookie jar which is not comparable, being a map.
+type hostJar map[string][]*http.Cookie
+
+func (j hostJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j[u.Host] = append(j[u.Host], cookies...)
+}
+
+func (j hostJar) Cookies(u *url.URL) []*http.Cookie {
+	return j[u.Host]
+}
+
+func TestCookieJarKey(t *testing.T) {
+	c := NewClient()
+	jar1, _ := cookiejar.New(nil)
+	jar2, _ := cookiejar.New(nil)
+	if c.httpClient(nil, 0, jar1) != c.httpClient(nil, 0, jar1) {
+		t.Error("a jar doesn't keep its http.Client")
+	}
+	if c.httpClient(nil, 0, jar1) == c.httpClient(nil, 0, jar2) {
+		t.Error("two jars share an http.Client")
+	}
+
+	var session string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err == nil {
+			session = cookie.Value
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+	}))
+	defer srv.Close()
+
+	jar := hostJar{}
+	for i := 0; i < 2; i++ {
+		if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, WithClient(c), WithCookieJar(jar)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if session != "s1" {
+		t.Errorf("the cookie of the jar was not sent back, got %q", session)
+	}
+}
+
+// TestSharedTransportFirstUse is meant for -race: net/http sets fields of a
+// transport on its first request, while others look the transport up.
+func TestSharedTransportFirstUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := NewClient()
+	transport := &http.Transport{}
+	defer transport.CloseIdleConnections()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, transport, 5, nil, WithClient(c)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
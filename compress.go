@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+type compression struct {
+	level     int
+	threshold int64
+}
+
+// WithCompressRequest gzips request bodies of at least threshold bytes at the
+// given level (gzip.DefaultCompression, 1 to 9) and sets Content-Encoding.
+// Streamed bodies of unknown length are always compressed and sent chunked.
+// Bodies for which the caller set a Content-Encoding are left alone.
+func WithCompressRequest(level, threshold int) Option {
+	return func(o *options) {
+		o.compress = &compression{level: level, threshold: int64(threshold)}
+	}
+}
+
+// compressBody compresses the request body once for all attempts, into
+// compressedBody or by wrapping the stream.
+func (o *options) compressBody(data []byte, headers map[string]string) error {
+	if o.compress == nil {
+		return nil
+	}
+	if _, ok := headerKey(headers, "Content-Encoding"); ok {
+		return nil
+	}
+
+	if o.stream != nil {
+		if o.stream.length >= 0 && o.stream.length < o.compress.threshold {
+			return nil
+		}
+		o.stream = o.stream.gzipped(o.compress.level)
+		o.compressed = true
+		return nil
+	}
+
+	if len(data) == 0 || int64(len(data)) < o.compress.threshold {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, o.compress.level)
+	if err != nil {
+		return err
+	}
+	if _, err = zw.Write(data); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+
+	o.compressedBody = buf.Bytes()
+	o.compressed = true
+	return nil
+}
+
+// gzipped returns s compressed on the fly, with an unknown length.
+func (s *streamBody) gzipped(level int) *streamBody {
+	return &streamBody{
+		replayable: s.replayable,
+		length:     -1,
+		open: func() (io.ReadCloser, error) {
+			body, err := s.open()
+			if err != nil {
+				return nil, err
+			}
+			zw, err := gzip.NewWriterLevel(nil, level)
+			if err != nil {
+				body.Close()
+				return nil, err
+			}
+
+			pr, pw := io.Pipe()
+			zw.Reset(pw)
+			go func() {
+				_, err := io.Copy(zw, body)
+				if err == nil {
+					err = zw.Close()
+				}
+				body.Close()
+				pw.CloseWithError(err)
+			}()
+			return pr, nil
+		},
+	}
+}
+
+// applyCompression labels a body compressed by compressBody.
+func (o *options) applyCompression(request *http.Request) {
+	if o.compressed && request.Body != nil && request.Body != http.NoBody {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+}
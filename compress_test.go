@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressRequest(t *testing.T) {
+	type seen struct {
+		encoding string
+		wire     int
+		body     []byte
+	}
+	var got seen
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wire, _ := ioutil.ReadAll(r.Body)
+		got = seen{encoding: r.Header.Get("Content-Encoding"), wire: len(wire), body: wire}
+		if got.encoding == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(wire))
+			if err != nil {
+				t.Errorf("not a gzip body: %v", err)
+				return
+			}
+			got.body, _ = ioutil.ReadAll(zr)
+		}
+	}))
+	defer srv.Close()
+
+	large := []byte(`{"a":"` + strings.Repeat("x", 10000) + `"}`)
+	small := []byte(`{}`)
+	compress := WithCompressRequest(gzip.BestCompression, 1024)
+
+	if _, _, err := HttpReqJSON("POST", srv.URL, large, nil, nil, nil, 5, nil, compress); err != nil {
+		t.Fatal(err)
+	}
+	if got.encoding != "gzip" || got.wire >= len(large) || !bytes.Equal(got.body, large) {
+		t.Errorf("large body: Content-Encoding %q, %d bytes on the wire, same body %v", got.encoding, got.wire, bytes.Equal(got.body, large))
+	}
+
+	if _, _, err := HttpReqJSON("POST", srv.URL, small, nil, nil, nil, 5, nil, compress); err != nil {
+		t.Fatal(err)
+	}
+	if got.encoding != "" || !bytes.Equal(got.body, small) {
+		t.Errorf("a body under the threshold was sent with Content-Encoding %q", got.encoding)
+	}
+
+	file := FileItem{Key: "f", FileName: "f.json", Reader: bytes.NewReader(large)}
+	if _, _, err := HttpReqPostFile(srv.URL, nil, file, nil, nil, nil, 5, nil, compress); err != nil {
+		t.Fatal(err)
+	}
+	if got.encoding != "gzip" || !bytes.Contains(got.body, large) {
+		t.Errorf("multipart upload: Content-Encoding %q, file received %v", got.encoding, bytes.Contains(got.body, large))
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrConcurrencyLimit matches, with errors.Is, the error of a request whose
+// context ended while waiting for a WithMaxConcurrent slot.
+var ErrConcurrencyLimit = errors.New("no free request slot")
+
+type slotWaitError struct {
+	err error
+}
+
+func (e *slotWaitError) Error() string {
+	return ErrConcurrencyLimit.Error() + ": " + e.err.Error()
+}
+
+func (e *slotWaitError) Unwrap() error {
+	return e.err
+}
+
+func (e *slotWaitError) Is(target error) bool {
+	return target == ErrConcurrencyLimit
+}
+
+// WithMaxConcurrent caps the number of requests in flight at once, zero means
+// no limit. Like WithRateLimit it should be passed to NewClient.
+func WithMaxConcurrent(n int) Option {
+	var slots chan struct{}
+	if n > 0 {
+		slots = make(chan struct{}, n)
+	}
+	return func(o *options) {
+		o.slots = slots
+	}
+}
+
+// InFlight returns the number of requests currently sent through the Client.
+func (c *Client) InFlight() int {
+	return int(atomic.LoadInt64(&c.inFlight))
+}
+
+// acquireSlot waits for a WithMaxConcurrent slot, release must be called after.
+func (o *options) acquireSlot() (release func(), err error) {
+	if o.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case o.slots <- struct{}{}:
+		return func() { <-o.slots }, nil
+	case <-o.context().Done():
+		return nil, &slotWaitError{err: o.context().Err()}
+	}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type csvConfig struct {
+	delimiter  rune
+	lazyQuotes bool
+	header     bool
+}
+
+// WithCSVDelimiter sets the field delimiter of CSV responses, ',' by default.
+func WithCSVDelimiter(delimiter rune) Option {
+	return func(o *options) {
+		o.csv.delimiter = delimiter
+	}
+}
+
+// WithCSVLazyQuotes accepts quotes inside unquoted fields and unescaped quotes
+// inside quoted ones.
+func WithCSVLazyQuotes() Option {
+	return func(o *options) {
+		o.csv.lazyQuotes = true
+	}
+}
+
+// WithCSVHeader leaves the first record of CSV responses out of the records
+// returned, as it names the columns.
+func WithCSVHeader() Option {
+	return func(o *options) {
+		o.csv.header = true
+	}
+}
+
+// HttpReqCSV returns the records of a CSV response. Malformed records fail with
+// a DecodeError giving their line.
+func HttpReqCSV(method, urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, records [][]string, err error) {
+	httpStatus, err = HttpReqCSVFunc(method, urlString, body, func(record []string) error {
+		records = append(records, record)
+		return nil
+	}, headers, cookie, transport, timeout, opts...)
+	return
+}
+
+// HttpReqCSVFunc calls fn with each record of a CSV response while it is read,
+// without buffering the body. An error of fn stops reading and is returned in
+// a WriteError.
+func HttpReqCSVFunc(method, urlString string, body []byte, fn func(record []string) error, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, err error) {
+	return httpReqCSV(method, urlString, body, false, func(_ *csv.Reader, _, record []string) error {
+		return fn(record)
+	}, headers, cookie, transport, timeout, opts)
+}
+
+// HttpReqCSVStructs appends the records of a CSV response to out, a pointer to a
+// slice of structs. The first record names the columns, which are matched to
+// the `csv:"name"` tags of the fields, or their names. Columns without a field
+// are ignored.
+func HttpReqCSVStructs(method, urlString string, body []byte, out interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, err error) {
+	slice := reflect.ValueOf(out)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice || slice.Elem().Type().Elem().Kind() != reflect.Struct {
+		return httpStatus, &ResourceError{URL: urlString, Err: fmt.Errorf("out must be a pointer to a slice of structs, not %T", out)}
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+
+	var fields []int
+	return httpReqCSV(method, urlString, body, true, func(r *csv.Reader, header, record []string) error {
+		if fields == nil {
+			fields = csvFields(elemType, header)
+		}
+
+		elem := reflect.New(elemType).Elem()
+		for i, value := range record {
+			if i >= len(fields) || fields[i] < 0 {
+				continue
+			}
+			if err := setCSVField(elem.Field(fields[i]), value); err != nil {
+				line, column := r.FieldPos(i)
+				return &DecodeError{Line: line, Column: column, Err: fmt.Errorf("column %q: %w", header[i], err)}
+			}
+		}
+		slice.Set(reflect.Append(slice, elem))
+		return nil
+	}, headers, cookie, transport, timeout, opts)
+}
+
+// httpReqCSV streams the records of the response to fn, along with the
+// header when there is one.
+func httpReqCSV(method, urlString string, body []byte, header bool, fn func(r *csv.Reader, header, record []string) error, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts []Option) (httpStatus int, err error) {
+	if _, ok := headerKey(headers, "Accept"); !ok {
+		headers = withHeader(headers, "Accept", "text/csv")
+	}
+
+	o := newOptions(opts)
+	config := o.csv
+	config.header = config.header || header
+
+	consume := func(response *http.Response, body io.Reader) error {
+		r := csv.NewReader(skipUTF8BOM(body))
+		if config.delimiter != 0 {
+			r.Comma = config.delimiter
+		}
+		r.LazyQuotes = config.lazyQuotes
+
+		var columns []string
+		for {
+			record, err := r.Read()
+			if err == io.EOF {
+				return nil
+			}
+
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return &DecodeError{
+					ContentType: response.Header.Get("Content-Type"),
+					HTTPCode:    response.StatusCode,
+					Line:        parseErr.Line,
+					Column:      parseErr.Column,
+					Err:         err,
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			if config.header && columns == nil {
+				columns = record
+				continue
+			}
+			if err = fn(r, columns, record); err != nil {
+				var decodeErr *DecodeError
+				if errors.As(err, &decodeErr) {
+					decodeErr.ContentType = response.Header.Get("Content-Type")
+					decodeErr.HTTPCode = response.StatusCode
+				}
+				return err
+			}
+		}
+	}
+
+	httpStatus, _, err = httpDownload(method, urlString, "", body, &download{consume: consume}, headers, cookie, transport, timeout, opts)
+	return httpStatus, err
+}
+
+func skipUTF8BOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if prefix, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	return br
+}
+
+// csvFields maps the columns of header to the indexes of the fields of t, -1
+// for columns without a field.
+func csvFields(t reflect.Type, header []string) []int {
+	byName := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("csv"); ok {
+			if tag == "-" {
+				continue
+			}
+			name = tag
+		}
+		byName[strings.ToLower(name)] = i
+	}
+
+	fields := make([]int, len(header))
+	for i, column := range header {
+		index, ok := byName[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			index = -1
+		}
+		fields[i] = index
+	}
+	return fields
+}
+
+func setCSVField(field reflect.Value, value string) error {
+	if field.CanAddr() {
+		if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(value))
+		}
+	}
+
+	if field.Kind() == reflect.Ptr {
+		if value == "" {
+			return nil
+		}
+		field.Set(reflect.New(field.Type().Elem()))
+		return setCSVField(field.Elem(), value)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+		return nil
+	}
+
+	if value = strings.TrimSpace(value); value == "" {
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		field.SetBool(b)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		field.SetInt(n)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		field.SetUint(n)
+		return err
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		field.SetFloat(f)
+		return err
+	}
+	return fmt.Errorf("unsupported field type %s", field.Type())
+}
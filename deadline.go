@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// RuleStrictDeadline is broken by a request which may run longer than
+// WithStrictDeadline allows.
+const RuleStrictDeadline Rule = "strict_deadline"
+
+// WithStrictDeadline rejects requests which have neither a timeout nor a
+// context deadline within max.
+func WithStrictDeadline(max time.Duration) Option {
+	return func(o *options) {
+		o.strictDeadline = max
+	}
+}
+
+// checkDeadline applies WithStrictDeadline to the timeout of the request, zero
+// when it has none.
+func (o *options) checkDeadline(timeout time.Duration) error {
+	if o.strictDeadline <= 0 || timeout > 0 && timeout <= o.strictDeadline {
+		return nil
+	}
+	if deadline, ok := o.context().Deadline(); ok && time.Until(deadline) <= o.strictDeadline {
+		return nil
+	}
+
+	value := "none"
+	if timeout > 0 {
+		value = timeout.String()
+	}
+	err := fmt.Errorf("the request has a timeout of %s, more than the %s allowed", value, o.strictDeadline)
+	return o.enforce(RuleStrictDeadline, value, err)
+}
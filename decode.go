@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const defaultSnippetSize = 512
+
+// DecodeError is returned when the response body can't be unmarshalled.
+type DecodeError struct {
+	ContentType string
+	HTTPCode    int
+	Snippet     string
+	// Line and Column locate the error in the body, starting at 1, when the
+	// decoder reports it and 0 otherwise.
+	Line   int
+	Column int
+	Err    error
+}
+
+// positionError is implemented by decoder errors which know their line and
+// column, 0 when unknown.
+type positionError interface {
+	Position() (line, column int)
+}
+
+func (de *DecodeError) Error() string {
+	return fmt.Sprintf(
+		"Decode error: status code: %v, content type: %s, err: %v, body: %s",
+		de.HTTPCode,
+		de.ContentType,
+		de.Err,
+		de.Snippet,
+	)
+}
+
+func (de *DecodeError) Unwrap() error {
+	return de.Err
+}
+
+// WithSnippetSize sets how many leading body bytes a DecodeError keeps, 512 by default.
+func WithSnippetSize(n int) Option {
+	return func(o *options) {
+		o.snippetSize = &n
+	}
+}
+
+// Format names a body encoding the package can decode.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatXML  Format = "xml"
+
+	// formatAuto picks the format from the response Content-Type.
+	formatAuto Format = "auto"
+)
+
+// WithUseNumber decodes JSON numbers into interface{} values as json.Number
+// rather than float64, so large integer IDs keep their precision.
+func WithUseNumber() Option {
+	return func(o *options) {
+		o.useNumber = true
+	}
+}
+
+func (o *options) unmarshal(format Format, data []byte, v interface{}) error {
+	if format != FormatJSON && format != FormatXML {
+		codec, err := formatCodec(format)
+		if err != nil {
+			return err
+		}
+		return codec.Unmarshal(data, v)
+	}
+
+	if format == FormatXML {
+		return o.unmarshalXML(bytes.TrimPrefix(data, utf8BOM), v)
+	}
+
+	data, err := stripBOM(data)
+	if err != nil {
+		return err
+	}
+
+	if !o.useNumber {
+		return json.Unmarshal(data, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after top-level JSON value")
+	}
+	return nil
+}
+
+// unmarshalXML decodes data honoring the encoding declared by the document.
+func (o *options) unmarshalXML(data []byte, v interface{}) error {
+	decoder, err := o.xmlDecoder(data)
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(v)
+}
+
+// xmlDecoder reads data converted from the encoding declared by the document.
+func (o *options) xmlDecoder(data []byte) (*xml.Decoder, error) {
+	transcoded := false
+	if charset, ok := utf16Charset(data); ok {
+		var err error
+		if data, err = decodeUTF16(charset, data); err != nil {
+			return nil, err
+		}
+		transcoded = true
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// the document still declares UTF-16, but it has been converted already
+		if transcoded && strings.HasPrefix(strings.ToLower(charset), "utf-16") {
+			return input, nil
+		}
+		if o.charsetReader != nil {
+			return o.charsetReader(charset, input)
+		}
+		return charsetReader(charset, input)
+	}
+	return decoder, nil
+}
+
+// WithErrorStruct decodes the body of an unsuccessful response, using the format
+// of the wrapper, into a new value of the type v points to and attaches it to
+// ResourceError.Body. v itself is left alone, so requests may share the option.
+func WithErrorStruct(v interface{}) Option {
+	return func(o *options) {
+		o.errorStruct = v
+	}
+}
+
+// httpReq sends the request and decodes the response body in the given format.
+// A non-empty contentType is set unless the caller supplied their own.
+func httpReq(format Format, contentType, method, urlString, token string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts []Option) (httpStatus int, responseBody []byte, err error) {
+	o := newOptions(opts)
+
+	if contentType != "" {
+		headers = o.withContentType(headers, method, body, contentType)
+	}
+	headers = o.withAccept(headers, format)
+
+	httpStatus, responseBody, err = sendHttpReq(o, method, urlString, token, body, headers, cookie, transport, timeout)
+
+	var formatErr error
+	if format == formatAuto {
+		format, formatErr = o.formatFromResponse()
+	}
+
+	if format == FormatJSON {
+		responseBody = o.transcode(responseBody)
+	}
+
+	if err != nil {
+		if formatErr == nil {
+			o.decodeErrorBody(format, err, responseBody)
+		}
+		return
+	}
+
+	if responseStruct != nil && len(responseBody) > 0 && !hasNoContent(httpStatus) {
+		if formatErr != nil {
+			return httpStatus, responseBody, o.decodeError(formatErr, responseBody)
+		}
+
+		if encoding := o.info.ContentEncoding; encoding != "" && !o.rawEncoding {
+			err = fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+			return httpStatus, responseBody, o.decodeError(err, responseBody)
+		}
+
+		if err = o.unmarshal(format, responseBody, responseStruct); err != nil {
+			return httpStatus, responseBody, o.decodeError(err, responseBody)
+		}
+		o.info.Decoded = true
+		o.info.Format = format
+	}
+	return
+}
+
+// decodeErrorBody attaches the decoded error payload to a status error. A
+// payload which can't be decoded leaves the error as is.
+func (o *options) decodeErrorBody(format Format, err error, body []byte) {
+	var re *ResourceError
+	if o.errorStruct == nil || len(body) == 0 || !errors.As(err, &re) || re.HTTPCode == 0 {
+		return
+	}
+
+	// a value per request, as concurrent requests share the option
+	t := reflect.TypeOf(o.errorStruct)
+	if t.Kind() != reflect.Ptr {
+		return
+	}
+	v := reflect.New(t.Elem()).Interface()
+	if o.unmarshal(format, body, v) == nil {
+		re.Body = v
+	}
+}
+
+func (o *options) decodeError(err error, body []byte) *DecodeError {
+	// positions are reported on the redacted body, which the snippet shows
+	line, column := errorPosition(err, body)
+	if redacted, spans := redactJSON(body); len(spans) != 0 {
+		body = redacted
+		if offset, ok := errorOffset(err); ok {
+			line, column = offsetPosition(body, redactedOffset(offset, spans))
+		}
+	} else {
+		body = redactText(body)
+	}
+
+	size := defaultSnippetSize
+	if o.snippetSize != nil {
+		size = *o.snippetSize
+	}
+	if size > len(body) {
+		size = len(body)
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	return &DecodeError{
+		ContentType: o.info.Header.Get("Content-Type"),
+		HTTPCode:    o.info.Status,
+		Snippet:     string(body[:size]),
+		Line:        line,
+		Column:      column,
+		Err:         err,
+	}
+}
+
+// errorPosition finds where in body the decoder failed.
+func errorPosition(err error, body []byte) (line, column int) {
+	var positioned positionError
+	if errors.As(err, &positioned) {
+		return positioned.Position()
+	}
+
+	offset, ok := errorOffset(err)
+	if !ok {
+		return 0, 0
+	}
+	return offsetPosition(body, offset)
+}
+
+// errorOffset returns the byte offset of a JSON decoding error.
+func errorOffset(err error) (int64, bool) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return syntaxErr.Offset, true
+	case errors.As(err, &typeErr):
+		return typeErr.Offset, true
+	}
+	return 0, false
+}
+
+func offsetPosition(body []byte, offset int64) (line, column int) {
+	if offset > int64(len(body)) {
+		offset = int64(len(body))
+	}
+
+	// the offset counts the byte the decoder failed at
+	line = 1
+	for _, c := range body[:offset] {
+		if c == '\n' {
+			line, column = line+1, 0
+		} else {
+			column++
+		}
+	}
+	if column == 0 {
+		column = 1
+	}
+	return line, column
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestUseNumberKeepsLargeIDs(t *testing.T) {
+	const id int64 = 1<<53 + 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"id": id})
+	}))
+	defer srv.Close()
+
+	var out map[string]interface{}
+	if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, &out, WithUseNumber()); err != nil {
+		t.Fatal(err)
+	}
+	number, ok := out["id"].(json.Number)
+	if !ok {
+		t.Fatalf("id is a %T, want json.Number", out["id"])
+	}
+	if got, err := number.Int64(); err != nil || got != id {
+		t.Errorf("id = %v, want %d", number, id)
+	}
+
+	out = nil
+	if _, _, err := HttpReqAuthJSON("GET", srv.URL, "token", nil, nil, nil, nil, 5, &out, WithUseNumber()); err != nil {
+		t.Fatal(err)
+	}
+	if number, _ := out["id"].(json.Number); number.String() != "9007199254740993" {
+		t.Errorf("the Auth variant decoded id = %v", out["id"])
+	}
+
+	out = nil
+	if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, &out); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := out["id"].(float64); int64(f) == id {
+		t.Errorf("without WithUseNumber id = %v, expected float64 rounding", out["id"])
+	}
+}
+
+func TestErrorStructPerRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"code":%q}`, r.URL.Query().Get("code"))
+	}))
+	defer srv.Close()
+
+	type apiError struct{ Code string }
+	template := &apiError{}
+	shared := WithErrorStruct(template)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(code string) {
+			defer wg.Done()
+			_, _, err := HttpReqJSON("GET", srv.URL+"?code="+code, nil, nil, nil, nil, 5, nil, shared)
+			var re *ResourceError
+			if !errors.As(err, &re) {
+				t.Errorf("got %v", err)
+				return
+			}
+			if body, ok := re.Body.(*apiError); !ok || body.Code != code {
+				t.Errorf("request %s got the error body %#v", code, re.Body)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	if template.Code != "" {
+		t.Errorf("the template was decoded into: %+v", template)
+	}
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedEncoding is returned for a response with a Content-Encoding
+// which WithEncodings doesn't enable, and when a body in an encoding no decoder
+// is registered for has to be decoded into a responseStruct.
+var ErrUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// EncodingError is the error of decoding a response body with its
+// Content-Encoding. ContentLength is that of the encoded body, -1 when unknown.
+type EncodingError struct {
+	Encoding      string
+	ContentLength int64
+	Err           error
+}
+
+func (e *EncodingError) Error() string {
+	msg := fmt.Sprintf("decoding %s response body", e.Encoding)
+	if e.ContentLength >= 0 {
+		msg += fmt.Sprintf(" of %d bytes", e.ContentLength)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *EncodingError) Unwrap() error {
+	return e.Err
+}
+
+// ContentDecoder decodes a response body sent with a Content-Encoding.
+type ContentDecoder func(r io.Reader) (io.Reader, error)
+
+var (
+	encodingsMu sync.RWMutex
+
+	encodings = map[string]ContentDecoder{
+		"gzip":    newGzipReader,
+		"x-gzip":  newGzipReader,
+		"deflate": newDeflateReader,
+	}
+)
+
+// RegisterEncoding decodes responses with the Content-Encoding name using dec.
+// gzip and deflate are built in, brotli ("br") and zstd are registered when the
+// package is built with the brotli and zstd tags. Bodies in other encodings, br
+// and zstd included when built without their tag, are returned as received.
+func RegisterEncoding(name string, dec ContentDecoder) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	encodings[strings.ToLower(name)] = dec
+}
+
+func encodingDecoder(name string) (ContentDecoder, bool) {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+
+	dec, ok := encodings[name]
+	return dec, ok
+}
+
+// WithRawEncoding returns compressed response bodies as received. By default a
+// Content-Encoding which net/http left in place, as it does with a transport
+// which has DisableCompression set or a caller set Accept-Encoding, is decoded
+// before the body is returned or decoded.
+func WithRawEncoding() Option {
+	return func(o *options) {
+		o.rawEncoding = true
+	}
+}
+
+// WithEncodings limits the Content-Encodings accepted to the registered ones
+// named, responses in others fail with ErrUnsupportedEncoding instead of being
+// returned as received.
+func WithEncodings(names ...string) Option {
+	enabled := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		enabled[strings.ToLower(strings.TrimSpace(name))] = struct{}{}
+	}
+	return func(o *options) {
+		o.encodings = enabled
+	}
+}
+
+// WithAcceptEncoding sends Accept-Encoding with the encodings, e.g. "gzip", "br",
+// unless the caller set the header. The response is decoded by this package
+// instead of net/http.
+func WithAcceptEncoding(encodings ...string) Option {
+	return func(o *options) {
+		o.acceptEncoding = strings.Join(encodings, ", ")
+	}
+}
+
+func (o *options) applyAcceptEncoding(request *http.Request) {
+	if o.acceptEncoding != "" && request.Header.Get("Accept-Encoding") == "" {
+		request.Header.Set("Accept-Encoding", o.acceptEncoding)
+	}
+}
+
+// decompress wraps the body of a compressed response in its decoder and drops
+// the Content-Encoding and Content-Length headers, as net/http does. The
+// decoded stream is what WithMaxResponseBytes limits. A body in an encoding
+// without decoder is returned as received, see ResponseInfo.ContentEncoding.
+func (o *options) decompress(response *http.Response) (io.Reader, error) {
+	o.info.ContentEncoding = ""
+	if response.Uncompressed {
+		return response.Body, nil
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return response.Body, nil
+	}
+
+	dec, ok := encodingDecoder(encoding)
+	if _, enabled := o.encodings[encoding]; o.encodings != nil && (!ok || !enabled) {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+	}
+	if o.rawEncoding || !ok {
+		o.info.ContentEncoding = encoding
+		return response.Body, nil
+	}
+
+	br := bufio.NewReader(response.Body)
+	if _, err := br.Peek(1); err == io.EOF {
+		// an empty body, as HEAD and 204 responses have
+		return br, nil
+	}
+
+	body, err := dec(br)
+	if err != nil {
+		return nil, &EncodingError{Encoding: encoding, ContentLength: response.ContentLength, Err: err}
+	}
+	body = &encodingReader{r: body, encoding: encoding, contentLength: response.ContentLength}
+
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+	return body, nil
+}
+
+// encodingReader wraps the errors of a decoder in EncodingError.
+type encodingReader struct {
+	r             io.Reader
+	encoding      string
+	contentLength int64
+}
+
+func (r *encodingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &EncodingError{Encoding: r.encoding, ContentLength: r.contentLength, Err: err}
+	}
+	return n, err
+}
+
+func newGzipReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// newDeflateReader reads "deflate" bodies, which are zlib streams but are sent
+// as raw deflate by some servers.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
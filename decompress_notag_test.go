@@ -0,0 +1,40 @@
+//go:build !brotli && !zstd
+// +build !brotli,!zstd
+
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUntaggedEncodingsAreReturnedAsReceived(t *testing.T) {
+	for _, encoding := range []string{"br", "zstd"} {
+		var acceptEncoding string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			acceptEncoding = r.Header.Get("Accept-Encoding")
+			w.Header().Set("Content-Encoding", encoding)
+			w.Write([]byte("\x0b\x02\x80{}\x03"))
+		}))
+
+		var info ResponseInfo
+		_, body, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil,
+			WithAcceptEncoding("gzip", encoding), WithResponseInfo(&info))
+		if err != nil || string(body) != "\x0b\x02\x80{}\x03" || info.ContentEncoding != encoding {
+			t.Errorf("%s: got %q, %v with ContentEncoding %q", encoding, body, err, info.ContentEncoding)
+		}
+		if acceptEncoding != "gzip, "+encoding {
+			t.Errorf("%s: sent Accept-Encoding %q", encoding, acceptEncoding)
+		}
+
+		var out struct{}
+		_, _, err = HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, &out)
+		if !errors.Is(err, ErrUnsupportedEncoding) || !strings.Contains(err.Error(), `"`+encoding+`"`) {
+			t.Errorf("%s: decoding returned %v, want an error naming the encoding", encoding, err)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func encodedServer(encoding string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write([]byte("\x1f\x9d\x90encoded"))
+	}))
+}
+
+func TestUnknownEncodingIsReturnedAsReceived(t *testing.T) {
+	srv := encodedServer("compress")
+	defer srv.Close()
+
+	var info ResponseInfo
+	_, body, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, WithResponseInfo(&info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "\x1f\x9d\x90encoded" || info.ContentEncoding != "compress" {
+		t.Errorf("got %q with ContentEncoding %q", body, info.ContentEncoding)
+	}
+
+	var out map[string]interface{}
+	_, body, err = HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, &out)
+	if !errors.Is(err, ErrUnsupportedEncoding) || !strings.Contains(err.Error(), `"compress"`) {
+		t.Errorf("decoding returned %v, want an error naming the encoding", err)
+	}
+	if len(body) == 0 {
+		t.Error("the body was dropped")
+	}
+
+	_, _, err = HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, WithEncodings("gzip"))
+	if !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("WithEncodings returned %v, want ErrUnsupportedEncoding", err)
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WithContentMD5 sets the Content-MD5 header of requests with a body.
+func WithContentMD5() Option {
+	return func(o *options) {
+		o.contentMD5 = true
+	}
+}
+
+// WithDigest sets an RFC 3230 Digest header of requests with a body, for the
+// algorithms "sha-256" (the default) and "sha-512".
+func WithDigest(algorithms ...string) Option {
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha-256"}
+	}
+	return func(o *options) {
+		o.digestAlgorithms = algorithms
+	}
+}
+
+// bodyDigests hashes the request body as sent, once for all attempts. A
+// streamed body is read an extra time for that, so it must be rewindable.
+func (o *options) bodyDigests(data []byte) error {
+	if !o.contentMD5 && len(o.digestAlgorithms) == 0 {
+		return nil
+	}
+
+	hashes := make(map[string]hash.Hash)
+	writers := make([]io.Writer, 0, len(o.digestAlgorithms)+1)
+	if o.contentMD5 {
+		hashes["Content-MD5"] = md5.New()
+		writers = append(writers, hashes["Content-MD5"])
+	}
+	for _, algorithm := range o.digestAlgorithms {
+		var h hash.Hash
+		switch strings.ToLower(algorithm) {
+		case "sha-256":
+			h = sha256.New()
+		case "sha-512":
+			h = sha512.New()
+		default:
+			return fmt.Errorf("unsupported Digest algorithm %q", algorithm)
+		}
+		hashes[strings.ToLower(algorithm)] = h
+		writers = append(writers, h)
+	}
+
+	if err := o.hashBody(data, io.MultiWriter(writers...)); err != nil {
+		return err
+	}
+
+	o.digestHeaders = make(map[string]string)
+	var digests []string
+	for _, algorithm := range o.digestAlgorithms {
+		sum := hashes[strings.ToLower(algorithm)].Sum(nil)
+		digests = append(digests, strings.ToLower(algorithm)+"="+base64.StdEncoding.EncodeToString(sum))
+	}
+	if len(digests) != 0 {
+		o.digestHeaders["Digest"] = strings.Join(digests, ",")
+	}
+	if o.contentMD5 {
+		o.digestHeaders["Content-MD5"] = base64.StdEncoding.EncodeToString(hashes["Content-MD5"].Sum(nil))
+	}
+	return nil
+}
+
+func (o *options) hashBody(data []byte, w io.Writer) error {
+	switch {
+	case o.stream != nil:
+		if !o.stream.replayable {
+			return fmt.Errorf("%w: Content-MD5 and Digest need the body before it is sent", ErrBodyNotRewindable)
+		}
+		body, err := o.stream.open()
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		_, err = io.Copy(w, body)
+		return err
+	case o.compressedBody != nil:
+		_, err := w.Write(o.compressedBody)
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// applyDigests sets the headers computed by bodyDigests.
+func (o *options) applyDigests(request *http.Request) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return
+	}
+	for key, value := range o.digestHeaders {
+		request.Header.Set(key, value)
+	}
+}
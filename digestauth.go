@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WithDigestAuth answers Digest challenges (RFC 7616) with user and password.
+// A 401 carrying a challenge makes the request go again once with the
+// computed Authorization header. The challenge is then kept per host by the
+// Client, so later requests are authorized up front until the server rejects
+// the nonce, e.g. with stale=true. The MD5 and SHA-256 algorithms, their -sess
+// variants and qop=auth are supported. The token argument of the Auth
+// wrappers, WithBasicAuth and WithBearerToken take precedence.
+func WithDigestAuth(user, password string) Option {
+	return func(o *options) {
+		o.digest = &[2]string{user, password}
+	}
+}
+
+// digestChallenge is a challenge of a server and the count of the nonce.
+type digestChallenge struct {
+	mu sync.Mutex
+
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	nc        uint32
+}
+
+// applyDigest authorizes the request with the challenge cached for its host.
+func (o *options) applyDigest(request *http.Request) {
+	if o.digest == nil || request.Header.Get("Authorization") != "" {
+		return
+	}
+
+	c := o.client
+	c.digestsMu.Lock()
+	challenge := c.digests[request.URL.Host]
+	c.digestsMu.Unlock()
+
+	if challenge != nil {
+		request.Header.Set("Authorization", challenge.authorization(o.digest[0], o.digest[1], request.Method, request.URL.RequestURI()))
+	}
+}
+
+// retryWithDigest reports whether a 401 reply carries a Digest challenge the
+// request should be sent again with. The challenge replaces the cached one.
+func (o *options) retryWithDigest(urlString, token string, status int) bool {
+	if status != http.StatusUnauthorized || o.digest == nil || token != "" || o.authorization != "" {
+		return false
+	}
+	if o.stream != nil && !o.stream.replayable {
+		return false
+	}
+
+	challenge := parseDigestChallenge(o.info.Header.Values("WWW-Authenticate"))
+	if challenge == nil {
+		return false
+	}
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return false
+	}
+
+	c := o.client
+	c.digestsMu.Lock()
+	defer c.digestsMu.Unlock()
+
+	if _, ok := c.digests[u.Host]; ok || len(c.digests) < maxCachedClients {
+		c.digests[u.Host] = challenge
+	}
+	return true
+}
+
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+// parseDigestChallenge returns the supported Digest challenge of the
+// WWW-Authenticate values, preferring SHA-256, or nil.
+func parseDigestChallenge(values []string) *digestChallenge {
+	var best *digestChallenge
+	for _, value := range values {
+		for _, params := range authChallenges(value, "digest") {
+			challenge := &digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: params["algorithm"],
+			}
+			if challenge.nonce == "" || digestHash(challenge.algorithm) == nil {
+				continue
+			}
+
+			if qop, ok := params["qop"]; ok {
+				for _, q := range strings.Split(qop, ",") {
+					if strings.TrimSpace(q) == "auth" {
+						challenge.qop = "auth"
+					}
+				}
+				if challenge.qop == "" {
+					continue
+				}
+			}
+
+			if best == nil || strings.HasPrefix(strings.ToUpper(challenge.algorithm), "SHA-256") {
+				best = challenge
+			}
+		}
+	}
+	return best
+}
+
+// authChallenges returns the parameters of each challenge of the scheme in a
+// WWW-Authenticate value, which may list several challenges.
+func authChallenges(value, scheme string) []map[string]string {
+	var challenges []map[string]string
+	var current map[string]string
+
+	for value = strings.TrimSpace(value); value != ""; value = strings.TrimLeft(value, ", ") {
+		end := strings.IndexAny(value, "=, ")
+		if end < 0 {
+			end = len(value)
+		}
+		name := value[:end]
+		value = strings.TrimLeft(value[end:], " ")
+
+		if !strings.HasPrefix(value, "=") {
+			// a token without a value starts a new challenge
+			current = nil
+			if strings.EqualFold(name, scheme) {
+				current = make(map[string]string)
+				challenges = append(challenges, current)
+			}
+			continue
+		}
+
+		var param string
+		param, value = authParamValue(strings.TrimLeft(value[1:], " "))
+		if current != nil {
+			current[strings.ToLower(name)] = param
+		}
+	}
+	return challenges
+}
+
+// authParamValue reads a token or quoted string from the start of s.
+func authParamValue(s string) (value, rest string) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexAny(s, ", ")
+		if end < 0 {
+			return s, ""
+		}
+		return s[:end], s[end:]
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// quotedString quotes s as an RFC 7230 quoted-string, the inverse of
+// authParamValue: only double quotes and backslashes are escaped, other bytes
+// are sent as they are. Control characters other than tab can't be quoted and
+// are dropped.
+func quotedString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"', c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' && c != '\t', c == 0x7f:
+			// not representable
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// authorization computes the Authorization header for the next use of the nonce.
+func (d *digestChallenge) authorization(user, password, method, uri string) string {
+	d.mu.Lock()
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+	d.mu.Unlock()
+
+	newHash := digestHash(d.algorithm)
+	h := func(parts ...string) string {
+		sum := newHash()
+		sum.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	cnonce := hex.EncodeToString(b)
+
+	ha1 := h(user, d.realm, password)
+	if strings.HasSuffix(strings.ToLower(d.algorithm), "-sess") {
+		ha1 = h(ha1, d.nonce, cnonce)
+	}
+	ha2 := h(method, uri)
+
+	var header strings.Builder
+	fmt.Fprintf(&header, "Digest username=%s, realm=%s, nonce=%s, uri=%s",
+		quotedString(user), quotedString(d.realm), quotedString(d.nonce), quotedString(uri))
+	if d.algorithm != "" {
+		fmt.Fprintf(&header, `, algorithm=%s`, d.algorithm)
+	}
+	if d.qop == "" {
+		fmt.Fprintf(&header, `, response="%s"`, h(ha1, d.nonce, ha2))
+	} else {
+		fmt.Fprintf(&header, `, response="%s", qop=%s, nc=%s, cnonce="%s"`, h(ha1, d.nonce, nc, cnonce, d.qop, ha2), d.qop, nc, cnonce)
+	}
+	if d.opaque != "" {
+		fmt.Fprintf(&header, ", opaque=%s", quotedString(d.opaque))
+	}
+	return header.String()
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQuotedString(t *testing.T) {
+	tests := []struct{ in, quoted, parsed string }{
+		{`plain`, `"plain"`, `plain`},
+		{`o"brien\x`, `"o\"brien\\x"`, `o"brien\x`},
+		{"José", `"José"`, "José"},
+		{"caf\xe9", "\"caf\xe9\"", "caf\xe9"},
+		{"tab\there", "\"tab\there\"", "tab\there"},
+		{"new\nline", `"newline"`, "newline"},
+	}
+	for _, tt := range tests {
+		quoted := quotedString(tt.in)
+		if quoted != tt.quoted {
+			t.Errorf("quotedString(%q) = %s, want %s", tt.in, quoted, tt.quoted)
+		}
+		if parsed, rest := authParamValue(quoted + ", next"); parsed != tt.parsed || rest != ", next" {
+			t.Errorf("%s parsed as %q, rest %q", quoted, parsed, rest)
+		}
+	}
+}
+
+// digestServer answers with SHA-256 Digest challenges for nonce until
+// requests carry a valid response for user and password.
+func digestServer(realm, user, password string, nonce *string, hits, challenges *int) *httptest.Server {
+	h := func(parts ...string) string {
+		sum := sha256.Sum256([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(sum[:])
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		stale := false
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Digest ") {
+			p := authChallenges(auth, "digest")[0]
+			ha1 := h(p["username"], p["realm"], password)
+			want := h(ha1, p["nonce"], p["nc"], p["cnonce"], p["qop"], h(r.Method, p["uri"]))
+			if p["username"] == user && p["realm"] == realm && p["response"] == want {
+				if p["nonce"] == *nonce {
+					return
+				}
+				stale = true
+			}
+		}
+		*challenges++
+		w.Header().Add("WWW-Authenticate", `Basic realm="basic"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf("Digest realm=%s, qop=\"auth\", algorithm=SHA-256, nonce=%s, stale=%v",
+			quotedString(realm), quotedString(*nonce), stale))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+}
+
+func TestDigestAuth(t *testing.T) {
+	nonce := "n1"
+	var hits, challenges int
+	srv := digestServer(`the "realm"`, `o"brien\x`, "secret", &nonce, &hits, &challenges)
+	defer srv.Close()
+
+	client := NewClient(WithDigestAuth(`o"brien\x`, "secret"))
+	status, _, err := HttpReqJSON("GET", srv.URL+"/a?b=1", nil, nil, nil, nil, 5, nil, WithClient(client))
+	if err != nil || status != http.StatusOK {
+		t.Fatal(status, err)
+	}
+	if hits != 2 {
+		t.Errorf("%d requests, want the challenge and its answer", hits)
+	}
+
+	// The challenge is kept for the host.
+	if _, _, err = HttpReqJSON("GET", srv.URL+"/a", nil, nil, nil, nil, 5, nil, WithClient(client)); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 3 {
+		t.Errorf("%d requests, want the cached challenge used", hits)
+	}
+
+	// A stale nonce is challenged again.
+	nonce = "n2"
+	if _, _, err = HttpReqJSON("GET", srv.URL+"/a", nil, nil, nil, nil, 5, nil, WithClient(client)); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 5 || challenges != 2 {
+		t.Errorf("%d requests and %d challenges, want 5 and 2", hits, challenges)
+	}
+
+	status, _, _ = HttpReqJSON("GET", srv.URL+"/a", nil, nil, nil, nil, 5, nil, WithDigestAuth(`o"brien\x`, "wrong"))
+	if status != http.StatusUnauthorized {
+		t.Errorf("wrong password got %d", status)
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ContentDisposition is a parsed Content-Disposition header.
+type ContentDisposition struct {
+	// Type is "attachment", "inline" or "form-data", lower cased.
+	Type string
+	// FileName comes from filename*, decoded, else from filename. It is
+	// passed on as sent, see ResponseInfo.FileName for a safe one.
+	FileName string
+	Params   map[string]string
+}
+
+var (
+	extFileNameParam = regexp.MustCompile(`(?i);\s*filename\*\s*=\s*([^;]*)`)
+	fileNameParam    = regexp.MustCompile(`(?i);\s*filename\s*=\s*("(?:[^"\\]|\\.)*"|[^;]*)`)
+)
+
+// ParseContentDisposition parses a Content-Disposition header. Parameters
+// which are malformed, such as an unquoted filename with spaces, are read
+// leniently instead of failing. filename* is decoded from any charset the
+// package knows, not only UTF-8.
+func ParseContentDisposition(value string) ContentDisposition {
+	dispositionType, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		dispositionType = strings.ToLower(strings.TrimSpace(strings.SplitN(value, ";", 2)[0]))
+		params = map[string]string{}
+		if m := fileNameParam.FindStringSubmatch(value); m != nil {
+			params["filename"] = unquoteParam(m[1])
+		}
+	}
+
+	d := ContentDisposition{Type: dispositionType, FileName: params["filename"], Params: params}
+	// mime only decodes filename* in UTF-8 and US-ASCII
+	if m := extFileNameParam.FindStringSubmatch(value); m != nil {
+		if name, ok := decodeExtValue(unquoteParam(m[1])); ok {
+			d.FileName = name
+			params["filename"] = name
+		}
+	}
+	return d
+}
+
+// decodeExtValue decodes an RFC 5987 charset'language'percent-encoded value.
+func decodeExtValue(value string) (string, bool) {
+	parts := strings.SplitN(value, "'", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+
+	raw, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", false
+	}
+	decoded, err := decodeCharset(parts[0], []byte(raw))
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+func unquoteParam(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+
+	var b strings.Builder
+	value = value[1 : len(value)-1]
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// responseFileName is the name suggested by Content-Disposition, else the last
+// segment of the URL path, made safe for a local file. It is empty when there
+// is none.
+func responseFileName(response *http.Response) string {
+	if value := response.Header.Get("Content-Disposition"); value != "" {
+		if name := safeFileName(ParseContentDisposition(value).FileName); name != "" {
+			return name
+		}
+	}
+	if response.Request == nil || response.Request.URL == nil {
+		return ""
+	}
+	return safeFileName(path.Base(response.Request.URL.Path))
+}
+
+// safeFileName keeps the last element of name, without control characters, so
+// that it can't leave the directory it is joined to.
+func safeFileName(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	name = strings.TrimSpace(name)
+	if strings.Trim(name, ".") == "" {
+		return ""
+	}
+	return name
+}
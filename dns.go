@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fallbackDelay is how long the addresses of one family are tried before those
+// of the other are dialed too, as RFC 8305 suggests.
+const fallbackDelay = 300 * time.Millisecond
+
+// Resolver looks up the addresses of a host, as net.Resolver does.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// TTLResolver is a Resolver which also reports how long its answer may be
+// cached, the lowest TTL of the records.
+type TTLResolver interface {
+	Resolver
+	LookupHostTTL(ctx context.Context, host string) (addrs []string, ttl time.Duration, err error)
+}
+
+// DNSCache caches the addresses a Resolver returns for a host. Successful
+// lookups are kept for the TTL of the records when the resolver is a
+// TTLResolver, for at most ttl, and for ttl otherwise. Hosts which don't exist
+// are kept for the negative TTL. A lookup failing after the TTL ran out falls
+// back to the expired addresses for the stale window.
+type DNSCache struct {
+	resolver    Resolver
+	ttl         time.Duration
+	negativeTTL time.Duration
+	stale       time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	addrs      []string
+	err        error
+	expires    time.Time
+	generation uint64
+}
+
+// dnsGeneration is bumped by FlushDNS, entries stored before are ignored.
+var dnsGeneration uint64
+
+// NewDNSCache returns a cache in front of resolver, net.DefaultResolver when nil.
+func NewDNSCache(resolver Resolver, ttl, negativeTTL, stale time.Duration) *DNSCache {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	return &DNSCache{
+		resolver:    resolver,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		stale:       stale,
+		now:         time.Now,
+		entries:     make(map[string]*dnsEntry),
+	}
+}
+
+// WithDNSCache resolves the hosts dialed through cache. Like WithRateLimit it
+// should be passed to NewClient.
+func WithDNSCache(cache *DNSCache) Option {
+	return func(o *options) {
+		o.dnsCache = cache
+	}
+}
+
+// FlushDNS empties every DNSCache.
+func FlushDNS() {
+	atomic.AddUint64(&dnsGeneration, 1)
+}
+
+// Flush empties the cache.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*dnsEntry)
+}
+
+// LookupHost returns the cached addresses of host, looking them up when needed.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	now := c.now()
+	generation := atomic.LoadUint64(&dnsGeneration)
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+
+	if ok && entry.generation != generation {
+		ok = false
+	}
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, entry.err
+	}
+
+	addrs, ttl, err := c.lookup(ctx, host)
+	if err == nil {
+		c.store(host, &dnsEntry{addrs: addrs, expires: now.Add(ttl), generation: generation})
+		return addrs, nil
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		c.store(host, &dnsEntry{err: err, expires: now.Add(c.negativeTTL), generation: generation})
+		return nil, err
+	}
+
+	if ok && entry.err == nil && now.Before(entry.expires.Add(c.stale)) {
+		return entry.addrs, nil
+	}
+	return nil, err
+}
+
+// lookup resolves host, with the TTL its addresses may be cached for.
+func (c *DNSCache) lookup(ctx context.Context, host string) ([]string, time.Duration, error) {
+	resolver, ok := c.resolver.(TTLResolver)
+	if !ok {
+		addrs, err := c.resolver.LookupHost(ctx, host)
+		return addrs, c.ttl, err
+	}
+
+	addrs, ttl, err := resolver.LookupHostTTL(ctx, host)
+	if ttl > c.ttl {
+		ttl = c.ttl
+	}
+	return addrs, ttl, err
+}
+
+func (c *DNSCache) store(host string, entry *dnsEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[host] = entry
+}
+
+// resolvingDial wraps dial to resolve the host with resolver and connect to its
+// addresses in the order pref gives them, the first which accepts wins. When
+// the first family doesn't connect within fallbackDelay the other one is tried
+// alongside it.
+func resolvingDial(resolver Resolver, pref IPPreference, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+
+		addrs := []string{host}
+		if net.ParseIP(host) == nil {
+			if addrs, err = resolver.LookupHost(ctx, host); err != nil {
+				return nil, err
+			}
+		}
+
+		if addrs = pref.order(addrs); len(addrs) == 0 {
+			return nil, &net.AddrError{Err: "no address of the preferred family", Addr: host}
+		}
+
+		dialSerial := func(ctx context.Context, ips []string) (conn net.Conn, err error) {
+			for _, ip := range ips {
+				if conn, err = dial(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+					return conn, nil
+				}
+			}
+			return nil, err
+		}
+
+		primaries, fallbacks := splitFamilies(addrs)
+		if len(fallbacks) == 0 {
+			return dialSerial(ctx, primaries)
+		}
+		return dialParallel(ctx, primaries, fallbacks, dialSerial)
+	}
+}
+
+// splitFamilies splits addrs into those of the family of the first one and the
+// others.
+func splitFamilies(addrs []string) (primaries, fallbacks []string) {
+	isV4 := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		return ip != nil && ip.To4() != nil
+	}
+
+	first := isV4(addrs[0])
+	for _, addr := range addrs {
+		if isV4(addr) == first {
+			primaries = append(primaries, addr)
+		} else {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+	return primaries, fallbacks
+}
+
+// dialParallel dials the primaries, and the fallbacks once the primaries failed
+// or fallbackDelay passed, returning the first connection made.
+func dialParallel(ctx context.Context, primaries, fallbacks []string, dialSerial func(context.Context, []string) (net.Conn, error)) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	start := func(ips []string) {
+		go func() {
+			conn, err := dialSerial(ctx, ips)
+			results <- result{conn: conn, err: err}
+		}()
+	}
+
+	start(primaries)
+	pending, fallbackStarted := 1, false
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				start(fallbacks)
+				pending, fallbackStarted = pending+1, true
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				if pending > 0 {
+					// the other dial is canceled, but may have connected already
+					go func() {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}()
+				}
+				return r.conn, nil
+			}
+
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if !fallbackStarted {
+				start(fallbacks)
+				pending, fallbackStarted = pending+1, true
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
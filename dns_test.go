@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	calls int
+	addrs map[string][]string
+	ttl   time.Duration
+	fail  bool
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := f.LookupHostTTL(ctx, host)
+	return addrs, err
+}
+
+func (f *fakeResolver) LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.fail {
+		return nil, 0, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+	}
+	if addrs, ok := f.addrs[host]; ok {
+		return addrs, f.ttl, nil
+	}
+	return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// plainResolver hides LookupHostTTL.
+type plainResolver struct {
+	fake *fakeResolver
+}
+
+func (r plainResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return r.fake.LookupHost(ctx, host)
+}
+
+func TestDNSCache(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeResolver{addrs: map[string][]string{"svc.test": {"127.0.0.1"}}}
+	c := NewDNSCache(plainResolver{fake}, time.Minute, 10*time.Second, time.Hour)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.LookupHost(ctx, "svc.test")
+	c.LookupHost(ctx, "svc.test")
+	if fake.calls != 1 {
+		t.Errorf("resolved %d times within the TTL", fake.calls)
+	}
+
+	// negative results are cached for the negative TTL
+	c.LookupHost(ctx, "nx.test")
+	if _, err := c.LookupHost(ctx, "nx.test"); err == nil || fake.calls != 2 {
+		t.Errorf("nx.test: %v after %d lookups", err, fake.calls)
+	}
+	now = now.Add(11 * time.Second)
+	if c.LookupHost(ctx, "nx.test"); fake.calls != 3 {
+		t.Errorf("the negative result outlived its TTL")
+	}
+
+	// expired addresses are served while the resolver fails
+	now = now.Add(2 * time.Minute)
+	fake.fail = true
+	if addrs, err := c.LookupHost(ctx, "svc.test"); err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+		t.Errorf("stale lookup = %v, %v", addrs, err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := c.LookupHost(ctx, "svc.test"); err == nil {
+		t.Error("served addresses beyond the stale window")
+	}
+}
+
+func TestDNSCacheRespectsRecordTTL(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeResolver{addrs: map[string][]string{"svc.test": {"127.0.0.1"}}, ttl: 5 * time.Second}
+	c := NewDNSCache(fake, time.Minute, 0, 0)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.LookupHost(ctx, "svc.test")
+	now = now.Add(4 * time.Second)
+	if c.LookupHost(ctx, "svc.test"); fake.calls != 1 {
+		t.Errorf("resolved again within the record TTL")
+	}
+	now = now.Add(2 * time.Second)
+	if c.LookupHost(ctx, "svc.test"); fake.calls != 2 {
+		t.Errorf("the entry outlived the record TTL")
+	}
+
+	// the configured TTL caps the one of the records
+	fake.ttl = time.Hour
+	now = now.Add(time.Hour)
+	c.LookupHost(ctx, "svc.test")
+	now = now.Add(2 * time.Minute)
+	if c.LookupHost(ctx, "svc.test"); fake.calls != 4 {
+		t.Errorf("the entry outlived the configured TTL")
+	}
+}
+
+func TestFlushDNS(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeResolver{addrs: map[string][]string{"svc.test": {"127.0.0.1"}}}
+	c := NewDNSCache(fake, time.Minute, time.Minute, time.Hour)
+
+	c.LookupHost(ctx, "svc.test")
+	FlushDNS()
+	fake.fail = true
+	if _, err := c.LookupHost(ctx, "svc.test"); err == nil || fake.calls != 2 {
+		t.Errorf("flushed entry served: %v after %d lookups", err, fake.calls)
+	}
+}
+
+func TestDNSCacheDial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer srv.Close()
+
+	fake := &fakeResolver{addrs: map[string][]string{"svc.test": {"127.0.0.1"}}}
+	c := NewDNSCache(fake, time.Minute, time.Minute, 0)
+	port := srv.URL[strings.LastIndex(srv.URL, ":"):]
+
+	_, body, err := HttpReqJSON("GET", "http://svc.test"+port, nil, nil, nil, nil, 5, nil, WithDNSCache(c))
+	if err != nil || string(body) != "svc.test"+port {
+		t.Errorf("got %q, %v", body, err)
+	}
+
+	_, _, err = HttpReqJSON("GET", "http://nx.test"+port, nil, nil, nil, nil, 5, nil, WithDNSCache(c))
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Errorf("got %v, want a DNSError", err)
+	}
+}
+
+func TestResolvingDialFallsBack(t *testing.T) {
+	fake := &fakeResolver{addrs: map[string][]string{"svc.test": {"2001:db8::1", "192.0.2.1"}}}
+
+	var mu sync.Mutex
+	var dialed []string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		mu.Unlock()
+
+		if strings.HasPrefix(addr, "[2001:db8::1]") {
+			// an unreachable family hangs until the dial is given up
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	start := time.Now()
+	conn, err := resolvingDial(fake, IPAny, dial)(context.Background(), "tcp", "svc.test:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if elapsed := time.Since(start); elapsed < fallbackDelay || elapsed > 5*fallbackDelay {
+		t.Errorf("connected after %v, want about %v", elapsed, fallbackDelay)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dialed) != 2 || dialed[1] != "192.0.2.1:80" {
+		t.Errorf("dialed %v", dialed)
+	}
+}
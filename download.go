@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// downloadErrorBodyLimit bounds the body read for the ResourceError of a download.
+const downloadErrorBodyLimit = 64 << 10
+
+// WriteError is the error returned by the destination of a download, or by the
+// callback of a streaming decoder, as opposed to one reading the response. Find
+// it with errors.As.
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return "writing download: " + e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+type download struct {
+	dst     io.Writer
+	written int64
+	// begin, when set, picks dst once the response headers are known.
+	begin func(response *http.Response) (io.Writer, error)
+	// consume, when set, reads the body itself instead of copying it to dst.
+	// Its errors which come neither from the body, from decoding it nor from
+	// its size are returned as WriteError.
+	consume func(response *http.Response, body io.Reader) error
+}
+
+// Write counts the bytes written to dst and wraps its errors in WriteError.
+func (d *download) Write(p []byte) (int, error) {
+	n, err := d.dst.Write(p)
+	d.written += int64(n)
+	if err != nil {
+		return n, &WriteError{Err: err}
+	}
+	return n, nil
+}
+
+func (d *download) copy(response *http.Response, body io.Reader) error {
+	if d.consume != nil {
+		r := &consumedBody{r: body, d: d}
+		if err := d.consume(response, r); err != nil {
+			var decodeErr *DecodeError
+			if r.err != nil || errors.As(err, &decodeErr) || errors.Is(err, ErrResponseTooLarge) {
+				return err
+			}
+			return &WriteError{Err: err}
+		}
+		return nil
+	}
+
+	if d.begin != nil {
+		dst, err := d.begin(response)
+		if err != nil {
+			return err
+		}
+		d.dst = dst
+	}
+
+	// download only implements Write, so io.Copy can't bypass the counting
+	_, err := io.Copy(d, body)
+	return err
+}
+
+// consumedBody counts the bytes read by consume and keeps the read error.
+type consumedBody struct {
+	r   io.Reader
+	d   *download
+	err error
+}
+
+func (b *consumedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.d.written += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// HttpDownload copies the response body into dst without buffering it. Statuses
+// which are not successful return a ResourceError holding the start of the body.
+// Once bytes were written the request is not retried.
+func HttpDownload(method, urlString string, dst io.Writer, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, bytesWritten int64, err error) {
+	return httpDownload(method, urlString, "", nil, &download{dst: dst}, headers, cookie, transport, timeout, opts)
+}
+
+// HttpAuthDownload is HttpDownload with a token sent in the Authorization header.
+func HttpAuthDownload(method, urlString, token string, dst io.Writer, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, bytesWritten int64, err error) {
+	return httpDownload(method, urlString, token, nil, &download{dst: dst}, headers, cookie, transport, timeout, opts)
+}
+
+func httpDownload(method, urlString, token string, body []byte, d *download, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts []Option) (httpStatus int, bytesWritten int64, err error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
+
+	o := newOptions(opts)
+	o.download = d
+
+	httpStatus, _, err = sendHttpReq(o, method, urlString, token, body, headers, cookie, transport, timeout)
+	return httpStatus, o.download.written, err
+}
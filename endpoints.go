@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// EndpointResult is the outcome of a request sent to one of the base URLs.
+type EndpointResult struct {
+	URL    string
+	Status int
+	Err    error `json:"-"`
+}
+
+var defaultFailoverStatus = map[int]struct{}{502: {}, 503: {}, 504: {}}
+
+// WithBaseURLs sends requests with a relative URL ("/v1/items"), or one starting
+// with one of the base URLs, to the first base URL, moving on to the next one
+// on connection errors, timeouts and WithFailoverStatus codes. The URL used is
+// reported in ResponseInfo.Endpoint.
+func WithBaseURLs(urls ...string) Option {
+	return func(o *options) {
+		o.baseURLs = urls
+	}
+}
+
+// WithFailoverStatus replaces the statuses which move a request to the next
+// base URL, 502, 503 and 504 by default.
+func WithFailoverStatus(codes ...int) Option {
+	return func(o *options) {
+		o.failoverStatus = make(map[int]struct{}, len(codes))
+		for _, code := range codes {
+			o.failoverStatus[code] = struct{}{}
+		}
+	}
+}
+
+// endpoint is a URL to send the request to, with the base URL it was built from.
+type endpoint struct {
+	base string
+	url  string
+}
+
+// resolveEndpoints returns the URLs to try for urlString, in order.
+func (o *options) resolveEndpoints(urlString string) []endpoint {
+	if len(o.baseURLs) == 0 {
+		return []endpoint{{url: urlString}}
+	}
+
+	path := urlString
+	if strings.Contains(urlString, "://") {
+		found := false
+		for _, base := range o.baseURLs {
+			if strings.HasPrefix(urlString, base) {
+				path, found = urlString[len(base):], true
+				break
+			}
+		}
+		if !found {
+			return []endpoint{{url: urlString}}
+		}
+	}
+
+	endpoints := make([]endpoint, 0, len(o.baseURLs))
+	for _, base := range o.baseURLs {
+		endpoints = append(endpoints, endpoint{base: base, url: joinURL(base, path)})
+	}
+
+	if o.balancer != nil {
+		o.balancer.order(endpoints)
+	}
+	return endpoints
+}
+
+func joinURL(base, path string) string {
+	if path == "" {
+		return base
+	}
+	if path[0] == '?' {
+		return base + path
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+func (o *options) shouldFailover(status int, err error) bool {
+	if o.context().Err() != nil {
+		return false
+	}
+
+	if status == 0 {
+		var re *ResourceError
+		return errors.As(err, &re) && re.HTTPCode == 0
+	}
+
+	codes := o.failoverStatus
+	if codes == nil {
+		codes = defaultFailoverStatus
+	}
+	_, ok := codes[status]
+	return ok
+}
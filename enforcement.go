@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EnforcementMode decides what happens when a request breaks a guard rule.
+type EnforcementMode int32
+
+const (
+	// Enforce rejects the request with an error.
+	Enforce EnforcementMode = iota
+	// WarnOnly lets the request through and records a Violation.
+	WarnOnly
+	// Disabled skips the rule completely.
+	Disabled
+)
+
+// Rule names a guard checked before or while a request is sent.
+type Rule string
+
+const (
+	RuleHTTPSRequired Rule = "https_required"
+	RuleHostAllowlist Rule = "host_allowlist"
+)
+
+// Violation is an aggregated record of a rule broken at a call site.
+type Violation struct {
+	Rule Rule
+	// Value is what broke the rule, redacted like logged requests.
+	Value    string
+	CallSite string
+	Count    int
+	First    time.Time
+	Last     time.Time
+}
+
+type violationKey struct {
+	rule     Rule
+	callSite string
+}
+
+var globalMode int32 = int32(Enforce)
+
+// SetEnforcementMode sets the mode used by rules which have none set through options.
+func SetEnforcementMode(mode EnforcementMode) {
+	atomic.StoreInt32(&globalMode, int32(mode))
+}
+
+// WithEnforcementMode sets the mode for every rule of the request or Client.
+func WithEnforcementMode(mode EnforcementMode) Option {
+	return func(o *options) {
+		o.mode = &mode
+	}
+}
+
+// WithRuleMode sets the mode for a single rule, overriding WithEnforcementMode.
+func WithRuleMode(rule Rule, mode EnforcementMode) Option {
+	return func(o *options) {
+		if o.ruleModes == nil {
+			o.ruleModes = make(map[Rule]EnforcementMode)
+		}
+		o.ruleModes[rule] = mode
+	}
+}
+
+// WithViolationHook calls fn the first time a rule is broken at a call site
+// in WarnOnly mode. Repeats are only counted, see Client.Violations.
+func WithViolationHook(fn func(Violation)) Option {
+	return func(o *options) {
+		o.onViolation = fn
+	}
+}
+
+// WithRequireHTTPS rejects requests whose URL scheme is not https.
+func WithRequireHTTPS() Option {
+	return func(o *options) {
+		o.requireHTTPS = true
+	}
+}
+
+// WithAllowedHosts rejects requests to hosts outside the list.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(o *options) {
+		if o.allowedHosts == nil {
+			o.allowedHosts = make(map[string]struct{}, len(hosts))
+		}
+		for _, host := range hosts {
+			o.allowedHosts[strings.ToLower(host)] = struct{}{}
+		}
+	}
+}
+
+// Violations returns a snapshot of the violations recorded by the Client.
+func (c *Client) Violations() []Violation {
+	c.violationsMu.Lock()
+	defer c.violationsMu.Unlock()
+
+	out := make([]Violation, 0, len(c.violations))
+	for _, v := range c.violations {
+		out = append(out, *v)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rule != out[j].Rule {
+			return out[i].Rule < out[j].Rule
+		}
+		return out[i].CallSite < out[j].CallSite
+	})
+	return out
+}
+
+// Violations returns the violations recorded for requests sent without a Client.
+func Violations() []Violation {
+	return defaultClient.Violations()
+}
+
+func (o *options) ruleMode(rule Rule) EnforcementMode {
+	if mode, ok := o.ruleModes[rule]; ok {
+		return mode
+	}
+	if o.mode != nil {
+		return *o.mode
+	}
+	return EnforcementMode(atomic.LoadInt32(&globalMode))
+}
+
+// enforce returns err when rule is enforced and records a violation for value
+// when it is only warned about.
+func (o *options) enforce(rule Rule, value string, err error) error {
+	switch o.ruleMode(rule) {
+	case Disabled:
+		return nil
+	case WarnOnly:
+		o.client.recordViolation(rule, value, o.callSite, o.onViolation)
+		return nil
+	}
+	return err
+}
+
+// recordViolation counts a violation at site, the caller of the package when
+// empty.
+func (c *Client) recordViolation(rule Rule, value, site string, hook func(Violation)) {
+	if site == "" {
+		site = callSite()
+	}
+
+	now := time.Now()
+	key := violationKey{rule: rule, callSite: site}
+
+	c.violationsMu.Lock()
+	v, ok := c.violations[key]
+	if !ok {
+		v = &Violation{Rule: rule, Value: redactValue(value), CallSite: key.callSite, First: now}
+		c.violations[key] = v
+	}
+	v.Count++
+	v.Last = now
+	snapshot := *v
+	c.violationsMu.Unlock()
+
+	if !ok && hook != nil {
+		hook(snapshot)
+	}
+}
+
+// checkURL applies the URL guard rules.
+func (o *options) checkURL(u *url.URL) error {
+	if o.requireHTTPS && !strings.EqualFold(u.Scheme, "https") {
+		err := fmt.Errorf("https is required, got scheme %q", u.Scheme)
+		if err = o.enforce(RuleHTTPSRequired, u.Scheme, err); err != nil {
+			return err
+		}
+	}
+
+	if o.allowedHosts != nil {
+		if _, ok := o.allowedHosts[strings.ToLower(u.Hostname())]; !ok {
+			err := fmt.Errorf("host %q is not allowed", u.Hostname())
+			if err = o.enforce(RuleHostAllowlist, u.Hostname(), err); err != nil {
+				return err
+			}
+		}
+	}
+	return o.checkPrivate(u.Hostname())
+}
+
+var packagePrefix = func() string {
+	name := runtime.FuncForPC(reflect.ValueOf(newOptions).Pointer()).Name()
+	return name[:strings.LastIndex(name, ".")+1]
+}()
+
+// callSite returns file:line of the first caller outside the package. A request
+// sent by a goroutine started in the package, or with "go HttpReq(...)", has no
+// such caller: the outermost frame of the package is reported instead.
+func callSite() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	site := "unknown"
+	for {
+		frame, more := frames.Next()
+		switch {
+		case strings.HasPrefix(frame.Function, "runtime."):
+		case strings.HasPrefix(frame.Function, packagePrefix):
+			site = fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		default:
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return site
+		}
+	}
+}
+
+// withCallSite records violations at site, for requests sent by goroutines of
+// the package on behalf of its caller.
+func withCallSite(site string) Option {
+	return func(o *options) {
+		o.callSite = site
+	}
+}
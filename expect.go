@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"net/http"
+	"time"
+)
+
+// WithExpectContinue sends bodies with Expect: 100-continue, so they are only
+// transmitted once the server accepted the request headers. Without an interim
+// response the body is sent after timeout anyway. A 417 Expectation Failed
+// reply makes the request go again once without the header.
+func WithExpectContinue(timeout time.Duration) Option {
+	return func(o *options) {
+		o.expectContinue = timeout
+	}
+}
+
+// applyExpect asks the server to confirm before the body is sent.
+func (o *options) applyExpect(request *http.Request) {
+	if o.expectContinue <= 0 || o.expectFailed || request.Body == nil || request.Body == http.NoBody {
+		return
+	}
+	request.Header.Set("Expect", "100-continue")
+}
+
+// retryWithoutExpect reports whether a 417 reply should be followed by the same
+// request without Expect.
+func (o *options) retryWithoutExpect(status int) bool {
+	if status != http.StatusExpectationFailed || o.expectContinue <= 0 || o.expectFailed {
+		return false
+	}
+	if o.stream != nil && !o.stream.replayable {
+		return false
+	}
+	o.expectFailed = true
+	return true
+}
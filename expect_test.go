@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpectContinue417(t *testing.T) {
+	var expects []string
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expects = append(expects, r.Header.Get("Expect"))
+		if r.Header.Get("Expect") != "" {
+			w.Header().Set("Connection", "close")
+			w.WriteHeader(http.StatusExpectationFailed)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+	}))
+	defer srv.Close()
+
+	status, _, err := HttpReqJSON("PUT", srv.URL, []byte(`{"large":true}`), nil, nil, nil, 5, nil, WithExpectContinue(time.Second))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("got %d, %v", status, err)
+	}
+	if len(expects) != 2 || expects[0] != "100-continue" || expects[1] != "" {
+		t.Errorf("sent Expect %q", expects)
+	}
+	if received != `{"large":true}` {
+		t.Errorf("received %q", received)
+	}
+}
+
+func TestExpectContinueRejectedBodyIsNotSent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	type result struct {
+		expect string
+		extra  int
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- result{}
+			return
+		}
+		defer conn.Close()
+
+		var res result
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+			if strings.HasPrefix(strings.ToLower(line), "expect:") {
+				res.expect = strings.TrimSpace(line[len("expect:"):])
+			}
+		}
+
+		// a server rejecting the body closes the connection, else net/http
+		// sends the body to keep it usable
+		conn.Write([]byte("HTTP/1.1 401 Unauthorized\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		rest, _ := ioutil.ReadAll(r)
+		res.extra = len(rest)
+		done <- res
+	}()
+
+	body := []byte(strings.Repeat("x", 1<<16))
+	status, _, _ := HttpReqJSON("PUT", "http://"+ln.Addr().String(), body, nil, nil, nil, 5, nil, WithExpectContinue(5*time.Second))
+	if status != http.StatusUnauthorized {
+		t.Errorf("got status %d", status)
+	}
+
+	res := <-done
+	if res.expect != "100-continue" || res.extra != 0 {
+		t.Errorf("sent Expect %q and %d body bytes after the 401", res.expect, res.extra)
+	}
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Codec encodes and decodes the bodies of a format registered with RegisterFormat.
+type Codec struct {
+	// MediaTypes are the Content-Types of the format. The first one is sent
+	// with request bodies and as Accept, HttpReqAuto decodes all of them.
+	MediaTypes []string
+	// Suffix is a structured syntax suffix, such as "+yaml", which
+	// HttpReqAuto decodes too.
+	Suffix string
+
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[Format]Codec{}
+)
+
+// RegisterFormat makes format available to the wrappers and to HttpReqAuto.
+// JSON and XML are built in, YAML, MessagePack and protobuf are registered when
+// the package is built with the yaml, msgpack and protobuf tags.
+func RegisterFormat(format Format, codec Codec) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	formats[format] = codec
+}
+
+func formatCodec(format Format) (Codec, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	codec, ok := formats[format]
+	if !ok {
+		return codec, fmt.Errorf("format %q is not registered, see RegisterFormat", format)
+	}
+	return codec, nil
+}
+
+// registeredFormatFor maps a media type to a registered format.
+func registeredFormatFor(mediaType string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	for format, codec := range formats {
+		for _, t := range codec.MediaTypes {
+			if strings.EqualFold(t, mediaType) {
+				return format, true
+			}
+		}
+		if codec.Suffix != "" && strings.HasSuffix(mediaType, codec.Suffix) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// marshalBody encodes v in format: nil is no body and a []byte is sent as is.
+func marshalBody(format Format, v interface{}) ([]byte, string, error) {
+	codec, err := formatCodec(format)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var contentType string
+	if len(codec.MediaTypes) != 0 {
+		contentType = codec.MediaTypes[0]
+	}
+
+	switch body := v.(type) {
+	case nil:
+		return nil, contentType, nil
+	case []byte:
+		return body, contentType, nil
+	}
+
+	if codec.Marshal == nil {
+		return nil, "", fmt.Errorf("format %q can't encode request bodies", format)
+	}
+	data, err := codec.Marshal(v)
+	return data, contentType, err
+}
+
+// httpReqFormat marshals body in format and sends it with its Content-Type.
+func httpReqFormat(format Format, method, urlString, token string, body interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts []Option) (httpStatus int, responseBody []byte, err error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
+
+	data, contentType, err := marshalBody(format, body)
+	if err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+	}
+	return httpReq(format, contentType, method, urlString, token, data, headers, cookie, transport, timeout, responseStruct, opts)
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// GraphQLError is returned when a GraphQL response lists errors, whatever its
+// status. The data of a partial response is decoded all the same.
+type GraphQLError struct {
+	Errors []GraphQLErrorDetail
+	// Err is the ResourceError of a response which was not successful.
+	Err error
+}
+
+// GraphQLErrorDetail is an entry of the "errors" member of a response.
+type GraphQLErrorDetail struct {
+	Message   string `json:"message"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations,omitempty"`
+	// Path holds the field names and list indexes leading to the failed field.
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *GraphQLError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, detail := range e.Errors {
+		messages = append(messages, detail.Message)
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+func (e *GraphQLError) Unwrap() error {
+	return e.Err
+}
+
+// WithGraphQLOperation sets the operationName of a GraphQL request, which picks
+// the operation to run from a document defining several.
+func WithGraphQLOperation(name string) Option {
+	return func(o *options) {
+		o.graphQLOperation = name
+	}
+}
+
+// WithPersistedQuery sends the SHA-256 hash of the query in the persistedQuery
+// extension instead of the query, which is only sent when the server answers
+// PersistedQueryNotFound.
+func WithPersistedQuery() Option {
+	return func(o *options) {
+		o.persistedQuery = true
+	}
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage      `json:"data"`
+	Errors []GraphQLErrorDetail `json:"errors"`
+}
+
+// HttpReqGraphQL posts query and variables to a GraphQL endpoint and decodes the
+// "data" member of the response into dataOut. Errors listed by the response
+// are returned as a GraphQLError.
+func HttpReqGraphQL(urlString, query string, variables map[string]interface{}, dataOut interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqGraphQL(urlString, "", query, variables, dataOut, headers, cookie, transport, timeout, opts)
+}
+
+// HttpReqAuthGraphQL is HttpReqGraphQL with a token sent in the Authorization header.
+func HttpReqAuthGraphQL(urlString, token, query string, variables map[string]interface{}, dataOut interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqGraphQL(urlString, token, query, variables, dataOut, headers, cookie, transport, timeout, opts)
+}
+
+func httpReqGraphQL(urlString, token, query string, variables map[string]interface{}, dataOut interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts []Option) (httpStatus int, responseBody []byte, err error) {
+	o := newOptions(opts)
+
+	request := graphQLRequest{Query: query, OperationName: o.graphQLOperation, Variables: variables}
+	if o.persistedQuery {
+		sum := sha256.Sum256([]byte(query))
+		request.Query = ""
+		request.Extensions = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hex.EncodeToString(sum[:])},
+		}
+	}
+
+	var response graphQLResponse
+	httpStatus, responseBody, response, err = o.sendGraphQL(request, urlString, token, headers, cookie, transport, timeout)
+	if o.persistedQuery && persistedQueryNotFound(response.Errors) {
+		request.Query = query
+		httpStatus, responseBody, response, err = o.sendGraphQL(request, urlString, token, headers, cookie, transport, timeout)
+	}
+
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return httpStatus, responseBody, err
+	}
+
+	if dataOut != nil && len(response.Data) != 0 && !bytes.Equal(response.Data, []byte("null")) {
+		if unmarshalErr := o.unmarshal(FormatJSON, response.Data, dataOut); unmarshalErr != nil {
+			if err == nil {
+				return httpStatus, responseBody, o.decodeError(unmarshalErr, response.Data)
+			}
+		} else {
+			o.info.Decoded = true
+			o.info.Format = FormatJSON
+		}
+	}
+
+	if len(response.Errors) != 0 {
+		return httpStatus, responseBody, &GraphQLError{Errors: response.Errors, Err: err}
+	}
+	return httpStatus, responseBody, err
+}
+
+// sendGraphQL posts request and decodes the envelope of the response. The
+// envelope of an unsuccessful response is decoded when it is one.
+func (o *options) sendGraphQL(request graphQLRequest, urlString, token string, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int) (httpStatus int, responseBody []byte, response graphQLResponse, err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return httpStatus, nil, response, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+	}
+
+	headers = o.withContentType(headers, "POST", body, "application/json")
+	headers = o.withAccept(headers, FormatJSON)
+
+	httpStatus, responseBody, err = sendHttpReq(o, "POST", urlString, token, body, headers, cookie, transport, timeout)
+	responseBody = o.transcode(responseBody)
+	if len(responseBody) == 0 || hasNoContent(httpStatus) {
+		return
+	}
+
+	if err != nil {
+		o.decodeErrorBody(FormatJSON, err, responseBody)
+	}
+	if unmarshalErr := o.unmarshal(FormatJSON, responseBody, &response); unmarshalErr != nil && err == nil {
+		err = o.decodeError(unmarshalErr, responseBody)
+	}
+	return
+}
+
+// persistedQueryNotFound reports whether the server doesn't know the hash sent
+// with WithPersistedQuery.
+func persistedQueryNotFound(details []GraphQLErrorDetail) bool {
+	for _, detail := range details {
+		if detail.Message == "PersistedQueryNotFound" || detail.Extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HttpHead sends a HEAD request and returns the response headers and the
+// Content-Length, -1 when the server sent none. A 404 is an answer rather than
+// an error; restore the default with WithSuccessStatus. The size asked for is
+// that of the identity encoding, unless headers name another Accept-Encoding.
+func HttpHead(urlString string, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, header http.Header, contentLength int64, err error) {
+	o := newOptions(append([]Option{WithAcceptStatus(http.StatusNotFound)}, opts...))
+
+	if _, ok := headerKey(headers, "Accept-Encoding"); !ok {
+		headers = withHeader(headers, "Accept-Encoding", "identity")
+	}
+
+	contentLength = -1
+	httpStatus, _, err = sendHttpReq(o, "HEAD", urlString, "", nil, headers, cookie, transport, timeout)
+	header = o.info.Header
+	if value := header.Get("Content-Length"); value != "" {
+		if n, parseErr := strconv.ParseInt(value, 10, 64); parseErr == nil && n >= 0 {
+			contentLength = n
+		}
+	}
+	return httpStatus, header, contentLength, err
+}
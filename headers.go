@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"net/http"
+)
+
+type headerValue struct {
+	key   string
+	value string
+}
+
+// WithAddedHeader adds a header value after the headers map is applied. Unlike
+// the map, whose keys replace each other, repeated calls send every value.
+func WithAddedHeader(key, value string) Option {
+	return func(o *options) {
+		o.addedHeaders = append(o.addedHeaders, headerValue{key: key, value: value})
+	}
+}
+
+// WithRawHeader sends the header with exactly the given key casing, bypassing
+// canonicalization, for servers which only accept e.g. "SOAPAction".
+func WithRawHeader(key, value string) Option {
+	return func(o *options) {
+		o.rawHeaders = append(o.rawHeaders, headerValue{key: key, value: value})
+	}
+}
+
+// WithForceContentType makes the wrappers overwrite a Content-Type supplied in
+// headers, as they did before caller values were respected.
+func WithForceContentType() Option {
+	return func(o *options) {
+		o.forceContentType = true
+	}
+}
+
+// withContentType sets the Content-Type header unless the caller already did,
+// or the request has no body and a method which doesn't need one.
+func (o *options) withContentType(headers map[string]string, method string, body []byte, contentType string) map[string]string {
+	if len(body) == 0 && isBodyless(method) {
+		return headers
+	}
+
+	key, ok := headerKey(headers, "Content-Type")
+	if ok && !o.forceContentType {
+		return headers
+	}
+
+	headers = withHeader(headers, "Content-Type", contentType)
+	if ok && key != "Content-Type" {
+		delete(headers, key)
+	}
+	return headers
+}
+
+// withHeader returns a copy of headers with key set to value, so that a map
+// the caller passes to several requests keeps its own values only.
+func withHeader(headers map[string]string, key, value string) map[string]string {
+	copied := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+var defaultAccept = map[Format]string{
+	FormatJSON: "application/json",
+	FormatXML:  "application/xml, text/xml;q=0.9",
+}
+
+// WithoutDefaultAccept stops the wrappers from sending an Accept header
+// matching the format they decode.
+func WithoutDefaultAccept() Option {
+	return func(o *options) {
+		o.noDefaultAccept = true
+	}
+}
+
+// withAccept sets the Accept header for format unless the caller already did.
+func (o *options) withAccept(headers map[string]string, format Format) map[string]string {
+	accept, ok := defaultAccept[format]
+	if codec, err := formatCodec(format); !ok && err == nil && len(codec.MediaTypes) != 0 {
+		accept, ok = codec.MediaTypes[0], true
+	}
+	if !ok || o.noDefaultAccept {
+		return headers
+	}
+
+	if _, ok = headerKey(headers, "Accept"); ok {
+		return headers
+	}
+	return withHeader(headers, "Accept", accept)
+}
+
+// headerKey finds name in headers regardless of the key case.
+func headerKey(headers map[string]string, name string) (string, bool) {
+	for key := range headers {
+		if http.CanonicalHeaderKey(key) == name {
+			return key, true
+		}
+	}
+	return "", false
+}
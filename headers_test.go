@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVendorContentTypeIsKept(t *testing.T) {
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		w.Write([]byte(`{"data":{"id":"1","type":"articles"}}`))
+	}))
+	defer srv.Close()
+
+	var out struct {
+		Data struct{ ID, Type string }
+	}
+	headers := map[string]string{"content-type": "application/vnd.api+json"}
+	_, _, err := HttpReqJSON("POST", srv.URL, []byte(`{"data":{"type":"articles"}}`), headers, nil, nil, 5, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/vnd.api+json" {
+		t.Errorf("sent Content-Type %q", contentType)
+	}
+	if out.Data.ID != "1" || out.Data.Type != "articles" {
+		t.Errorf("decoded %+v", out)
+	}
+
+	_, _, err = HttpReqJSON("POST", srv.URL, []byte(`{}`), headers, nil, nil, 5, nil, WithForceContentType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("WithForceContentType sent Content-Type %q", contentType)
+	}
+	if len(headers) != 1 || headers["content-type"] != "application/vnd.api+json" {
+		t.Errorf("the caller's headers became %v", headers)
+	}
+}
+
+func TestContentTypeLeavesCallerHeadersAlone(t *testing.T) {
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+
+	headers := map[string]string{"X-Request": "1"}
+	if _, _, err := HttpReqJSON("POST", srv.URL, []byte(`{}`), headers, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := HttpReqXML("POST", srv.URL, []byte(`<a/>`), headers, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "text/xml" {
+		t.Errorf("the XML request was sent with Content-Type %q", contentType)
+	}
+	if _, ok := headers["Content-Type"]; ok {
+		t.Errorf("Content-Type was added to the caller's headers")
+	}
+}
+
+func TestAcceptLeavesCallerHeadersAlone(t *testing.T) {
+	var accept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+	}))
+	defer srv.Close()
+
+	headers := map[string]string{"X-Request": "1"}
+	if _, _, err := HttpReqJSON("GET", srv.URL, nil, headers, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if accept != "application/json" {
+		t.Errorf("the JSON request was sent with Accept %q", accept)
+	}
+	if _, _, err := HttpReqXML("GET", srv.URL, nil, headers, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if accept != "application/xml, text/xml;q=0.9" {
+		t.Errorf("the XML request was sent with Accept %q", accept)
+	}
+	if len(headers) != 1 {
+		t.Errorf("the caller's headers became %v", headers)
+	}
+}
+
+func TestRawHeaderKeepsCasingOnTheWire(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	raw := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			raw <- ""
+			return
+		}
+		defer conn.Close()
+
+		var request strings.Builder
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			request.WriteString(line)
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		raw <- request.String()
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+	}()
+
+	headers := map[string]string{"X-Normal": "1"}
+	_, _, err = HttpReqJSON("GET", "http://"+ln.Addr().String(), nil, headers, nil, nil, 5, nil,
+		WithRawHeader("SOAPAction", `"urn:Ping"`), WithRawHeader("X-EBAY-API-CALL-NAME", "GetItem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := <-raw
+	for _, line := range []string{"SOAPAction: \"urn:Ping\"\r\n", "X-EBAY-API-CALL-NAME: GetItem\r\n", "X-Normal: 1\r\n"} {
+		if !strings.Contains(request, line) {
+			t.Errorf("the request lacks %q:\n%s", line, request)
+		}
+	}
+	if strings.Contains(request, "Soapaction") || strings.Contains(request, "X-Ebay-Api-Call-Name") {
+		t.Errorf("a header was canonicalized:\n%s", request)
+	}
+}
+
+func TestBodylessRequestsHaveNoBodyHeaders(t *testing.T) {
+	type seen struct {
+		contentType   string
+		contentLength []string
+		length        int64
+	}
+	var got seen
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = seen{r.Header.Get("Content-Type"), r.Header["Content-Length"], r.ContentLength}
+	}))
+	defer srv.Close()
+
+	for _, method := range []string{"GET", "HEAD", "DELETE"} {
+		if _, _, err := HttpReqJSON(method, srv.URL, nil, nil, nil, nil, 5, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got.contentType != "" || got.contentLength != nil || got.length != 0 {
+			t.Errorf("%s sent Content-Type %q, Content-Length %v", method, got.contentType, got.contentLength)
+		}
+	}
+
+	if _, _, err := HttpReqJSON("DELETE", srv.URL, []byte(`{"id":1}`), nil, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got.contentType != "application/json" || got.length != 8 {
+		t.Errorf("DELETE with a body sent Content-Type %q, length %d", got.contentType, got.length)
+	}
+}
+
+func TestTokenWinsOverAuthorizationHeader(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer srv.Close()
+
+	headers := map[string]string{"authorization": "Basic old", "Accept": "text/plain"}
+	_, _, err := HttpReqAuthJSON("GET", srv.URL, "Bearer new", nil, headers, nil, nil, 5, nil,
+		WithAddedHeader("X-Tag", "a"), WithAddedHeader("X-Tag", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if values := got["Authorization"]; len(values) != 1 || values[0] != "Bearer new" {
+		t.Errorf("sent Authorization %q", values)
+	}
+	if values := got["Accept"]; len(values) != 1 || values[0] != "text/plain" {
+		t.Errorf("sent Accept %q", values)
+	}
+	if values := got["X-Tag"]; len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Errorf("sent X-Tag %q", values)
+	}
+}
@@ -2,14 +2,15 @@ package utils
 
 import (
 	"bytes"
-	"encoding/json"
-	"encoding/xml"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"mime/multipart"
+	"io"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,284 +19,461 @@ type ResourceError struct {
 	HTTPCode int
 	Message  string
 	Body     interface{}
-	Err      error `json:"-"`
+	Problem  *ProblemDetails
+	Attempts int
+	// Endpoints lists the outcome of every base URL tried, see WithBaseURLs.
+	Endpoints []EndpointResult
+	// Reason classifies failures without a response, see IsCanceled and IsDeadline.
+	Reason Reason
+	// Phase and Timings describe where a timed out or canceled request stopped.
+	// Timings has ConnReused and RemoteAddr with WithTimings only.
+	Phase   string
+	Timings *Timings
+	Err     error `json:"-"`
 }
 
+// FileItem is the file of a multipart upload. Its content is read from Reader,
+// else from the file at Path, else taken from Content. Reader and Path are
+// streamed instead of buffered.
 type FileItem struct {
 	Key      string
 	FileName string
 	Content  []byte
+	Reader   io.Reader
+	Path     string
+	// ContentType of the part, application/octet-stream when empty.
+	ContentType string
+	// Headers are added to the part, replacing the ones it would get.
+	Headers textproto.MIMEHeader
 }
 
 func (re *ResourceError) Error() string {
 	return fmt.Sprintf(
 		"Resource error: URL: %s, status code: %v,  err: %v, body: %v",
-		re.URL,
+		redactURL(re.URL),
 		re.HTTPCode,
 		re.Err,
-		re.Body,
+		redactBody(re.Body),
 	)
 }
 
-func HttpReqAuthXML(method, urlString, token string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	method = strings.TrimSpace(strings.ToUpper(method))
+func (re *ResourceError) Unwrap() error {
+	return re.Err
+}
 
-	if headers == nil {
-		headers = map[string]string{"Content-Type": "text/xml"}
-	} else {
-		headers["Content-Type"] = "text/xml"
+// As lets errors.As find the problem document of the response.
+func (re *ResourceError) As(target interface{}) bool {
+	if problem, ok := target.(**ProblemDetails); ok && re.Problem != nil {
+		*problem = re.Problem
+		return true
 	}
+	return false
+}
 
-	httpStatus, responseBody, err = sendHttpReq(method, urlString, token, body, headers, cookie, transport, timeout)
-	if err != nil {
-		return
-	}
+func HttpReqAuthXML(method, urlString, token string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
 
-	if responseStruct != nil && len(responseBody) != 0 {
-		err = xml.Unmarshal(responseBody, responseStruct)
-	}
-	return
+	return httpReq(FormatXML, "text/xml", method, urlString, token, body, headers, cookie, transport, timeout, responseStruct, opts)
 }
 
-func HttpReqAuthJSON(method, urlString, token string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
+func HttpReqAuthJSON(method, urlString, token string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
 	method = strings.TrimSpace(strings.ToUpper(method))
 
-	if headers == nil {
-		headers = map[string]string{"Content-Type": "application/json"}
-	} else {
-		headers["Content-Type"] = "application/json"
-	}
+	return httpReq(FormatJSON, "application/json", method, urlString, token, body, headers, cookie, transport, timeout, responseStruct, opts)
+}
 
-	httpStatus, responseBody, err = sendHttpReq(method, urlString, token, body, headers, cookie, transport, timeout)
-	if err != nil {
-		return
-	}
+func HttpReqXML(method, urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
 
-	if responseStruct != nil && len(responseBody) != 0 {
-		err = json.Unmarshal(responseBody, responseStruct)
-	}
-	return
+	return httpReq(FormatXML, "text/xml", method, urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
 }
 
-func HttpReqXML(method, urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
+func HttpReqJSON(method, urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
 	method = strings.TrimSpace(strings.ToUpper(method))
 
-	if headers == nil {
-		headers = map[string]string{"Content-Type": "text/xml"}
-	} else {
-		headers["Content-Type"] = "text/xml"
-	}
+	return httpReq(FormatJSON, "application/json", method, urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
+}
 
-	httpStatus, responseBody, err = sendHttpReq(method, urlString, "", body, headers, cookie, transport, timeout)
-	if err != nil {
-		return
-	}
+func HttpReqPostFormJSON(urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReq(FormatJSON, "application/x-www-form-urlencoded", "POST", urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
+}
 
-	if responseStruct != nil && len(responseBody) > 0 {
-		err = xml.Unmarshal(responseBody, responseStruct)
-	}
+func HttpReqPostFormXML(urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReq(FormatXML, "application/x-www-form-urlencoded", "POST", urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
+}
 
-	return
+func HttpReqPostFile(urlString string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqMultipart("POST", urlString, "", paramTexts, paramFile, headers, cookie, transport, timeout, responseStruct, opts)
 }
 
-func HttpReqJSON(method, urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	method = strings.TrimSpace(strings.ToUpper(method))
+func HttpReqAuthPutFile(urlString, token string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqAuthFile("PUT", urlString, token, paramTexts, paramFile, headers, cookie, transport, timeout, responseStruct, opts...)
+}
 
-	if headers == nil {
-		headers = map[string]string{"Content-Type": "application/json"}
-	} else {
-		headers["Content-Type"] = "application/json"
-	}
+func HttpReqAuthPostFile(urlString, token string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqAuthFile("POST", urlString, token, paramTexts, paramFile, headers, cookie, transport, timeout, responseStruct, opts...)
+}
 
-	httpStatus, responseBody, err = sendHttpReq(method, urlString, "", body, headers, cookie, transport, timeout)
-	if err != nil {
-		return
+func httpReqAuthFile(method, urlString, token string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqMultipart(method, urlString, token, paramTexts, paramFile, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+func isBodyless(method string) bool {
+	switch method {
+	case "GET", "HEAD", "DELETE", "OPTIONS":
+		return true
 	}
+	return false
+}
+
+func sendHttpReq(o *options, method, urlString, token string, data []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int) (httpStatus int, buf []byte, err error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
+	*o.info = ResponseInfo{}
 
-	if responseStruct != nil && len(responseBody) > 0 {
-		err = json.Unmarshal(responseBody, responseStruct)
+	send := func(headers map[string]string) (int, []byte, error) {
+		if key, ok := o.flightKey(method, urlString, token, data, headers, cookie, transport, timeout); ok {
+			return o.client.shareFlight(o, key, func() (int, []byte, error) {
+				return sendRequest(o, method, urlString, token, data, headers, cookie, transport, timeout)
+			})
+		}
+		return sendRequest(o, method, urlString, token, data, headers, cookie, transport, timeout)
 	}
 
-	return
+	if o.caches(method, headers) {
+		return o.sendCached(method, urlString, token, headers, send)
+	}
+	return send(headers)
 }
 
-func HttpReqPostFormJSON(urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	if headers == nil {
-		headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
-	} else {
-		headers["Content-Type"] = "application/x-www-form-urlencoded"
+// sendRequest sends the request to its endpoints, with retries and failover.
+func sendRequest(o *options, method, urlString, token string, data []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int) (httpStatus int, buf []byte, err error) {
+
+	endpoints := o.resolveEndpoints(urlString)
+	for i := range endpoints {
+		if endpoints[i].url, err = o.prepareURL(method, endpoints[i].url); err != nil {
+			return httpStatus, nil, err
+		}
 	}
 
-	httpStatus, responseBody, err = sendHttpReq("POST", urlString, "", body, headers, cookie, transport, timeout)
-	if err != nil {
-		return
+	if transport == nil {
+		transport = o.transport
 	}
-	if responseStruct != nil && len(responseBody) != 0 {
-		err = json.Unmarshal(responseBody, responseStruct)
+
+	defaultTimeout := 30 * time.Second //default timeout
+
+	if timeout > 0 {
+		defaultTimeout = time.Duration(timeout) * time.Second
 	}
-	return
-}
 
-func HttpReqPostFormXML(urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	if headers == nil {
-		headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
-	} else {
-		if _, ok := headers["Content-Type"]; !ok {
-			headers["Content-Type"] = "application/x-www-form-urlencoded"
-		}
+	if o.optionErr != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: o.optionErr, Message: o.optionErr.Error()}
 	}
 
-	httpStatus, responseBody, err = sendHttpReq("POST", urlString, "", body, headers, cookie, transport, timeout)
-	if err != nil {
-		return
+	transport = o.derivedTransport(transport)
+
+	if o.noTimeout {
+		defaultTimeout = 0
 	}
-	if responseStruct != nil && len(responseBody) != 0 {
-		err = xml.Unmarshal(responseBody, responseStruct)
+
+	if err = o.checkDeadline(defaultTimeout); err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: "request rejected"}
 	}
-	return
-}
 
-func HttpReqPostFile(urlString string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	client := o.client.httpClient(transport, defaultTimeout, o.jar)
 
-	for k, v := range paramTexts {
-		writer.WriteField(k, v)
+	authorization := token
+	if authorization == "" {
+		authorization = o.authorization
+	}
+	if checkRedirect := o.checkRedirect(authorization); checkRedirect != nil {
+		o.ctx = context.WithValue(o.context(), redirectPolicyKey{}, checkRedirect)
 	}
 
-	fileWriter, err := writer.CreateFormFile(paramFile.Key, paramFile.FileName)
-	if err != nil {
-		return
+	if o.stream != nil {
+		if err = o.stream.check(o, len(endpoints)); err != nil {
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+		}
 	}
 
-	fileWriter.Write(paramFile.Content)
+	if err = o.compressBody(data, headers); err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
+	}
 
-	if headers == nil {
-		headers = map[string]string{"Content-Type": writer.FormDataContentType()}
-	} else {
-		headers["Content-Type"] = writer.FormDataContentType()
+	if err = o.bodyDigests(data); err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
 	}
 
-	writer.Close()
+	if err = o.signingBody(data); err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+	}
 
-	httpStatus, responseBody, err = sendHttpReq("POST", urlString, "", body.Bytes(), headers, cookie, transport, timeout)
-	if err != nil {
-		return
+	if o.info.IdempotencyKey, err = o.idempotencyKeyFor(method); err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
 	}
 
-	if responseStruct != nil && len(responseBody) > 0 {
-		err = json.Unmarshal(responseBody, responseStruct)
+	// counted before checking, so that Close can't miss the request
+	atomic.AddInt64(&o.client.inFlight, 1)
+	defer atomic.AddInt64(&o.client.inFlight, -1)
+
+	if o.client.isClosed() {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: ErrClientClosed, Message: ErrClientClosed.Error()}
 	}
 
-	return
-}
+	var failed []EndpointResult
+	for i, endpoint := range endpoints {
+		o.info.Endpoint = endpoint.url
 
-func HttpReqAuthPutFile(urlString, token string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	return httpReqAuthFile("PUT", urlString, token, paramTexts, paramFile, headers, cookie, transport, timeout, responseStruct)
-}
+		if o.balancer != nil {
+			o.balancer.start(endpoint.base)
+		}
 
-func HttpReqAuthPostFile(urlString, token string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	return httpReqAuthFile("POST", urlString, token, paramTexts, paramFile, headers, cookie, transport, timeout, responseStruct)
-}
+		httpStatus, buf, err = sendWithRetry(o, client, method, endpoint.url, token, data, headers, cookie)
+		failover := err != nil && o.shouldFailover(httpStatus, err)
 
-func httpReqAuthFile(method, urlString, token string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}) (httpStatus int, responseBody []byte, err error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+		if o.balancer != nil {
+			o.balancer.done(endpoint.base, !failover)
+		}
 
-	for k, v := range paramTexts {
-		writer.WriteField(k, v)
+		if !failover || i == len(endpoints)-1 {
+			break
+		}
+		failed = append(failed, EndpointResult{URL: endpoint.url, Status: httpStatus, Err: err})
 	}
 
-	fileWriter, err := writer.CreateFormFile(paramFile.Key, paramFile.FileName)
-	if err != nil {
-		return
+	var re *ResourceError
+	if len(failed) != 0 && errors.As(err, &re) {
+		re.Endpoints = append(failed, EndpointResult{URL: o.info.Endpoint, Status: httpStatus, Err: err})
 	}
+	return
+}
 
-	fileWriter.Write(paramFile.Content)
-
-	if headers == nil {
-		headers = map[string]string{"Content-Type": writer.FormDataContentType()}
-	} else {
-		headers["Content-Type"] = writer.FormDataContentType()
+// prepareURL validates and normalizes the URL of the request.
+func (o *options) prepareURL(method, urlString string) (string, error) {
+	if err := o.validateRequest(method, urlString); err != nil {
+		return urlString, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
 	}
 
-	writer.Close()
-
-	httpStatus, responseBody, err = sendHttpReq(method, urlString, token, body.Bytes(), headers, cookie, transport, timeout)
+	urlString, err := o.normalizeURL(urlString)
 	if err != nil {
-		return
+		return urlString, &ResourceError{URL: urlString, Err: err}
 	}
 
-	if responseStruct != nil && len(responseBody) > 0 {
-		err = json.Unmarshal(responseBody, responseStruct)
+	requestURL, err := url.Parse(urlString)
+	if err != nil {
+		return urlString, &ResourceError{URL: urlString, Err: err}
 	}
 
-	return
+	if err = o.checkURL(requestURL); err != nil {
+		return urlString, &ResourceError{URL: urlString, Err: err, Message: "request rejected"}
+	}
+	return urlString, nil
 }
 
-func sendHttpReq(method, urlString, token string, data []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int) (httpStatus int, buf []byte, err error) {
-	defaultTimeout := 30 * time.Second //default timeout
+// sendWithRetry sends the request to a single URL, retrying as configured.
+func sendWithRetry(o *options, client *http.Client, method, urlString, token string, data []byte, headers map[string]string, cookie *http.Cookie) (httpStatus int, buf []byte, err error) {
+	attempt := 1
+	for ; ; attempt++ {
+		httpStatus, buf, err = doHttpReq(o, client, method, urlString, token, data, headers, cookie)
+		if o.retryWithoutExpect(httpStatus) {
+			httpStatus, buf, err = doHttpReq(o, client, method, urlString, token, data, headers, cookie)
+		}
+		if o.retryWithDigest(urlString, token, httpStatus) {
+			httpStatus, buf, err = doHttpReq(o, client, method, urlString, token, data, headers, cookie)
+		}
+		if o.retryWithNewToken(httpStatus) {
+			httpStatus, buf, err = doHttpReq(o, client, method, urlString, token, data, headers, cookie)
+		}
+		if !o.shouldRetry(attempt, method, httpStatus, err) {
+			break
+		}
 
-	if timeout > 0 {
-		defaultTimeout = time.Duration(timeout) * time.Second
+		if waitErr := o.backoff(attempt, method, urlString, httpStatus, err); waitErr != nil {
+			err = o.classify(&ResourceError{URL: urlString, Err: waitErr, HTTPCode: httpStatus})
+			break
+		}
 	}
 
-	client := &http.Client{
-		Timeout: defaultTimeout,
+	var re *ResourceError
+	if errors.As(err, &re) {
+		re.Attempts = attempt
 	}
+	return
+}
 
-	if transport != nil {
-		client.Transport = transport
+// doHttpReq makes a single attempt of the request.
+func doHttpReq(o *options, client *http.Client, method, urlString, token string, data []byte, headers map[string]string, cookie *http.Cookie) (httpStatus int, buf []byte, err error) {
+	var requestBody io.Reader
+	if o.compressedBody != nil {
+		requestBody = bytes.NewReader(o.compressedBody)
+	} else if o.stream == nil && (len(data) != 0 || !isBodyless(method)) {
+		requestBody = bytes.NewBuffer(data)
 	}
 
-	request, err := http.NewRequest(method, urlString, bytes.NewBuffer(data))
+	request, err := http.NewRequestWithContext(o.context(), method, urlString, requestBody)
 
 	if err != nil {
 		return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
 	}
 
+	// client.Do closes the body; failing before it must too, or the writer of a
+	// streamed body blocks forever
+	sent := false
+	defer func() {
+		if !sent && request.Body != nil {
+			request.Body.Close()
+		}
+	}()
+
+	if o.stream != nil {
+		if err = o.stream.attach(request); err != nil {
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
+		}
+	}
+
+	o.applyMethodOverride(request)
+	o.applyChunked(request)
+	o.applyExpect(request)
+	o.applyCompression(request)
+	o.applyAcceptEncoding(request)
+	o.applyDigests(request)
+	o.trackUpload(request)
+	o.applyTrailers(request)
+
 	if cookie != nil {
 		request.AddCookie(cookie)
 	}
 
 	for key, value := range headers {
-		request.Header.Add(key, value)
+		request.Header.Set(key, value)
+	}
+
+	for _, h := range o.addedHeaders {
+		request.Header.Add(h.key, h.value)
+	}
+
+	for _, h := range o.rawHeaders {
+		request.Header.Del(h.key)
+		request.Header[h.key] = append(request.Header[h.key], h.value)
+	}
+
+	if o.info.IdempotencyKey != "" {
+		request.Header.Set(o.idempotencyHeaderName(), o.info.IdempotencyKey)
+	}
+
+	if o.authorization != "" {
+		request.Header.Set("Authorization", o.authorization)
+	}
+
+	if err = o.applyTokenSource(request, token); err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: "token source failed: " + err.Error()}
 	}
 
+	// the token argument wins over an Authorization header from the map
 	if token != "" {
-		request.Header.Add("Authorization", token)
+		request.Header.Set("Authorization", token)
 	}
+	o.applyDigest(request)
 
-	if strings.ContainsAny(urlString, "?") {
-		urlTemp, err := url.Parse(urlString)
-		if err != nil {
-			return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
+	if o.limiter != nil {
+		if err = o.limiter.wait(request.Context(), request.URL.Host); err != nil {
+			return httpStatus, nil, o.classify(&ResourceError{URL: urlString, Err: err, Message: "rate limiter wait aborted"})
+		}
+	}
+
+	release, err := o.acquireSlot()
+	if err != nil {
+		return httpStatus, nil, o.classify(&ResourceError{URL: urlString, Err: err, Message: err.Error()})
+	}
+	defer release()
+
+	// signed last, so that waiting for the limiter doesn't age the signature
+	if o.signer != nil {
+		if err = o.signer.Sign(request, o.signBody); err != nil {
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: "signing failed: " + err.Error()}
 		}
+	}
 
-		urlQuery := urlTemp.Query()
-		urlTemp.RawQuery = urlQuery.Encode()
-		urlString = urlTemp.String()
+	tracer := newPhaseTracer(o.timings != nil)
+	request = request.WithContext(tracer.withContext(request.Context()))
+	if o.timings != nil {
+		defer func() { *o.timings = *tracer.timings() }()
 	}
 
+	sent = true
 	response, err := client.Do(request)
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		o.info.InsecureTLS = insecure(transport)
+	}
 	if err != nil {
-		return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
+		// retries need to know whether a failed request reached the server
+		if o.retry != nil && !tracer.sent() {
+			err = &notSentError{err: err}
+		}
+
+		if errors.Is(err, ErrTooManyRedirects) {
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: ErrTooManyRedirects.Error()}
+		}
+		err = o.phaseTimeoutError(tracer, err)
+		err = o.proxyError(err)
+
+		re := o.classify(tracer.annotate(&ResourceError{URL: urlString, Err: err}))
+		var proxyErr *ProxyError
+		if re.Message == "" && errors.As(err, &proxyErr) {
+			re.Message = proxyErr.Error()
+		}
+		return httpStatus, nil, re
 	}
 	defer response.Body.Close()
 
-	buf, err = ioutil.ReadAll(response.Body)
+	responseBody, err := o.decompress(response)
 	if err != nil {
 		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, HTTPCode: response.StatusCode}
 	}
+	responseBody = o.idleTimeoutBody(responseBody, response.Body)
+	responseBody = o.trackDownload(responseBody, response.ContentLength)
+	if o.truncateBody > 0 {
+		responseBody = io.LimitReader(responseBody, o.truncateBody)
+	}
+	if o.spill != nil && !o.isSuccess(response.StatusCode) {
+		responseBody = io.LimitReader(responseBody, o.spill.threshold)
+	}
+	if o.download != nil && !o.isSuccess(response.StatusCode) {
+		responseBody = io.LimitReader(responseBody, downloadErrorBodyLimit)
+	}
+
+	if o.download != nil && o.isSuccess(response.StatusCode) {
+		err = o.download.copy(response, responseBody)
+	} else {
+		toFile := o.spill != nil && o.isSuccess(response.StatusCode)
+		buf, err = o.readLimitedBody(responseBody, response.ContentLength, toFile)
+	}
+
+	var writeErr *WriteError
+	var decodeErr *DecodeError
+	if errors.Is(err, ErrResponseTooLarge) || errors.As(err, &writeErr) || errors.As(err, &decodeErr) {
+		return response.StatusCode, buf, &ResourceError{URL: urlString, Err: err, HTTPCode: response.StatusCode, Message: err.Error()}
+	}
+	if err != nil {
+		return httpStatus, nil, o.classify(tracer.annotate(&ResourceError{URL: urlString, Err: err, HTTPCode: response.StatusCode}))
+	}
+	tracer.mark(&tracer.bodyDone)()
 
 	httpStatus = response.StatusCode
-	if response.StatusCode > 399 {
+	o.info.Status = response.StatusCode
+	o.info.Header = response.Header
+	o.info.Proto = response.Proto
+	o.info.TLS = newTLSInfo(response.TLS)
+	o.info.FileName = responseFileName(response)
+	o.info.Trailer = response.Trailer
+
+	if !o.isSuccess(response.StatusCode) {
 		return httpStatus, buf, &ResourceError{
 			URL:      urlString,
 			Err:      fmt.Errorf("incorrect status code"),
 			HTTPCode: response.StatusCode,
 			Message:  "incorrect response.StatusCode",
 			Body:     string(data),
+			Problem:  parseProblem(response.Header.Get("Content-Type"), buf),
 		}
 	}
 
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+type protocolMode int
+
+const (
+	protocolsOfTransport protocolMode = iota
+	protocolsHTTP2
+	protocolsHTTP2Only
+	protocolsH2C
+	protocolsHTTP1Only
+)
+
+// WithHTTP2 attempts HTTP/2 over TLS. With force HTTP/1 is disabled, so
+// requests to servers which don't negotiate HTTP/2 fail instead of falling
+// back. ResponseInfo.Proto tells which protocol was used.
+func WithHTTP2(force bool) Option {
+	return func(o *options) {
+		o.protocols = protocolsHTTP2
+		if force {
+			o.protocols = protocolsHTTP2Only
+		}
+	}
+}
+
+// WithH2C speaks cleartext HTTP/2 to http URLs, without upgrading from
+// HTTP/1.1, and HTTP/2 over TLS to https ones.
+func WithH2C() Option {
+	return func(o *options) {
+		o.protocols = protocolsH2C
+	}
+}
+
+// WithHTTP1Only never uses HTTP/2, for servers breaking with it.
+func WithHTTP1Only() Option {
+	return func(o *options) {
+		o.protocols = protocolsHTTP1Only
+	}
+}
+
+// protocolKey describes the protocol options for the variant key of derived
+// transports.
+func (o *options) protocolKey() string {
+	if o.protocols == protocolsOfTransport {
+		return ""
+	}
+	return fmt.Sprint(int(o.protocols))
+}
+
+// protocolVariant configures a clone of the transport for the protocol options.
+func (o *options) protocolVariant(clone *http.Transport) {
+	var protocols http.Protocols
+	switch o.protocols {
+	case protocolsOfTransport:
+		return
+	case protocolsHTTP2:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	case protocolsHTTP2Only:
+		protocols.SetHTTP2(true)
+	case protocolsH2C:
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	case protocolsHTTP1Only:
+		protocols.SetHTTP1(true)
+		clone.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		if clone.TLSClientConfig != nil {
+			// a transport which already spoke HTTP/2 offers it through ALPN
+			var nextProtos []string
+			for _, proto := range clone.TLSClientConfig.NextProtos {
+				if proto != "h2" {
+					nextProtos = append(nextProtos, proto)
+				}
+			}
+			clone.TLSClientConfig.NextProtos = nextProtos
+		}
+	}
+
+	clone.ForceAttemptHTTP2 = protocols.HTTP2()
+	clone.Protocols = &protocols
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTP2Options(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"proto":"` + r.Proto + `"}`))
+	})
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+	h1 := httptest.NewTLSServer(handler)
+	defer h1.Close()
+	cleartext := httptest.NewUnstartedServer(handler)
+	cleartext.Config.Protocols = new(http.Protocols)
+	cleartext.Config.Protocols.SetHTTP1(true)
+	cleartext.Config.Protocols.SetUnencryptedHTTP2(true)
+	cleartext.Start()
+	defer cleartext.Close()
+
+	tests := []struct {
+		name  string
+		url   string
+		opts  []Option
+		proto string
+	}{
+		{"negotiated", h2.URL, []Option{WithInsecureSkipTLSVerify(), WithHTTP2(false)}, "HTTP/2.0"},
+		{"HTTP/1 only", h2.URL, []Option{WithInsecureSkipTLSVerify(), WithHTTP1Only()}, "HTTP/1.1"},
+		{"forced on an HTTP/1 server", h1.URL, []Option{WithInsecureSkipTLSVerify(), WithHTTP2(true)}, ""},
+		{"h2c", cleartext.URL, []Option{WithH2C()}, "HTTP/2.0"},
+	}
+	for _, tt := range tests {
+		var info ResponseInfo
+		var out struct{ Proto string }
+		_, _, err := HttpReqJSON("GET", tt.url, nil, nil, nil, nil, 5, &out, append(tt.opts, WithResponseInfo(&info))...)
+		if tt.proto == "" {
+			if err == nil {
+				t.Errorf("%s: succeeded over %s", tt.name, info.Proto)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if info.Proto != tt.proto || out.Proto != tt.proto {
+			t.Errorf("%s: client saw %s, server saw %s, want %s", tt.name, info.Proto, out.Proto, tt.proto)
+		}
+	}
+}
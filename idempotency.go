@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+const defaultIdempotencyHeader = "Idempotency-Key"
+
+// WithIdempotencyKey sends key in the Idempotency-Key header of every attempt.
+// With an empty key one UUIDv4 is generated per request, but only when retries
+// are enabled for a non-idempotent method. The key used is reported in
+// ResponseInfo.IdempotencyKey.
+func WithIdempotencyKey(key string) Option {
+	return func(o *options) {
+		o.idempotencyKey = &key
+	}
+}
+
+// WithIdempotencyHeader renames the header, e.g. to X-Idempotency-Key.
+func WithIdempotencyHeader(name string) Option {
+	return func(o *options) {
+		o.idempotencyHeader = name
+	}
+}
+
+// idempotencyKeyFor returns the key for the request, empty when none is sent.
+func (o *options) idempotencyKeyFor(method string) (string, error) {
+	if o.idempotencyKey == nil {
+		return "", nil
+	}
+	if *o.idempotencyKey != "" {
+		return *o.idempotencyKey, nil
+	}
+
+	if o.retry == nil || o.retry.MaxAttempts < 2 || isIdempotent(method) {
+		return "", nil
+	}
+	return newUUID()
+}
+
+func (o *options) idempotencyHeaderName() string {
+	if o.idempotencyHeader != "" {
+		return o.idempotencyHeader
+	}
+	return defaultIdempotencyHeader
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID.
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import "net"
+
+// IPPreference selects the address family connections use.
+type IPPreference int
+
+const (
+	// IPAny leaves the choice to net/http, which tries both families.
+	IPAny IPPreference = iota
+	// IPv4Only connects over IPv4 only.
+	IPv4Only
+	// IPv6Only connects over IPv6 only.
+	IPv6Only
+	// PreferIPv4 tries the IPv4 addresses of a host before the IPv6 ones.
+	PreferIPv4
+	// PreferIPv6 tries the IPv6 addresses of a host before the IPv4 ones.
+	PreferIPv6
+)
+
+// WithIPPreference sets the address family of the connections. Like
+// WithDNSCache it should be passed to NewClient.
+func WithIPPreference(pref IPPreference) Option {
+	return func(o *options) {
+		o.ipPreference = pref
+	}
+}
+
+// order filters and sorts the addresses as pref says, keeping their order
+// within a family.
+func (pref IPPreference) order(addrs []string) []string {
+	if pref == IPAny {
+		return addrs
+	}
+
+	var v4, v6 []string
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip != nil && ip.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+
+	switch pref {
+	case IPv4Only:
+		return v4
+	case IPv6Only:
+		return v6
+	case PreferIPv6:
+		return append(v6, v4...)
+	}
+	return append(v4, v6...)
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WithJSONArrayPath makes HttpReqJSONArray look for the array under the keys
+// of nested objects, e.g. "items" for {"items": [...]}.
+func WithJSONArrayPath(keys ...string) Option {
+	return func(o *options) {
+		o.jsonArrayPath = keys
+	}
+}
+
+// HttpReqJSONArray decodes the elements of a JSON array response one at a time
+// while it is read: each goes into a fresh value of newElement, which is passed
+// to onElement. The body is never held in memory as a whole. An error of
+// onElement, returned in a WriteError, or the end of ctx stop reading and
+// close the body. There is no default timeout, ctx bounds the request.
+func HttpReqJSONArray(ctx context.Context, method, urlString string, body []byte, newElement func() interface{}, onElement func(interface{}) error, opts ...Option) (httpStatus int, elements int, err error) {
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx), withoutTimeout())
+	o := newOptions(opts)
+
+	consume := func(response *http.Response, body io.Reader) error {
+		decoder := json.NewDecoder(skipUTF8BOM(body))
+		if o.useNumber {
+			decoder.UseNumber()
+		}
+
+		decodeErr := func(err error) *DecodeError {
+			return &DecodeError{
+				ContentType: response.Header.Get("Content-Type"),
+				HTTPCode:    response.StatusCode,
+				Err:         fmt.Errorf("at offset %d: %w", decoder.InputOffset(), err),
+			}
+		}
+
+		if err := findJSONArray(decoder, o.jsonArrayPath); err != nil {
+			return decodeErr(err)
+		}
+
+		for decoder.More() {
+			element := newElement()
+			if err := decoder.Decode(element); err != nil {
+				return decodeErr(err)
+			}
+			if err := onElement(element); err != nil {
+				return err
+			}
+			elements++
+		}
+		// the closing bracket, the rest of the document is not read
+		if _, err := decoder.Token(); err != nil {
+			return decodeErr(err)
+		}
+		return nil
+	}
+
+	headers := map[string]string{"Accept": "application/json"}
+	if len(body) != 0 {
+		headers["Content-Type"] = "application/json"
+	}
+
+	method = strings.TrimSpace(strings.ToUpper(method))
+	httpStatus, _, err = httpDownload(method, urlString, "", body, &download{consume: consume}, headers, nil, nil, 0, opts)
+	return httpStatus, elements, err
+}
+
+// findJSONArray reads up to the opening bracket of the array under path.
+func findJSONArray(decoder *json.Decoder, path []string) error {
+	for _, key := range path {
+		if err := expectDelim(decoder, '{'); err != nil {
+			return err
+		}
+
+		for {
+			if !decoder.More() {
+				return fmt.Errorf("key %q not found", key)
+			}
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			if token == key {
+				break
+			}
+			if err = skipJSONValue(decoder); err != nil {
+				return err
+			}
+		}
+	}
+	return expectDelim(decoder, '[')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, found %v", delim, token)
+	}
+	return nil
+}
+
+// skipJSONValue reads past the next value without keeping it.
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// RuleMaxResponseSize is broken by a response body larger than WithMaxResponseBytes.
+const RuleMaxResponseSize Rule = "max_response_size"
+
+// ErrResponseTooLarge matches, with errors.Is, the error of a response whose body
+// exceeds WithMaxResponseBytes. The *ResponseTooLargeError has the details.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// ResponseTooLargeError reports a body cut at Limit bytes. Read is how many bytes
+// were read before giving up and ContentLength is -1 when the server sent none.
+type ResponseTooLargeError struct {
+	Limit         int64
+	Read          int64
+	ContentLength int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	msg := fmt.Sprintf("%s: limit %d bytes, read %d", ErrResponseTooLarge, e.Limit, e.Read)
+	if e.ContentLength >= 0 {
+		msg += fmt.Sprintf(", Content-Length %d", e.ContentLength)
+	}
+	return msg
+}
+
+func (e *ResponseTooLargeError) Is(target error) bool {
+	return target == ErrResponseTooLarge
+}
+
+// WithMaxResponseBytes aborts reading a response body longer than n bytes, zero
+// means no limit. A Content-Length over n fails before reading anything.
+func WithMaxResponseBytes(n int64) Option {
+	return func(o *options) {
+		o.maxResponseBytes = n
+	}
+}
+
+// WithPartialBody returns the bytes read so far along with ErrResponseTooLarge.
+func WithPartialBody() Option {
+	return func(o *options) {
+		o.partialBody = true
+	}
+}
+
+// readLimitedBody reads the response body, applying WithMaxResponseBytes, into
+// memory or with toFile as WithSpillFile says.
+func (o *options) readLimitedBody(body io.Reader, contentLength int64, toFile bool) ([]byte, error) {
+	read := o.readBody
+	if toFile {
+		read = o.readSpilled
+	}
+
+	limit := o.maxResponseBytes
+	if limit <= 0 {
+		return read(body, contentLength)
+	}
+
+	if contentLength > limit {
+		tooLarge := &ResponseTooLargeError{Limit: limit, ContentLength: contentLength}
+		if err := o.enforce(RuleMaxResponseSize, strconv.FormatInt(contentLength, 10), tooLarge); err != nil {
+			return nil, err
+		}
+		return read(body, contentLength)
+	}
+
+	limited := &io.LimitedReader{R: body, N: limit + 1}
+	buf, err := read(limited, contentLength)
+	if err != nil || limited.N > 0 {
+		return buf, err
+	}
+
+	if toFile && *o.spill.file != nil {
+		return nil, o.spillRest(body, limit)
+	}
+
+	tooLarge := &ResponseTooLargeError{Limit: limit, Read: int64(len(buf)), ContentLength: contentLength}
+	if err = o.enforce(RuleMaxResponseSize, strconv.FormatInt(tooLarge.Read, 10)+"+", tooLarge); err != nil {
+		if o.partialBody {
+			return buf[:limit], err
+		}
+		return nil, err
+	}
+
+	// only warned about, so the rest is read after all
+	rest, err := ioutil.ReadAll(body)
+	return append(buf, rest...), err
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+)
+
+// ErrStopPolling is returned by a LongPoll handler to end the loop cleanly.
+var ErrStopPolling = errors.New("stop polling")
+
+const (
+	defaultLongPollTimeout = 90 * time.Second
+	defaultLongPollBackoff = time.Second
+	defaultLongPollMaxWait = 30 * time.Second
+)
+
+// WithLongPollTimeout sets the time LongPoll gives each request, which must
+// exceed the time the server holds it. 90 seconds by default.
+func WithLongPollTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.longPollTimeout = d
+	}
+}
+
+// WithLongPollBackoff sets the wait after a failed LongPoll request, doubled
+// after each consecutive failure up to max. 1 and 30 seconds by default.
+func WithLongPollBackoff(base, max time.Duration) Option {
+	return func(o *options) {
+		o.longPollBackoff = base
+		o.longPollMaxWait = max
+	}
+}
+
+// LongPoll sends GET requests to urlString in a loop, passing every response
+// with a body to handler. Empty and 204 responses and requests timing out
+// reconnect at once, failures reconnect after a backoff. The loop ends when
+// ctx is done, returning its error, when handler returns an error, which is
+// returned unless it is ErrStopPolling, or with the ResourceError of a 4xx
+// response other than 408 and 429, which reconnecting won't fix.
+func LongPoll(ctx context.Context, urlString string, handler func(status int, body []byte) error, opts ...Option) error {
+	o := newOptions(opts)
+
+	timeout := o.longPollTimeout
+	if timeout <= 0 {
+		timeout = defaultLongPollTimeout
+	}
+	base, max := o.longPollBackoff, o.longPollMaxWait
+	if base <= 0 {
+		base = defaultLongPollBackoff
+	}
+	if max <= 0 {
+		max = defaultLongPollMaxWait
+	}
+	seconds := int(math.Ceil(timeout.Seconds()))
+
+	wait := base
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		// options hold the state of a request, such as a refreshed token
+		attempt := newOptions(opts)
+		attempt.ctx = attemptCtx
+		status, body, err := sendHttpReq(attempt, "GET", urlString, "", nil, nil, nil, nil, seconds)
+		timedOut := attemptCtx.Err() == context.DeadlineExceeded
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		switch {
+		case err == nil:
+			wait = base
+			if status == http.StatusNoContent || len(body) == 0 {
+				continue
+			}
+
+			if err = handler(status, body); err != nil {
+				if err == ErrStopPolling {
+					return nil
+				}
+				return err
+			}
+			continue
+		case timedOut:
+			wait = base
+			continue
+		case clientError(err):
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		if wait *= 2; wait > max {
+			wait = max
+		}
+	}
+}
+
+// clientError reports a 4xx response other than 408 and 429.
+func clientError(err error) bool {
+	var resourceErr *ResourceError
+	if !errors.As(err, &resourceErr) {
+		return false
+	}
+
+	code := resourceErr.HTTPCode
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLongPollStopsOnClientErrors(t *testing.T) {
+	tests := []struct {
+		status   int
+		requests int
+	}{
+		{http.StatusNotFound, 1},
+		{http.StatusUnauthorized, 1},
+		{http.StatusRequestTimeout, 3},
+		{http.StatusTooManyRequests, 3},
+		{http.StatusServiceUnavailable, 3},
+	}
+
+	for _, tt := range tests {
+		requests := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 3 {
+				w.Write([]byte("event"))
+				return
+			}
+			w.WriteHeader(tt.status)
+		}))
+
+		handler := func(status int, body []byte) error { return ErrStopPolling }
+		err := LongPoll(context.Background(), srv.URL, handler, WithLongPollBackoff(time.Millisecond, time.Millisecond))
+		srv.Close()
+
+		if requests != tt.requests {
+			t.Errorf("%d: sent %d requests, want %d", tt.status, requests, tt.requests)
+		}
+		var resourceErr *ResourceError
+		if tt.requests == 1 && (!errors.As(err, &resourceErr) || resourceErr.HTTPCode != tt.status) {
+			t.Errorf("%d: got %v, want its ResourceError", tt.status, err)
+		}
+		if tt.requests > 1 && err != nil {
+			t.Errorf("%d: %v", tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"net/http"
+)
+
+// FormatMsgpack is registered when the package is built with the msgpack tag.
+const FormatMsgpack Format = "msgpack"
+
+// HttpReqMsgpack sends body as application/msgpack and decodes the response as
+// MessagePack. body may be nil, a []byte sent as is or a value to marshal.
+func HttpReqMsgpack(method, urlString string, body interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqFormat(FormatMsgpack, method, urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+func HttpReqAuthMsgpack(method, urlString, token string, body interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqFormat(FormatMsgpack, method, urlString, token, body, headers, cookie, transport, timeout, responseStruct, opts)
+}
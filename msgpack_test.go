@@ -0,0 +1,69 @@
+//go:build msgpack
+// +build msgpack
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type msgpackItem struct {
+	Name string
+	Blob []byte
+}
+
+type msgpackOrder struct {
+	ID    int64
+	Items []msgpackItem
+	Meta  map[string]msgpackItem
+	Raw   []byte
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/msgpack" {
+			t.Errorf("Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var order msgpackOrder
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := msgpack.Unmarshal(body, &order); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/msgpack")
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	in := msgpackOrder{
+		ID:    1 << 60,
+		Items: []msgpackItem{{Name: "a", Blob: []byte{0, 1, 0xff}}},
+		Meta:  map[string]msgpackItem{"m": {Name: "b", Blob: []byte{}}},
+		Raw:   []byte("\x00\xc1binary"),
+	}
+	var out msgpackOrder
+	status, _, err := HttpReqAuthMsgpack("POST", srv.URL, "token", in, nil, nil, nil, 5, &out)
+	if err != nil || status != http.StatusOK {
+		t.Fatal(status, err)
+	}
+	if out.ID != in.ID || len(out.Items) != 1 || !bytes.Equal(out.Items[0].Blob, in.Items[0].Blob) ||
+		out.Meta["m"].Name != "b" || !bytes.Equal(out.Raw, in.Raw) {
+		t.Errorf("round trip gave %+v", out)
+	}
+
+	_, _, err = HttpReqMsgpack("POST", srv.URL, in, nil, nil, nil, 5, &out)
+	var resourceErr *ResourceError
+	if !errors.As(err, &resourceErr) || resourceErr.HTTPCode != http.StatusUnauthorized {
+		t.Errorf("unauthorized request: %v", err)
+	}
+}
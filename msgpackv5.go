@@ -0,0 +1,19 @@
+//go:build msgpack
+// +build msgpack
+
+package utils
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Building with the msgpack tag registers FormatMsgpack; the module using this
+// package must require github.com/vmihailenco/msgpack/v5.
+func init() {
+	RegisterFormat(FormatMsgpack, Codec{
+		MediaTypes: []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+		Suffix:     "+msgpack",
+		Marshal:    msgpack.Marshal,
+		Unmarshal:  msgpack.Unmarshal,
+	})
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewMTLSTransport returns a transport built like NewDefaultTransport which
+// presents the client certificate of certFile and keyFile and trusts the CAs of
+// caFile, or the system roots when caFile is empty. The key pair is loaded
+// again when either file changes, so short-lived certificates can be renewed
+// on disk; a renewal which fails to load keeps the previous certificate.
+func NewMTLSTransport(certFile, keyFile, caFile string, opts ...TransportOption) (*http.Transport, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	var roots *x509.CertPool
+	if caFile != "" {
+		caPEM, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		if roots, err = certPool(caPEM); err != nil {
+			return nil, fmt.Errorf("CA file %s: %w", caFile, err)
+		}
+	}
+
+	transport := NewDefaultTransport(opts...)
+	transport.TLSClientConfig = &tls.Config{
+		GetClientCertificate: reloader.certificate,
+		RootCAs:              roots,
+	}
+	return transport, nil
+}
+
+// NewMTLSTransportPEM is NewMTLSTransport with the certificate, key and CAs
+// given in PEM. caPEM may be nil to trust the system roots.
+func NewMTLSTransportPEM(certPEM, keyPEM, caPEM []byte, opts ...TransportOption) (*http.Transport, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("client key pair: %w", err)
+	}
+
+	var roots *x509.CertPool
+	if caPEM != nil {
+		if roots, err = certPool(caPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	transport := NewDefaultTransport(opts...)
+	transport.TLSClientConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+	}
+	return transport, nil
+}
+
+func certPool(caPEM []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no CA certificates found in PEM")
+	}
+	return pool, nil
+}
+
+// certReloader serves the client certificate, loading it again when the
+// modification time of its files changes.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified [2]time.Time
+}
+
+func (r *certReloader) modTimes() (modified [2]time.Time, err error) {
+	for i, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return modified, err
+		}
+		modified[i] = info.ModTime()
+	}
+	return modified, nil
+}
+
+func (r *certReloader) load() error {
+	modified, err := r.modTimes()
+	if err != nil {
+		return fmt.Errorf("client certificate: %w", err)
+	}
+
+	certPEM, err := ioutil.ReadFile(r.certFile)
+	if err != nil {
+		return fmt.Errorf("client certificate: %w", err)
+	}
+	keyPEM, err := ioutil.ReadFile(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("client key: %w", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("client key pair %s, %s: %w", r.certFile, r.keyFile, err)
+	}
+
+	r.mu.Lock()
+	r.cert, r.modified = &cert, modified
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) certificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if modified, err := r.modTimes(); err == nil {
+		r.mu.Lock()
+		changed := modified != r.modified
+		r.mu.Unlock()
+
+		if changed {
+			// a half written renewal fails to load, the next handshake retries
+			_ = r.load()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, nil
+}
@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+)
+
+// httpReqMultipart sends the text fields and file as multipart/form-data. A file
+// given by Reader or Path is streamed through a pipe while the request is sent.
+func httpReqMultipart(method, urlString, token string, paramTexts map[string]string, paramFile FileItem, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts []Option) (httpStatus int, responseBody []byte, err error) {
+	var body []byte
+	o := newOptions(opts)
+	form := multipartForm{texts: paramTexts, order: o.fieldOrder, fields: o.binaryFields, file: paramFile}
+
+	boundaryWriter := multipart.NewWriter(ioutil.Discard)
+	if o.boundary != "" {
+		boundaryWriter.SetBoundary(o.boundary)
+	}
+	boundary, contentType := boundaryWriter.Boundary(), boundaryWriter.FormDataContentType()
+
+	if paramFile.Reader == nil && paramFile.Path == "" {
+		buf := &bytes.Buffer{}
+		writer := multipart.NewWriter(buf)
+		writer.SetBoundary(boundary)
+		if err = writeMultipart(writer, form, bytes.NewReader(paramFile.Content)); err != nil {
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
+		}
+		body = buf.Bytes()
+	} else {
+		stream, err := newMultipartStream(form, boundary)
+		if err != nil {
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
+		}
+		opts = withStream(opts, stream)
+	}
+
+	// the boundary is generated here, so a caller supplied Content-Type can't be kept
+	key, ok := headerKey(headers, "Content-Type")
+	if !ok {
+		key = "Content-Type"
+	}
+	headers = withHeader(headers, key, contentType)
+
+	return httpReq(FormatJSON, "", method, urlString, token, body, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+// binaryField is a form field holding bytes, see WithBinaryField.
+type binaryField struct {
+	key         string
+	value       []byte
+	contentType string
+}
+
+// WithBinaryField adds a field holding value to multipart uploads. Its part has
+// no filename, so that servers don't take it for an uploaded file. Binary fields
+// follow the text fields, in the order they were given, and precede the file.
+// contentType defaults to application/octet-stream.
+func WithBinaryField(key string, value []byte, contentType string) Option {
+	return func(o *options) {
+		o.binaryFields = append(o.binaryFields, binaryField{key: key, value: value, contentType: contentType})
+	}
+}
+
+// WithMultipartBoundary sets the boundary of multipart uploads instead of a
+// random one, so that identical uploads send identical bodies. RFC 2046 allows
+// 1 to 70 characters.
+func WithMultipartBoundary(boundary string) Option {
+	if err := multipart.NewWriter(ioutil.Discard).SetBoundary(boundary); err != nil {
+		return func(o *options) {
+			o.optionErr = fmt.Errorf("multipart boundary %q: %w", boundary, err)
+		}
+	}
+
+	return func(o *options) {
+		o.boundary = boundary
+	}
+}
+
+// WithFieldOrder sends the text fields of multipart uploads named by keys
+// first, in that order. The other fields follow sorted by key, as all of them
+// are by default.
+func WithFieldOrder(keys ...string) Option {
+	return func(o *options) {
+		o.fieldOrder = keys
+	}
+}
+
+// multipartForm is what a multipart upload sends besides the content of the file.
+type multipartForm struct {
+	texts  map[string]string
+	order  []string
+	fields []binaryField
+	file   FileItem
+}
+
+// textKeys orders the text fields as WithFieldOrder says. The order never
+// depends on the map, so that every attempt of a streamed body writes the same
+// bytes.
+func (f multipartForm) textKeys() []string {
+	keys := make([]string, 0, len(f.texts))
+	listed := make(map[string]bool, len(f.order))
+	for _, k := range f.order {
+		if _, ok := f.texts[k]; ok && !listed[k] {
+			keys = append(keys, k)
+			listed[k] = true
+		}
+	}
+
+	rest := make([]string, 0, len(f.texts)-len(keys))
+	for k := range f.texts {
+		if !listed[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+func writeMultipart(writer *multipart.Writer, form multipartForm, content io.Reader) error {
+	for _, k := range form.textKeys() {
+		if err := writer.WriteField(k, form.texts[k]); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range form.fields {
+		contentType := field.contentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, formDataEscaper.Replace(field.key)))
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err = part.Write(field.value); err != nil {
+			return err
+		}
+	}
+
+	fileWriter, err := createFilePart(writer, form.file)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(fileWriter, content); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// formDataEscaper escapes the values of Content-Disposition as browsers do:
+// RFC 7578 rules filename* out, so non-ASCII names are sent as UTF-8.
+var formDataEscaper = strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A")
+
+// createFilePart starts the part of file, with its Content-Type and Headers.
+func createFilePart(writer *multipart.Writer, file FileItem) (io.Writer, error) {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, formDataEscaper.Replace(file.Key), formDataEscaper.Replace(file.FileName)))
+	header.Set("Content-Type", contentType)
+	for key, values := range file.Headers {
+		header[textproto.CanonicalMIMEHeaderKey(key)] = values
+	}
+	return writer.CreatePart(header)
+}
+
+// newMultipartStream builds the body of a streamed upload. Its length is known
+// when the size of the file is: always for Path, for readers which can seek or
+// report their Len.
+func newMultipartStream(form multipartForm, boundary string) (stream *streamBody, err error) {
+	paramFile := form.file
+
+	var open func() (io.Reader, error)
+	size := int64(-1)
+	replayable := true
+
+	if paramFile.Path != "" {
+		info, err := os.Stat(paramFile.Path)
+		if err != nil {
+			return nil, err
+		}
+		size = info.Size()
+		open = func() (io.Reader, error) { return os.Open(paramFile.Path) }
+	} else {
+		if size, err = readerSize(paramFile.Reader); err != nil {
+			return nil, err
+		}
+		if open, replayable, err = rewinder(paramFile.Reader); err != nil {
+			return nil, err
+		}
+	}
+
+	write := func(w io.Writer, content io.Reader) error {
+		writer := multipart.NewWriter(w)
+		writer.SetBoundary(boundary)
+		return writeMultipart(writer, form, content)
+	}
+
+	length := int64(-1)
+	if size >= 0 {
+		framing := &countingWriter{}
+		if err = write(framing, bytes.NewReader(nil)); err != nil {
+			return nil, err
+		}
+		length = framing.n + size
+	}
+
+	stream = &streamBody{
+		replayable: replayable,
+		length:     length,
+		open: func() (io.ReadCloser, error) {
+			content, err := open()
+			if err != nil {
+				return nil, err
+			}
+
+			pr, pw := io.Pipe()
+			go func() {
+				err := write(pw, content)
+				if closer, ok := content.(*os.File); ok {
+					closer.Close()
+				}
+				// a reader error aborts the request, closing pr stops the writer
+				pw.CloseWithError(err)
+			}()
+			return pr, nil
+		},
+	}
+	return stream, nil
+}
+
+// readerSize returns the bytes left in r, -1 when unknown.
+func readerSize(r io.Reader) (int64, error) {
+	switch r := r.(type) {
+	case io.Seeker:
+		current, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1, err
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1, err
+		}
+		if _, err = r.Seek(current, io.SeekStart); err != nil {
+			return -1, err
+		}
+		return end - current, nil
+	case interface{ Len() int }:
+		return int64(r.Len()), nil
+	}
+	return -1, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
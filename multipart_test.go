@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultipartLeavesCallerHeadersAlone(t *testing.T) {
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+
+	headers := map[string]string{"content-type": "text/plain"}
+	file := FileItem{Key: "file", FileName: "a.txt", Reader: strings.NewReader("data")}
+	if _, _, err := HttpReqPostFile(srv.URL, nil, file, headers, nil, nil, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(contentType, "multipart/form-data; boundary=") {
+		t.Errorf("sent Content-Type %q", contentType)
+	}
+	if len(headers) != 1 || headers["content-type"] != "text/plain" {
+		t.Errorf("the caller's headers became %v", headers)
+	}
+}
+
+func TestMultipartBodyIsReproducible(t *testing.T) {
+	var sums [][sha256.Size]byte
+	var contentTypes []string
+	var first string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if first == "" {
+			first = string(body)
+		}
+		sums = append(sums, sha256.Sum256(body))
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+	}))
+	defer srv.Close()
+
+	texts := map[string]string{"b": "2", "a": "1", "signature": "x", "c": "3"}
+	opts := []Option{WithMultipartBoundary("fixed-boundary"), WithFieldOrder("signature", "c")}
+	files := []FileItem{
+		{Key: "file", FileName: "a.txt", Content: []byte("file content")},
+		{Key: "file", FileName: "a.txt", Content: []byte("file content")},
+		// streamed through a pipe instead of buffered
+		{Key: "file", FileName: "a.txt", Reader: strings.NewReader("file content")},
+	}
+	for _, file := range files {
+		if _, _, err := HttpReqPostFile(srv.URL, texts, file, nil, nil, nil, 5, nil, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < len(sums); i++ {
+		if sums[i] != sums[0] {
+			t.Errorf("request %d sent a different body", i)
+		}
+	}
+	last := -1
+	for _, name := range []string{"signature", "c", "a", "b", "file"} {
+		at := strings.Index(first, `name="`+name+`"`)
+		if at < last {
+			t.Errorf("field %s is out of order in\n%s", name, first)
+		}
+		last = at
+	}
+	if contentTypes[0] != "multipart/form-data; boundary=fixed-boundary" {
+		t.Errorf("sent Content-Type %q", contentTypes[0])
+	}
+}
+
+func TestBinaryFieldsHaveNoFilename(t *testing.T) {
+	var parts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			value, _ := ioutil.ReadAll(part)
+			parts = append(parts, part.Header.Get("Content-Disposition")+"; "+part.Header.Get("Content-Type")+"; "+string(value))
+		}
+	}))
+	defer srv.Close()
+
+	texts := map[string]string{"b": "2", "a": "1"}
+	file := FileItem{Key: "f", FileName: "f.txt", Reader: strings.NewReader("file")}
+	_, _, err := HttpReqPostFile(srv.URL, texts, file, nil, nil, nil, 5, nil,
+		WithBinaryField("payload", []byte{1, 2}, "application/x-protobuf"),
+		WithBinaryField("raw", []byte("r"), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`form-data; name="a"; ; 1`,
+		`form-data; name="b"; ; 2`,
+		`form-data; name="payload"; application/x-protobuf; ` + "\x01\x02",
+		`form-data; name="raw"; application/octet-stream; r`,
+		`form-data; name="f"; filename="f.txt"; application/octet-stream; file`,
+	}
+	if strings.Join(parts, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent parts\n%q\nwant\n%q", parts, want)
+	}
+}
+
+func TestStreamedBodyIsClosedWhenNotSent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the first request takes the only token of the limiter
+	limit := WithRateLimit(0.001, 1)
+	if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, limit); err != nil {
+		t.Fatal(err)
+	}
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	file := FileItem{Key: "file", FileName: "big.bin", Reader: bytes.NewReader(make([]byte, 1<<20))}
+	_, _, err := HttpReqPostFile(srv.URL, nil, file, nil, nil, nil, 5, nil, limit, WithContext(ctx), WithCompressRequest(1, 0))
+	if err == nil {
+		t.Fatal("the limiter let the request through")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("%d goroutines left running:\n%s", n-before, buf[:runtime.Stack(buf, true)])
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxLineSize bounds the records of HttpReqNDJSON, see WithMaxLineSize.
+const defaultMaxLineSize = 1 << 20
+
+// WithMaxLineSize sets the longest line HttpReqNDJSON and Subscribe accept, 1MB
+// by default.
+func WithMaxLineSize(n int) Option {
+	return func(o *options) {
+		o.maxLineSize = n
+	}
+}
+
+// HttpReqNDJSON decodes a newline delimited JSON response record by record
+// while it is read: each line goes into a fresh value of newRecord, which is
+// passed to onRecord. Blank lines are skipped. An error of onRecord, returned
+// in a WriteError, or the end of ctx stop reading and close the body. There
+// is no default timeout, ctx bounds the request. A line which doesn't decode
+// fails with a DecodeError giving its number.
+func HttpReqNDJSON(ctx context.Context, method, urlString string, body []byte, newRecord func() interface{}, onRecord func(interface{}) error, opts ...Option) (httpStatus int, records int, err error) {
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx), withoutTimeout())
+	o := newOptions(opts)
+
+	maxLineSize := o.maxLineSize
+	if maxLineSize <= 0 {
+		maxLineSize = defaultMaxLineSize
+	}
+
+	consume := func(response *http.Response, body io.Reader) error {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+
+		decodeErr := func(line int, err error) *DecodeError {
+			return &DecodeError{
+				ContentType: response.Header.Get("Content-Type"),
+				HTTPCode:    response.StatusCode,
+				Line:        line,
+				Err:         err,
+			}
+		}
+
+		line := 0
+		for scanner.Scan() {
+			line++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if line == 1 {
+				data = bytes.TrimPrefix(data, utf8BOM)
+			}
+			if len(data) == 0 {
+				continue
+			}
+
+			record := newRecord()
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			if o.useNumber {
+				decoder.UseNumber()
+			}
+			if err := decoder.Decode(record); err != nil {
+				return decodeErr(line, err)
+			}
+			if decoder.More() {
+				return decodeErr(line, fmt.Errorf("invalid data after the JSON value"))
+			}
+
+			if err := onRecord(record); err != nil {
+				return err
+			}
+			records++
+		}
+
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return decodeErr(line+1, fmt.Errorf("line longer than %d bytes", maxLineSize))
+			}
+			return err
+		}
+		return nil
+	}
+
+	headers := map[string]string{"Accept": "application/x-ndjson"}
+	if len(body) != 0 {
+		headers["Content-Type"] = "application/json"
+	}
+
+	method = strings.TrimSpace(strings.ToUpper(method))
+	httpStatus, _, err = httpDownload(method, urlString, "", body, &download{consume: consume}, headers, nil, nil, 0, opts)
+	return httpStatus, records, err
+}
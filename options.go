@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option tunes a single request. Options passed to NewClient are applied to
+// every request made through that Client before the per-request ones.
+type Option func(*options)
+
+type options struct {
+	client *Client
+	info   *ResponseInfo
+	ctx    context.Context
+	jar    http.CookieJar
+
+	retry   *RetryPolicy
+	retryIf RetryPredicate
+
+	retryNonIdempotent bool
+	onRetry            func(info RetryInfo)
+
+	baseURLs       []string
+	failoverStatus map[int]struct{}
+	balancer       *balancer
+
+	pollFactor      float64
+	pollMaxInterval time.Duration
+	pollMaxAttempts int
+
+	longPollTimeout time.Duration
+	longPollBackoff time.Duration
+	longPollMaxWait time.Duration
+
+	maxPages int
+	pagePOST bool
+	pageBody []byte
+
+	pingHead bool
+	pingBody *string
+
+	// truncateBody silently stops reading the body after that many bytes.
+	truncateBody int64
+
+	maxResponseBytes int64
+	partialBody      bool
+	spill            *spill
+	download         *download
+	stream           *streamBody
+	chunked          bool
+	expectContinue   time.Duration
+	expectFailed     bool
+	compress         *compression
+	compressed       bool
+	compressedBody   []byte
+	rawEncoding      bool
+	acceptEncoding   string
+	encodings        map[string]struct{}
+	noTimeout        bool
+	rangeChunks      int
+	resumeProgress   func(done, total int64)
+	checksum         *checksum
+	sinceFile        bool
+	lastModified     string
+	contentMD5       bool
+	digestAlgorithms []string
+	digestHeaders    map[string]string
+	progress         *progress
+	transport        *http.Transport
+	dnsCache         *DNSCache
+	resolveOverrides map[string]string
+	ipPreference     IPPreference
+	phaseTimeouts    PhaseTimeouts
+	timings          *Timings
+	authorization    string
+	digest           *[2]string
+	tokenSource      TokenSource
+	tokenRetry       bool
+	tokenRetried     bool
+	sourceToken      string
+	signer           RequestSigner
+	signBody         []byte
+	rootCAs          *x509.CertPool
+	rootCAsKey       string
+	insecureTLS      bool
+	tlsMinVersion    uint16
+	tlsMaxVersion    uint16
+	cipherSuites     []uint16
+	proxyMode        proxyMode
+	proxyURL         *url.URL
+	proxyBypass      []string
+	unixSocket       string
+	protocols        protocolMode
+	csv              csvConfig
+	maxLineSize      int
+	jsonArrayPath    []string
+	sseBackoff       time.Duration
+	sseMaxWait       time.Duration
+	sseMaxReconnects int
+	graphQLOperation string
+	persistedQuery   bool
+	soap12           bool
+	binaryFields     []binaryField
+	boundary         string
+	fieldOrder       []string
+	overrideHeader   string
+	overrideParam    string
+	trailers         []trailer
+	optionErr        error
+
+	buffer  *bytes.Buffer
+	release *func()
+
+	singleflight map[string]struct{}
+
+	limiter *rateLimiter
+	slots   chan struct{}
+
+	idempotencyKey    *string
+	idempotencyHeader string
+
+	mode        *EnforcementMode
+	ruleModes   map[Rule]EnforcementMode
+	onViolation func(Violation)
+	callSite    string
+
+	requireHTTPS   bool
+	allowedHosts   map[string]struct{}
+	blockPrivate   bool
+	strictDeadline time.Duration
+
+	acceptStatus  map[int]struct{}
+	successStatus func(status int) bool
+
+	errorStruct interface{}
+	snippetSize *int
+	useNumber   bool
+	autoDefault Format
+
+	charsetReader CharsetReader
+	noTranscode   bool
+
+	forceContentType bool
+	addedHeaders     []headerValue
+	rawHeaders       []headerValue
+	noDefaultAccept  bool
+
+	noRedirects  bool
+	maxRedirects *int
+	redirectAuth *[2]bool
+
+	rawQuery     bool
+	encodeQuery  bool
+	extraMethods map[string]struct{}
+
+	etagCache     CacheStore
+	responseCache *ResponseCache
+	forceRefresh  bool
+}
+
+func newOptions(opts []Option) *options {
+	o := applyOptions(nil, opts)
+	if o.client == nil {
+		o.client = defaultClient
+	}
+
+	if len(o.client.opts) != 0 {
+		client := o.client
+		o = applyOptions(client.opts, opts)
+		o.client = client
+	}
+
+	if o.info == nil {
+		o.info = &ResponseInfo{}
+	}
+	return o
+}
+
+func applyOptions(defaults, opts []Option) *options {
+	o := &options{}
+	for _, opt := range defaults {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// WithClient sends the request through c, applying its options and sharing its state.
+func WithClient(c *Client) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
+
+// WithContext sends the request with ctx, which also interrupts retry waits.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// callHook runs a caller supplied hook, turning a panic into an entry of
+// ResponseInfo.HookErrors.
+func (o *options) callHook(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			o.info.HookErrors = append(o.info.HookErrors, fmt.Errorf("%s hook panicked: %v", name, r))
+		}
+	}()
+	fn()
+}
+
+func (o *options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
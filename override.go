@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+)
+
+const defaultMethodOverrideHeader = "X-HTTP-Method-Override"
+
+// WithMethodOverride sends requests whose method is neither GET nor POST as
+// POST, naming the method in header, X-HTTP-Method-Override when empty, for
+// gateways which only let GET and POST through. Validation, retries and
+// idempotency keys go by the method given, while signers and digest
+// authentication see the POST actually sent, override header included.
+func WithMethodOverride(header string) Option {
+	if header == "" {
+		header = defaultMethodOverrideHeader
+	}
+	return func(o *options) {
+		o.overrideHeader, o.overrideParam = header, ""
+	}
+}
+
+// WithMethodOverrideParam is WithMethodOverride naming the method in the query
+// parameter name instead, such as "_method", for frameworks reading it from the
+// request parameters.
+func WithMethodOverrideParam(name string) Option {
+	return func(o *options) {
+		o.overrideHeader, o.overrideParam = "", name
+	}
+}
+
+// applyMethodOverride tunnels the method of the request through POST.
+func (o *options) applyMethodOverride(request *http.Request) {
+	if o.overrideHeader == "" && o.overrideParam == "" {
+		return
+	}
+	if request.Method == http.MethodGet || request.Method == http.MethodPost {
+		return
+	}
+
+	method := request.Method
+	request.Method = http.MethodPost
+	if o.overrideHeader != "" {
+		request.Header.Set(o.overrideHeader, method)
+		return
+	}
+
+	query := request.URL.RawQuery
+	if query != "" {
+		query += "&"
+	}
+	request.URL.RawQuery = query + url.QueryEscape(o.overrideParam) + "=" + url.QueryEscape(method)
+}
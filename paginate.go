@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultMaxPages bounds the pages of Paginate without WithMaxPages.
+const defaultMaxPages = 1000
+
+// ErrStopPagination is returned by a Paginate or PaginateJSON callback to end
+// it cleanly.
+var ErrStopPagination = errors.New("stop pagination")
+
+// ErrPageLimit is returned by Paginate and PaginateJSON when WithMaxPages is
+// reached while there are more pages.
+var ErrPageLimit = errors.New("page limit reached")
+
+// ErrRepeatedPage is returned by Paginate and PaginateJSON when the next page is
+// one already fetched, which would loop forever.
+var ErrRepeatedPage = errors.New("pagination repeats a page")
+
+// WithMaxPages sets how many pages Paginate and PaginateJSON fetch at most, 1000
+// by default.
+func WithMaxPages(n int) Option {
+	return func(o *options) {
+		o.maxPages = n
+	}
+}
+
+// Link is a link of a Link header (RFC 8288).
+type Link struct {
+	URL string
+	// Rel holds the relation types, lower case.
+	Rel    []string
+	Params map[string]string
+}
+
+// HasRel reports whether the link has the relation type rel.
+func (l Link) HasRel(rel string) bool {
+	for _, r := range l.Rel {
+		if r == strings.ToLower(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLinks returns the links of the Link headers of header, skipping the
+// malformed ones. Their URLs are as sent, possibly relative.
+func ParseLinks(header http.Header) (links []Link) {
+	for _, value := range header.Values("Link") {
+		for value = strings.TrimSpace(value); strings.HasPrefix(value, "<"); {
+			end := strings.IndexByte(value, '>')
+			if end < 0 {
+				break
+			}
+			link := Link{URL: strings.TrimSpace(value[1:end]), Params: make(map[string]string)}
+
+			var params string
+			params, value = splitLink(value[end+1:])
+			for _, param := range splitQuoted(params, ';') {
+				name, paramValue := param, ""
+				if i := strings.IndexByte(param, '='); i >= 0 {
+					name, paramValue = param[:i], unquoteParam(strings.TrimSpace(param[i+1:]))
+				}
+				if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+					continue
+				}
+				if _, ok := link.Params[name]; !ok {
+					link.Params[name] = paramValue
+				}
+			}
+			link.Rel = strings.Fields(strings.ToLower(link.Params["rel"]))
+
+			links = append(links, link)
+			value = strings.TrimSpace(value)
+		}
+	}
+	return links
+}
+
+// splitLink splits the parameters of a link from the links following it.
+func splitLink(value string) (params, rest string) {
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			return value[:i], value[i+1:]
+		}
+	}
+	return value, ""
+}
+
+// splitQuoted splits value at the separators outside quoted strings.
+func splitQuoted(value string, separator byte) (parts []string) {
+	quoted, start := false, 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == separator && !quoted:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// Paginate sends GET requests to firstURL and then to the rel="next" link of
+// each response, resolved against the URL of the page, until a response has
+// none. onPage sees every page; its error ends Paginate and is returned unless
+// it is ErrStopPagination. Statuses which are not successful end it with a
+// ResourceError. Each page is a request of its own, so that WithRateLimit and
+// WithRetry apply to every one. It returns the number of pages fetched.
+func Paginate(ctx context.Context, firstURL string, onPage func(status int, body []byte, headers http.Header) error, opts ...Option) (pages int, err error) {
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx))
+	o := newOptions(opts)
+
+	maxPages := o.maxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	visited := make(map[string]bool)
+	for pageURL := firstURL; pageURL != ""; pages++ {
+		if pages == maxPages {
+			return pages, ErrPageLimit
+		}
+		if visited[pageURL] {
+			return pages, ErrRepeatedPage
+		}
+		visited[pageURL] = true
+
+		if err = ctx.Err(); err != nil {
+			return pages, o.classify(&ResourceError{URL: pageURL, Err: err})
+		}
+
+		// options hold the state of a request, such as a refreshed token
+		page := newOptions(opts)
+		status, body, err := sendHttpReq(page, "GET", pageURL, "", nil, nil, nil, nil, 0)
+		if err != nil {
+			return pages, err
+		}
+		header := page.info.Header
+
+		if err = onPage(status, body, header); err != nil {
+			if err == ErrStopPagination {
+				err = nil
+			}
+			return pages + 1, err
+		}
+
+		next, err := nextLink(pageURL, header)
+		if err != nil {
+			return pages + 1, &ResourceError{URL: pageURL, Err: err, Message: "next link: " + err.Error()}
+		}
+		pageURL = next
+	}
+	return pages, nil
+}
+
+// nextLink returns the rel="next" link of header resolved against pageURL,
+// empty when there is none.
+func nextLink(pageURL string, header http.Header) (string, error) {
+	for _, link := range ParseLinks(header) {
+		if !link.HasRel("next") {
+			continue
+		}
+
+		base, err := url.Parse(pageURL)
+		if err != nil {
+			return "", err
+		}
+		next, err := base.Parse(link.URL)
+		if err != nil {
+			return "", err
+		}
+		return next.String(), nil
+	}
+	return "", nil
+}
+
+// WithPaginationPOST makes PaginateJSON send POST requests with body, a JSON
+// object, instead of GET requests. The parameters of the next page are set as
+// string members of the object rather than in the query string.
+func WithPaginationPOST(body []byte) Option {
+	return func(o *options) {
+		o.pagePOST = true
+		o.pageBody = body
+	}
+}
+
+// PaginateJSON sends GET requests to urlString, passing each response to onPage
+// and then to extractNext, which gives the parameters of the next page, such as
+// a cursor or an offset, or reports done. They are set in the query string of
+// urlString for the next request. Errors of onPage and extractNext end
+// PaginateJSON and are returned, unless it is ErrStopPagination. Parameters
+// given twice end it with ErrRepeatedPage. It returns the number of pages
+// fetched.
+func PaginateJSON(ctx context.Context, urlString string, extractNext func(body []byte) (nextParams map[string]string, done bool, err error), onPage func(body []byte) error, opts ...Option) (pages int, err error) {
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx))
+	o := newOptions(opts)
+
+	maxPages := o.maxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	base, err := url.Parse(urlString)
+	if err != nil {
+		return 0, &ResourceError{URL: urlString, Err: err}
+	}
+
+	method := "GET"
+	if o.pagePOST {
+		method = "POST"
+	}
+	headers := o.withAccept(nil, FormatJSON)
+
+	var params map[string]string
+	seen := map[string]bool{"": true}
+	for ; ; pages++ {
+		if pages == maxPages {
+			return pages, ErrPageLimit
+		}
+
+		pageURL, body, err := o.pageRequest(base, params)
+		if err != nil {
+			return pages, &ResourceError{URL: urlString, Err: err, Message: "next page: " + err.Error()}
+		}
+		if err = ctx.Err(); err != nil {
+			return pages, o.classify(&ResourceError{URL: pageURL, Err: err})
+		}
+
+		page := newOptions(opts)
+		_, body, err = sendHttpReq(page, method, pageURL, "", body, page.withContentType(headers, method, body, "application/json"), nil, nil, 0)
+		if err != nil {
+			return pages, err
+		}
+
+		if err = onPage(body); err != nil {
+			if err == ErrStopPagination {
+				err = nil
+			}
+			return pages + 1, err
+		}
+
+		next, done, err := extractNext(body)
+		if err != nil || done {
+			if err == ErrStopPagination {
+				err = nil
+			}
+			return pages + 1, err
+		}
+
+		key := url.Values{}
+		for k, v := range next {
+			key.Set(k, v)
+		}
+		if seen[key.Encode()] {
+			return pages + 1, ErrRepeatedPage
+		}
+		seen[key.Encode()] = true
+		params = next
+	}
+}
+
+// pageRequest returns the URL and the body of the page of params.
+func (o *options) pageRequest(base *url.URL, params map[string]string) (pageURL string, body []byte, err error) {
+	if !o.pagePOST {
+		if len(params) == 0 {
+			return base.String(), nil, nil
+		}
+
+		u := *base
+		query := u.Query()
+		for k, v := range params {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil, nil
+	}
+
+	if len(params) == 0 {
+		return base.String(), o.pageBody, nil
+	}
+
+	object := make(map[string]json.RawMessage)
+	if len(o.pageBody) != 0 {
+		if err = json.Unmarshal(o.pageBody, &object); err != nil {
+			return base.String(), nil, err
+		}
+	}
+	for k, v := range params {
+		value, _ := json.Marshal(v)
+		object[k] = value
+	}
+	body, err = json.Marshal(object)
+	return base.String(), body, err
+}
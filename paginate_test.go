@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rotatingTokens hands out t1, t2... moving on when a token is invalidated.
+type rotatingTokens struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (s *rotatingTokens) Token(context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return "t" + strconv.Itoa(s.n+1), nil
+}
+
+func (s *rotatingTokens) Invalidate(string) {
+	s.mu.Lock()
+	s.n++
+	s.mu.Unlock()
+}
+
+func TestPaginateRefreshesTokenOnEveryPage(t *testing.T) {
+	var mu sync.Mutex
+	valid := "t1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		mu.Lock()
+		defer mu.Unlock()
+		// the token expires before pages 2 and 4
+		if (page == 2 && valid == "t1") || (page == 4 && valid == "t2") {
+			valid = "t" + strconv.Itoa(page/2+1)
+		}
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if page < 5 {
+			w.Header().Set("Link", fmt.Sprintf(`<?page=%d>; rel="next"`, page+1))
+		}
+	}))
+	defer srv.Close()
+
+	pages, err := Paginate(context.Background(), srv.URL+"?page=1", func(int, []byte, http.Header) error {
+		return nil
+	}, WithTokenSource(&rotatingTokens{}, true))
+	if err != nil || pages != 5 {
+		t.Fatalf("got %d pages, %v", pages, err)
+	}
+}
+
+func TestPaginateJSONCompressesEachPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ = ioutil.ReadAll(zr)
+		} else {
+			body, _ = ioutil.ReadAll(r.Body)
+		}
+
+		var in struct{ Cursor string }
+		json.Unmarshal(body, &in)
+		n := len(in.Cursor)
+		next := ""
+		if n < 3 {
+			next = strings.Repeat("x", n+1)
+		}
+		fmt.Fprintf(w, `{"page":%d,"next":%q}`, n, next)
+	}))
+	defer srv.Close()
+
+	var got []int
+	// the first page is compressed, the next ones are under the threshold
+	first := []byte(`{"padding":"` + strings.Repeat("p", 64) + `"}`)
+	pages, err := PaginateJSON(context.Background(), srv.URL, func(body []byte) (map[string]string, bool, error) {
+		var page struct{ Next string }
+		err := json.Unmarshal(body, &page)
+		return map[string]string{"cursor": page.Next, "padding": ""}, page.Next == "", err
+	}, func(body []byte) error {
+		var page struct{ Page int }
+		err := json.Unmarshal(body, &page)
+		got = append(got, page.Page)
+		return err
+	}, WithPaginationPOST(first), WithCompressRequest(gzip.BestSpeed, 64))
+	if err != nil || pages != 4 || fmt.Sprint(got) != "[0 1 2 3]" {
+		t.Fatalf("got %d pages %v, %v", pages, got, err)
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResponsePart is a part of a multipart response.
+type ResponsePart struct {
+	Headers     http.Header
+	ContentType string
+	Body        []byte
+}
+
+// Decode unmarshals the body of the part in the format named by its
+// Content-Type, such as JSON or XML.
+func (p ResponsePart) Decode(v interface{}) error {
+	format, ok := formatFor(p.ContentType)
+	if !ok {
+		return fmt.Errorf("no decoder for the part content type %q", p.ContentType)
+	}
+	return newOptions(nil).unmarshal(format, p.Body, v)
+}
+
+// HttpReqMultipart returns the parts of a multipart response, such as
+// multipart/mixed or multipart/related. WithMaxResponseBytes applies to each
+// part rather than to the whole body.
+func HttpReqMultipart(method, urlString string, body []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, parts []ResponsePart, err error) {
+	o := newOptions(opts)
+
+	httpStatus, err = HttpReqMultipartFunc(method, urlString, body, func(part *multipart.Part) error {
+		data, err := o.readPart(part)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, ResponsePart{
+			Headers:     http.Header(part.Header),
+			ContentType: part.Header.Get("Content-Type"),
+			Body:        data,
+		})
+		return nil
+	}, headers, cookie, transport, timeout, opts...)
+	return
+}
+
+// HttpReqMultipartFunc calls fn with each part of a multipart response while it
+// is read, without buffering the body. The part is only valid until fn returns.
+// An error of fn stops reading and is returned in a WriteError. A response
+// which is not multipart fails with a DecodeError.
+func HttpReqMultipartFunc(method, urlString string, body []byte, fn func(part *multipart.Part) error, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, err error) {
+	if _, ok := headerKey(headers, "Accept"); !ok {
+		headers = withHeader(headers, "Accept", "multipart/mixed, multipart/related")
+	}
+
+	consume := func(response *http.Response, body io.Reader) error {
+		decodeErr := func(err error) *DecodeError {
+			return &DecodeError{
+				ContentType: response.Header.Get("Content-Type"),
+				HTTPCode:    response.StatusCode,
+				Err:         err,
+			}
+		}
+
+		mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+		if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+			return decodeErr(errors.New("the response is not multipart"))
+		}
+
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return decodeErr(err)
+			}
+
+			err = fn(part)
+			part.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	method = strings.TrimSpace(strings.ToUpper(method))
+	httpStatus, _, err = httpDownload(method, urlString, "", body, &download{consume: consume}, headers, cookie, transport, timeout, opts)
+	return httpStatus, err
+}
+
+// readPart reads a part applying WithMaxResponseBytes.
+func (o *options) readPart(part io.Reader) ([]byte, error) {
+	limit := o.maxResponseBytes
+	if limit <= 0 {
+		return ioutil.ReadAll(part)
+	}
+
+	limited := &io.LimitedReader{R: part, N: limit + 1}
+	buf, err := ioutil.ReadAll(limited)
+	if err != nil || limited.N > 0 {
+		return buf, err
+	}
+
+	tooLarge := &ResponseTooLargeError{Limit: limit, Read: int64(len(buf)), ContentLength: -1}
+	if err = o.enforce(RuleMaxResponseSize, strconv.FormatInt(tooLarge.Read, 10)+"+", tooLarge); err != nil {
+		return nil, err
+	}
+
+	// only warned about, so the rest is read after all
+	rest, err := ioutil.ReadAll(part)
+	return append(buf, rest...), err
+}
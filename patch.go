@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PatchOp is an operation of a JSON Patch (RFC 6902).
+type PatchOp struct {
+	// Op is one of add, remove, replace, move, copy and test.
+	Op   string
+	Path string
+	// Value is the value of add, replace and test, sent even when nil.
+	Value interface{}
+	// From is the source of move and copy.
+	From string
+}
+
+// MarshalJSON sends value and from only with the operations taking them.
+func (p PatchOp) MarshalJSON() ([]byte, error) {
+	op := struct {
+		Op    string       `json:"op"`
+		Path  string       `json:"path"`
+		Value *interface{} `json:"value,omitempty"`
+		From  *string      `json:"from,omitempty"`
+	}{Op: p.Op, Path: p.Path}
+
+	switch p.Op {
+	case "add", "replace", "test":
+		op.Value = &p.Value
+	case "move", "copy":
+		op.From = &p.From
+	}
+	return json.Marshal(op)
+}
+
+func (p PatchOp) validate() error {
+	switch p.Op {
+	case "add", "replace", "test", "remove":
+	case "move", "copy":
+		if err := validatePointer(p.From); err != nil {
+			return fmt.Errorf("%s from: %w", p.Op, err)
+		}
+	default:
+		return fmt.Errorf("unknown patch operation %q", p.Op)
+	}
+
+	if err := validatePointer(p.Path); err != nil {
+		return fmt.Errorf("%s path: %w", p.Op, err)
+	}
+	return nil
+}
+
+// validatePointer checks the syntax of a JSON Pointer (RFC 6901).
+func validatePointer(pointer string) error {
+	if pointer != "" && !strings.HasPrefix(pointer, "/") {
+		return fmt.Errorf("JSON pointer %q doesn't start with /", pointer)
+	}
+	for i := 0; i < len(pointer); i++ {
+		if pointer[i] == '~' && (i+1 == len(pointer) || (pointer[i+1] != '0' && pointer[i+1] != '1')) {
+			return fmt.Errorf("JSON pointer %q has an invalid ~ escape", pointer)
+		}
+	}
+	return nil
+}
+
+// HttpReqMergePatch sends patch as a JSON Merge Patch (RFC 7396), with the
+// Content-Type application/merge-patch+json. A []byte patch is sent as is. The
+// response is handled as HttpReqJSON handles it.
+func HttpReqMergePatch(urlString string, patch interface{}, responseStruct interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	body, ok := patch.([]byte)
+	if !ok {
+		if body, err = json.Marshal(patch); err != nil {
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+		}
+	}
+	return httpReq(FormatJSON, "application/merge-patch+json", "PATCH", urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+// HttpReqJSONPatch sends ops as a JSON Patch (RFC 6902), with the Content-Type
+// application/json-patch+json. Unknown operations and malformed paths fail
+// before anything is sent. The response is handled as HttpReqJSON handles it.
+func HttpReqJSONPatch(urlString string, ops []PatchOp, responseStruct interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	for i, op := range ops {
+		if err = op.validate(); err != nil {
+			err = fmt.Errorf("patch operation %d: %w", i, err)
+			return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+		}
+	}
+
+	if ops == nil {
+		ops = []PatchOp{}
+	}
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+	}
+	return httpReq(FormatJSON, "application/json-patch+json", "PATCH", urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// PhaseTimeouts bound the phases of a request, on top of its overall timeout.
+// Zero leaves a phase to the transport settings. BodyIdle is the longest wait
+// for the next bytes of the response body.
+type PhaseTimeouts struct {
+	Dial           time.Duration
+	TLSHandshake   time.Duration
+	ResponseHeader time.Duration
+	BodyIdle       time.Duration
+}
+
+// PhaseTimeoutError is the error of a request which exceeded one of its
+// PhaseTimeouts, found with errors.As. It is a net.Error timing out.
+type PhaseTimeoutError struct {
+	Phase string
+	Limit time.Duration
+	Err   error
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout of %v exceeded: %v", e.Phase, e.Limit, e.Err)
+}
+
+func (e *PhaseTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PhaseTimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *PhaseTimeoutError) Temporary() bool {
+	return true
+}
+
+// WithPhaseTimeouts sets timeouts for the phases of requests.
+func WithPhaseTimeouts(timeouts PhaseTimeouts) Option {
+	return func(o *options) {
+		o.phaseTimeouts = timeouts
+	}
+}
+
+// phaseTimeoutKey describes the transport level phase timeouts for the cache
+// of derived transports.
+func (o *options) phaseTimeoutKey() string {
+	t := o.phaseTimeouts
+	if t.Dial == 0 && t.TLSHandshake == 0 && t.ResponseHeader == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%v/%v/%v", t.Dial, t.TLSHandshake, t.ResponseHeader)
+}
+
+// timeoutDial bounds each connection attempt of dial by d.
+func timeoutDial(d time.Duration, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialCtx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		conn, err := dial(dialCtx, network, addr)
+		if err != nil && ctx.Err() == nil && dialCtx.Err() == context.DeadlineExceeded {
+			err = &PhaseTimeoutError{Phase: "connect", Limit: d, Err: err}
+		}
+		return conn, err
+	}
+}
+
+// phaseTimeoutError tells a TLS handshake or response header timeout of the
+// transport from other timeouts, by the time spent in the phase.
+func (o *options) phaseTimeoutError(t *phaseTracer, err error) error {
+	if !isTimeout(err) || o.context().Err() != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	tlsStart, tlsDone, wroteRequest, firstByte := t.tlsStart, t.tlsDone, t.wroteRequest, t.firstByte
+	t.mu.Unlock()
+
+	now := time.Now()
+	if d := o.phaseTimeouts.TLSHandshake; d > 0 && !tlsStart.IsZero() && tlsDone.IsZero() && now.Sub(tlsStart) >= d {
+		return &PhaseTimeoutError{Phase: "TLS handshake", Limit: d, Err: err}
+	}
+	if d := o.phaseTimeouts.ResponseHeader; d > 0 && !wroteRequest.IsZero() && firstByte.IsZero() && now.Sub(wroteRequest) >= d {
+		return &PhaseTimeoutError{Phase: "response header", Limit: d, Err: err}
+	}
+	return err
+}
+
+// idleTimeoutBody fails the reads of body once no bytes arrived for d, closing
+// closer to interrupt a blocked read.
+func (o *options) idleTimeoutBody(body io.Reader, closer io.Closer) io.Reader {
+	d := o.phaseTimeouts.BodyIdle
+	if d <= 0 {
+		return body
+	}
+
+	r := &idleTimeoutReader{r: body, d: d}
+	r.timer = time.AfterFunc(d, func() {
+		atomic.StoreInt32(&r.fired, 1)
+		closer.Close()
+	})
+	return r
+}
+
+type idleTimeoutReader struct {
+	r     io.Reader
+	d     time.Duration
+	timer *time.Timer
+	fired int32
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.timer.Stop()
+		if atomic.LoadInt32(&r.fired) == 1 {
+			err = &PhaseTimeoutError{Phase: "body read", Limit: r.d, Err: err}
+		}
+		return n, err
+	}
+
+	if n > 0 {
+		r.timer.Reset(r.d)
+	}
+	return n, nil
+}
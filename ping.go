@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+)
+
+// pingBodyLimit caps the part of a health endpoint body which is read.
+const pingBodyLimit = 4 << 10
+
+// WithPingHead makes Ping send HEAD instead of GET.
+func WithPingHead() Option {
+	return func(o *options) {
+		o.pingHead = true
+	}
+}
+
+// WithPingBody makes Ping report healthy only when the body contains substr.
+func WithPingBody(substr string) Option {
+	return func(o *options) {
+		o.pingBody = &substr
+	}
+}
+
+// Ping probes a health endpoint with GET. Any 2xx status is healthy, other
+// statuses are not an error unless WithSuccessStatus rejects them. The body is
+// never decoded and only its first few KB are read.
+func Ping(urlString string, timeout time.Duration, opts ...Option) (healthy bool, status int, latency time.Duration, err error) {
+	return ping(newOptions(opts), urlString, timeout)
+}
+
+// Ping probes path, resolved against the base URLs of the Client.
+func (c *Client) Ping(path string, timeout time.Duration, opts ...Option) (healthy bool, status int, latency time.Duration, err error) {
+	return ping(newOptions(append([]Option{WithClient(c)}, opts...)), path, timeout)
+}
+
+func ping(o *options, urlString string, timeout time.Duration) (healthy bool, status int, latency time.Duration, err error) {
+	method := "GET"
+	if o.pingHead {
+		method = "HEAD"
+	}
+
+	seconds := 0
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(o.context(), timeout)
+		defer cancel()
+
+		o.ctx = ctx
+		seconds = int(math.Ceil(timeout.Seconds()))
+	}
+
+	if o.successStatus == nil {
+		o.successStatus = func(int) bool { return true }
+	}
+	o.truncateBody = pingBodyLimit
+
+	start := time.Now()
+	status, body, err := sendHttpReq(o, method, urlString, "", nil, nil, nil, nil, seconds)
+	latency = time.Since(start)
+	if err != nil {
+		return false, status, latency, err
+	}
+
+	healthy = status >= 200 && status < 300
+	if healthy && o.pingBody != nil {
+		healthy = strings.Contains(string(body), *o.pingBody)
+	}
+	return healthy, status, latency, nil
+}
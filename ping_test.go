@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPingKeepsSuccessStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	healthy, status, _, err := Ping(srv.URL, time.Second)
+	if err != nil || healthy || status != http.StatusServiceUnavailable {
+		t.Errorf("got %v %d %v, want unhealthy without error", healthy, status, err)
+	}
+
+	below500 := WithSuccessStatus(func(status int) bool { return status < 500 })
+	_, _, _, err = Ping(srv.URL, time.Second, below500)
+	var resourceErr *ResourceError
+	if !errors.As(err, &resourceErr) || resourceErr.HTTPCode != http.StatusServiceUnavailable {
+		t.Errorf("got %v, want the ResourceError of the 503", err)
+	}
+}
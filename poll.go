@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrPollExhausted is returned by PollJSON when WithPollMaxAttempts is reached
+// before the job is done.
+var ErrPollExhausted = errors.New("poll attempts exhausted")
+
+// WithPollBackoff multiplies the PollJSON interval by factor after every
+// attempt, up to max when it is set.
+func WithPollBackoff(factor float64, max time.Duration) Option {
+	return func(o *options) {
+		o.pollFactor = factor
+		o.pollMaxInterval = max
+	}
+}
+
+// WithPollMaxAttempts stops PollJSON with ErrPollExhausted after n requests.
+func WithPollMaxAttempts(n int) Option {
+	return func(o *options) {
+		o.pollMaxAttempts = n
+	}
+}
+
+// PollJSON sends GET requests to urlString every interval until until reports
+// done or returns an error, which aborts polling and is returned as is. until
+// sees every response, whatever the status, unless WithSuccessStatus is given;
+// transport errors and the statuses it rejects end polling. The overall
+// deadline is the one of ctx.
+func PollJSON(ctx context.Context, urlString string, interval time.Duration, until func(status int, body []byte) (done bool, err error), opts ...Option) (status int, body []byte, err error) {
+	opts = append([]Option{WithContext(ctx)}, opts...)
+	o := newOptions(opts)
+
+	for attempt := 1; ; attempt++ {
+		// options hold the state of a request, such as a refreshed token
+		request := newOptions(opts)
+		if request.successStatus == nil {
+			request.successStatus = func(int) bool { return true }
+		}
+
+		headers := request.withAccept(nil, FormatJSON)
+		status, body, err = sendHttpReq(request, "GET", urlString, "", nil, headers, nil, nil, 0)
+		if err != nil {
+			return
+		}
+
+		done, untilErr := until(status, body)
+		if untilErr != nil || done {
+			return status, body, untilErr
+		}
+
+		if o.pollMaxAttempts > 0 && attempt >= o.pollMaxAttempts {
+			return status, body, ErrPollExhausted
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return status, body, o.classify(&ResourceError{URL: urlString, Err: ctx.Err(), HTTPCode: status})
+		}
+
+		if o.pollFactor > 1 {
+			interval = time.Duration(float64(interval) * o.pollFactor)
+			if o.pollMaxInterval > 0 && interval > o.pollMaxInterval {
+				interval = o.pollMaxInterval
+			}
+		}
+	}
+}
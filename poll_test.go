@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPollKeepsSuccessStatus(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"done":true}`))
+	}))
+	defer srv.Close()
+
+	var statuses []int
+	until := func(status int, body []byte) (bool, error) {
+		statuses = append(statuses, status)
+		return status == http.StatusOK, nil
+	}
+	status, _, err := PollJSON(context.Background(), srv.URL, time.Millisecond, until)
+	if err != nil || status != http.StatusOK {
+		t.Fatal(status, err)
+	}
+	if len(statuses) != 2 || statuses[0] != http.StatusInternalServerError {
+		t.Errorf("until saw %v, want every status", statuses)
+	}
+
+	requests, statuses = 0, nil
+	below500 := WithSuccessStatus(func(status int) bool { return status < 500 })
+	_, _, err = PollJSON(context.Background(), srv.URL, time.Millisecond, until, below500)
+	var resourceErr *ResourceError
+	if !errors.As(err, &resourceErr) || resourceErr.HTTPCode != http.StatusInternalServerError {
+		t.Errorf("got %v, want the ResourceError of the 500", err)
+	}
+	if len(statuses) != 0 {
+		t.Errorf("until saw %v", statuses)
+	}
+}
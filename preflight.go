@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OptionsInfo is what a server tells of a resource in answer to OPTIONS. The
+// CORS fields are only set by servers answering a preflight, see WithPreflight.
+type OptionsInfo struct {
+	// Allow lists the methods of the Allow header, none when it is empty.
+	Allow            []string
+	AllowOrigin      string
+	AllowMethods     []string
+	AllowHeaders     []string
+	AllowCredentials bool
+	// MaxAge is how long the preflight may be cached, 0 when not said.
+	MaxAge time.Duration
+}
+
+// WithPreflight sends the headers of a CORS preflight: the Origin, the method of
+// the request to come in Access-Control-Request-Method and its headers in
+// Access-Control-Request-Headers. Many servers only answer a preflight with
+// the Access-Control-Allow headers.
+func WithPreflight(origin, method string, headers ...string) Option {
+	return func(o *options) {
+		o.addedHeaders = append(o.addedHeaders,
+			headerValue{key: "Origin", value: origin},
+			headerValue{key: "Access-Control-Request-Method", value: method})
+		if len(headers) != 0 {
+			o.addedHeaders = append(o.addedHeaders, headerValue{key: "Access-Control-Request-Headers", value: strings.Join(headers, ", ")})
+		}
+	}
+}
+
+// HttpOptions sends an OPTIONS request and parses the Allow and CORS headers of
+// the response, which usually has the status 200 or 204 and no body.
+func HttpOptions(urlString string, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, info OptionsInfo, err error) {
+	o := newOptions(opts)
+	httpStatus, _, err = sendHttpReq(o, "OPTIONS", urlString, "", nil, headers, cookie, transport, timeout)
+	if err != nil {
+		return httpStatus, info, err
+	}
+
+	header := o.info.Header
+	info = OptionsInfo{
+		Allow:            headerList(header, "Allow"),
+		AllowOrigin:      header.Get("Access-Control-Allow-Origin"),
+		AllowMethods:     headerList(header, "Access-Control-Allow-Methods"),
+		AllowHeaders:     headerList(header, "Access-Control-Allow-Headers"),
+		AllowCredentials: strings.EqualFold(header.Get("Access-Control-Allow-Credentials"), "true"),
+	}
+	if seconds, parseErr := strconv.Atoi(strings.TrimSpace(header.Get("Access-Control-Max-Age"))); parseErr == nil && seconds > 0 {
+		info.MaxAge = time.Duration(seconds) * time.Second
+	}
+	return httpStatus, info, nil
+}
+
+// headerList splits the comma separated values of every key line in header.
+func headerList(header http.Header, key string) (list []string) {
+	for _, value := range header.Values(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+)
+
+const problemContentType = "application/problem+json"
+
+// ProblemDetails is an RFC 7807 problem document. Members outside the standard
+// ones are kept in Extensions and written back by MarshalJSON.
+type ProblemDetails struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]json.RawMessage
+}
+
+type problemMembers struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+var problemKeys = []string{"type", "title", "status", "detail", "instance"}
+
+func (p *ProblemDetails) Error() string {
+	return fmt.Sprintf("problem: status: %v, type: %s, title: %s, detail: %s", p.Status, p.Type, p.Title, p.Detail)
+}
+
+func (p *ProblemDetails) UnmarshalJSON(data []byte) error {
+	var members problemMembers
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	for _, key := range problemKeys {
+		delete(all, key)
+	}
+	if len(all) == 0 {
+		all = nil
+	}
+
+	*p = ProblemDetails{
+		Type:       members.Type,
+		Title:      members.Title,
+		Status:     members.Status,
+		Detail:     members.Detail,
+		Instance:   members.Instance,
+		Extensions: all,
+	}
+	return nil
+}
+
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	out := make(map[string]json.RawMessage, len(p.Extensions)+len(problemKeys))
+	for key, value := range p.Extensions {
+		out[key] = value
+	}
+
+	members, err := json.Marshal(problemMembers{
+		Type:     p.Type,
+		Title:    p.Title,
+		Status:   p.Status,
+		Detail:   p.Detail,
+		Instance: p.Instance,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var standard map[string]json.RawMessage
+	if err = json.Unmarshal(members, &standard); err != nil {
+		return nil, err
+	}
+	for key, value := range standard {
+		out[key] = value
+	}
+	return json.Marshal(out)
+}
+
+// ProblemFromError returns the problem document attached to err, if any.
+func ProblemFromError(err error) (*ProblemDetails, bool) {
+	var problem *ProblemDetails
+	if errors.As(err, &problem) {
+		return problem, true
+	}
+	return nil, false
+}
+
+// parseProblem decodes body when contentType is application/problem+json.
+func parseProblem(contentType string, body []byte) *ProblemDetails {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != problemContentType || len(body) == 0 {
+		return nil
+	}
+
+	problem := &ProblemDetails{}
+	if err = json.Unmarshal(body, problem); err != nil {
+		return nil
+	}
+	return problem
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProgressBytes    = 64 << 10
+	defaultProgressInterval = 250 * time.Millisecond
+)
+
+type progress struct {
+	fn    func(transferred, total int64)
+	bytes int64
+	every time.Duration
+
+	// mu keeps the callback from running concurrently for upload and download.
+	mu sync.Mutex
+}
+
+// WithOnProgress calls fn while the request body is written and then while the
+// response body is read, with the bytes transferred and the total, -1 when
+// unknown. It is called at the WithProgressInterval and a final time once a body
+// is transferred completely, never concurrently.
+func WithOnProgress(fn func(transferred, total int64)) Option {
+	return func(o *options) {
+		if o.progress == nil {
+			o.progress = &progress{bytes: defaultProgressBytes, every: defaultProgressInterval}
+		}
+		o.progress.fn = fn
+	}
+}
+
+// WithProgressInterval makes WithOnProgress report after every n bytes or every
+// d, whichever comes first. The defaults are 64KB and 250ms.
+func WithProgressInterval(n int64, d time.Duration) Option {
+	return func(o *options) {
+		if o.progress == nil {
+			o.progress = &progress{}
+		}
+		o.progress.bytes, o.progress.every = n, d
+	}
+}
+
+func (p *progress) report(transferred, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.fn(transferred, total)
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	r     io.Reader
+	p     *progress
+	total int64
+
+	done     int64
+	reported int64
+	last     time.Time
+	finished bool
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.done += int64(n)
+
+	switch {
+	case err == io.EOF && !r.finished:
+		r.finished = true
+		r.p.report(r.done, r.total)
+	case n > 0 && (r.done-r.reported >= r.p.bytes || time.Since(r.last) >= r.p.every):
+		r.reported, r.last = r.done, time.Now()
+		r.p.report(r.done, r.total)
+	}
+	return n, err
+}
+
+type progressReadCloser struct {
+	*progressReader
+	io.Closer
+}
+
+// trackUpload reports the progress of writing the request body.
+func (o *options) trackUpload(request *http.Request) {
+	if o.progress == nil || o.progress.fn == nil || request.Body == nil || request.Body == http.NoBody {
+		return
+	}
+
+	total := request.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	request.Body = progressReadCloser{
+		progressReader: &progressReader{r: request.Body, p: o.progress, total: total, last: time.Now()},
+		Closer:         request.Body,
+	}
+}
+
+// trackDownload reports the progress of reading the response body.
+func (o *options) trackDownload(body io.Reader, contentLength int64) io.Reader {
+	if o.progress == nil || o.progress.fn == nil {
+		return body
+	}
+	return &progressReader{r: body, p: o.progress, total: contentLength, last: time.Now()}
+}
@@ -0,0 +1,67 @@
+//go:build protobuf
+// +build protobuf
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// FormatProtobuf is registered when the package is built with the protobuf
+// tag; the module using this package must require google.golang.org/protobuf
+// and google.golang.org/genproto.
+const FormatProtobuf Format = "protobuf"
+
+func init() {
+	RegisterFormat(FormatProtobuf, Codec{
+		MediaTypes: []string{"application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf"},
+		Marshal: func(v interface{}) ([]byte, error) {
+			m, ok := v.(proto.Message)
+			if !ok {
+				return nil, fmt.Errorf("%T is not a proto.Message", v)
+			}
+			return proto.Marshal(m)
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			m, ok := v.(proto.Message)
+			if !ok {
+				return fmt.Errorf("%T is not a proto.Message", v)
+			}
+			return proto.Unmarshal(data, m)
+		},
+	})
+}
+
+// HttpReqProto sends req, which may be nil, as application/x-protobuf and
+// decodes the response into resp, which may be nil too.
+func HttpReqProto(method, urlString string, req, resp proto.Message, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqProto(method, urlString, "", req, resp, headers, cookie, transport, timeout, opts)
+}
+
+func HttpReqAuthProto(method, urlString, token string, req, resp proto.Message, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqProto(method, urlString, token, req, resp, headers, cookie, transport, timeout, opts)
+}
+
+func httpReqProto(method, urlString, token string, req, resp proto.Message, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts []Option) (httpStatus int, responseBody []byte, err error) {
+	// nil messages must not reach the codec as typed nil interfaces
+	var body, responseStruct interface{}
+	if req != nil {
+		body = req
+	}
+	if resp != nil {
+		responseStruct = resp
+	}
+	return httpReqFormat(FormatProtobuf, method, urlString, token, body, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+// WithRPCStatus decodes unsuccessful protobuf responses as google.rpc.Status
+// and attaches a *spb.Status to ResourceError.Body.
+func WithRPCStatus() Option {
+	return func(o *options) {
+		o.errorStruct = &spb.Status{}
+	}
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyError is wrapped by the ResourceError of requests which failed at the
+// proxy rather than at the origin server.
+type ProxyError struct {
+	// Proxy is the URL of the proxy without its password, empty when it
+	// is not known.
+	Proxy string
+	// StatusCode is the reply of the proxy to CONNECT, 0 when it was not
+	// reached.
+	StatusCode int
+	Err        error
+}
+
+func (e *ProxyError) Error() string {
+	proxy := "proxy"
+	if e.Proxy != "" {
+		proxy += " " + e.Proxy
+	}
+	return fmt.Sprintf("%s failed: %v", proxy, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+type proxyMode int
+
+const (
+	proxyFromTransport proxyMode = iota
+	proxyFixed
+	proxyFromEnvironment
+	proxyDisabled
+)
+
+// WithProxyURL sends requests through the proxy at proxy, which may carry
+// user:password for basic authentication.
+func WithProxyURL(proxy string) Option {
+	u, err := url.Parse(proxy)
+	if err == nil && u.Host == "" {
+		err = fmt.Errorf("proxy URL %q has no host", u.Redacted())
+	}
+	if err != nil {
+		return func(o *options) {
+			o.optionErr = err
+		}
+	}
+
+	return func(o *options) {
+		o.proxyMode, o.proxyURL = proxyFixed, u
+	}
+}
+
+// WithProxyFromEnvironment takes the proxy from HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY, as the default transport does.
+func WithProxyFromEnvironment() Option {
+	return func(o *options) {
+		o.proxyMode = proxyFromEnvironment
+	}
+}
+
+// WithNoProxy connects directly, whatever the transport or environment say.
+func WithNoProxy() Option {
+	return func(o *options) {
+		o.proxyMode = proxyDisabled
+	}
+}
+
+// WithProxyBypass connects directly to the hosts matching one of the NO_PROXY
+// style patterns: "*", a domain which matches its subdomains too, a domain
+// with a leading dot matching only subdomains, an IP address or a CIDR range,
+// each optionally with a ":port".
+func WithProxyBypass(patterns ...string) Option {
+	return func(o *options) {
+		o.proxyBypass = append(o.proxyBypass[:len(o.proxyBypass):len(o.proxyBypass)], patterns...)
+	}
+}
+
+// proxyKey describes the proxy options for the variant key of derived transports.
+func (o *options) proxyKey() string {
+	if o.proxyMode == proxyFromTransport && len(o.proxyBypass) == 0 {
+		return ""
+	}
+
+	key := fmt.Sprintf("%d,%s", o.proxyMode, strings.Join(o.proxyBypass, ","))
+	if o.proxyURL != nil {
+		key += "," + o.proxyURL.String()
+	}
+	return key
+}
+
+// proxyVariant configures a clone of the transport for the proxy options.
+func (o *options) proxyVariant(clone *http.Transport) {
+	if o.proxyKey() == "" {
+		return
+	}
+
+	proxy := clone.Proxy
+	switch o.proxyMode {
+	case proxyFixed:
+		proxy = http.ProxyURL(o.proxyURL)
+	case proxyFromEnvironment:
+		proxy = http.ProxyFromEnvironment
+	case proxyDisabled:
+		proxy = nil
+	}
+
+	if proxy != nil && len(o.proxyBypass) != 0 {
+		bypass, next := o.proxyBypass, proxy
+		proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(bypass, req.URL) {
+				return nil, nil
+			}
+			return next(req)
+		}
+	}
+	clone.Proxy = proxy
+
+	next := clone.OnProxyConnectResponse
+	clone.OnProxyConnectResponse = func(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+		if next != nil {
+			if err := next(ctx, proxyURL, connectReq, connectRes); err != nil {
+				return err
+			}
+		}
+		if connectRes.StatusCode != http.StatusOK {
+			return &ProxyError{Proxy: proxyURL.Redacted(), StatusCode: connectRes.StatusCode, Err: errors.New(connectRes.Status)}
+		}
+		return nil
+	}
+}
+
+// bypassProxy reports whether the host of u matches one of the patterns.
+func bypassProxy(patterns []string, u *url.URL) bool {
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	ip := net.ParseIP(host)
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" {
+			return true
+		}
+
+		if _, network, err := net.ParseCIDR(pattern); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		if h, p, err := net.SplitHostPort(pattern); err == nil {
+			if p != port {
+				continue
+			}
+			pattern = h
+		}
+		pattern = strings.Trim(pattern, "[]")
+
+		if patternIP := net.ParseIP(pattern); patternIP != nil {
+			if patternIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		if strings.HasPrefix(pattern, ".") {
+			if strings.HasSuffix(host, pattern) {
+				return true
+			}
+			continue
+		}
+		if pattern != "" && (host == pattern || strings.HasSuffix(host, "."+pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyError marks the errors of connecting to the proxy.
+func (o *options) proxyError(err error) error {
+	var proxyErr *ProxyError
+	if errors.As(err, &proxyErr) {
+		return err
+	}
+
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "proxyconnect" {
+		return err
+	}
+
+	proxyErr = &ProxyError{Err: err}
+	if o.proxyMode == proxyFixed {
+		proxyErr.Proxy = o.proxyURL.Redacted()
+	}
+	return proxyErr
+}
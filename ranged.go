@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultRangeChunks = 4
+	// minRangeChunk keeps small files from being split into tiny requests.
+	minRangeChunk = 1 << 20
+)
+
+// WithRangeChunks sets how many ranges DownloadRanged fetches concurrently.
+func WithRangeChunks(n int) Option {
+	return func(o *options) {
+		o.rangeChunks = n
+	}
+}
+
+// DownloadRanged downloads url into dst as concurrent byte ranges, after a HEAD
+// request learned its size and that the server accepts ranges. Otherwise it is
+// downloaded sequentially. The requests have no timeout of their own, ctx bounds
+// the download. The first failing range cancels the others.
+func DownloadRanged(ctx context.Context, url string, dst io.WriterAt, opts ...Option) (written int64, err error) {
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx), withoutTimeout())
+
+	status, header, size, headErr := HttpHead(url, nil, nil, nil, 0, opts...)
+	if headErr != nil || status != http.StatusOK {
+		size = -1
+	}
+	if size <= 0 || !strings.EqualFold(header.Get("Accept-Ranges"), "bytes") {
+		return downloadAt(url, dst, 0, -1, size, opts)
+	}
+
+	chunks := newOptions(opts).rangeChunks
+	if chunks <= 0 {
+		chunks = defaultRangeChunks
+	}
+	if max := int((size + minRangeChunk - 1) / minRangeChunk); chunks > max {
+		chunks = max
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	opts = append(opts, WithContext(ctx), withCallSite(callSite()))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	chunkSize := size / int64(chunks)
+	for i := 0; i < chunks; i++ {
+		start := int64(i) * chunkSize
+		end := start + chunkSize - 1
+		if i == chunks-1 {
+			end = size - 1
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			n, err := downloadAt(url, dst, start, end, end-start+1, opts)
+
+			mu.Lock()
+			defer mu.Unlock()
+			written += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return written, firstErr
+}
+
+// downloadAt downloads the range start-end (the whole body when end < 0) into
+// dst at start, checking the bytes written against want unless it is -1.
+func downloadAt(url string, dst io.WriterAt, start, end, want int64, opts []Option) (int64, error) {
+	headers := identityEncoding(nil)
+	if end >= 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-%d", start, end)
+	}
+
+	// checked before writing, a server ignoring Range would write the whole
+	// body at start
+	begin := func(response *http.Response) (io.Writer, error) {
+		if end >= 0 {
+			if response.StatusCode != http.StatusPartialContent {
+				return nil, fmt.Errorf("range %s not honored", headers["Range"])
+			}
+			if from, _, ok := parseContentRange(response.Header.Get("Content-Range")); !ok || from != start {
+				return nil, fmt.Errorf("unexpected Content-Range %q for range %s", response.Header.Get("Content-Range"), headers["Range"])
+			}
+		}
+		return &offsetWriter{dst: dst, offset: start}, nil
+	}
+
+	status, n, err := httpDownload("GET", url, "", nil, &download{begin: begin}, headers, nil, nil, 0, opts)
+	if err != nil {
+		return n, err
+	}
+
+	if want >= 0 && n != want {
+		return n, &ResourceError{URL: url, HTTPCode: status, Err: fmt.Errorf("wrote %d bytes, expected %d", n, want)}
+	}
+	return n, nil
+}
+
+// identityEncoding asks for the body as stored, ranges apply to the encoded one.
+func identityEncoding(headers map[string]string) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["Accept-Encoding"] = "identity"
+	return headers
+}
+
+// withoutTimeout drops the default client timeout, leaving the context in charge.
+func withoutTimeout() Option {
+	return func(o *options) {
+		o.noTimeout = true
+	}
+}
+
+// offsetWriter writes sequentially into a WriterAt from offset on.
+type offsetWriter struct {
+	dst    io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
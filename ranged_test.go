@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryFile is an io.WriterAt recording the bytes written past its size.
+type memoryFile struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (f *memoryFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if end := int(off) + len(p); end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+	copy(f.data[off:], p)
+	return len(p), nil
+}
+
+func TestDownloadRanged(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 300000)
+	ignoreRange := false
+	var headAccept string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			headAccept = r.Header.Get("Accept")
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			return
+		}
+		if ignoreRange {
+			w.Write(content)
+			return
+		}
+		http.ServeContent(w, r, "data", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dst := &memoryFile{}
+	written, err := DownloadRanged(context.Background(), srv.URL, dst, WithRangeChunks(3))
+	if err != nil || written != int64(len(content)) || !bytes.Equal(dst.data, content) {
+		t.Fatalf("wrote %d bytes, %v", written, err)
+	}
+	if headAccept != "" {
+		t.Errorf("the HEAD probe sent Accept: %s", headAccept)
+	}
+
+	ignoreRange = true
+	dst = &memoryFile{}
+	if _, err = DownloadRanged(context.Background(), srv.URL, dst, WithRangeChunks(3)); err == nil {
+		t.Fatal("a server ignoring Range didn't fail the download")
+	}
+	if len(dst.data) != 0 {
+		t.Errorf("%d bytes were written from responses ignoring Range", len(dst.data))
+	}
+}
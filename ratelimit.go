@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithRateLimit allows rate requests per second with bursts of up to burst
+// requests. The limiter lives in the returned Option, so pass it to NewClient
+// to share it between requests.
+func WithRateLimit(rate float64, burst int) Option {
+	limiter := newRateLimiter(rate, burst, false)
+	return func(o *options) {
+		o.limiter = limiter
+	}
+}
+
+// WithPerHostRateLimit is WithRateLimit with a separate budget for each host.
+func WithPerHostRateLimit(rate float64, burst int) Option {
+	limiter := newRateLimiter(rate, burst, true)
+	return func(o *options) {
+		o.limiter = limiter
+	}
+}
+
+// rateLimiter is a token bucket, optionally one per host.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	perHost bool
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int, perHost bool) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		perHost: perHost,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// wait blocks until a request to host may be sent or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, host string) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	key := ""
+	if l.perHost {
+		key = strings.ToLower(host)
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	// the token is taken right away, callers queue up behind each other
+	b.tokens--
+	delay := time.Duration(-b.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
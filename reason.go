@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// Reason classifies why a request failed without an HTTP status.
+type Reason string
+
+const (
+	// ReasonCanceled means the context of the caller was canceled.
+	ReasonCanceled Reason = "canceled"
+	// ReasonDeadlineExceeded means the deadline of the caller's context passed.
+	ReasonDeadlineExceeded Reason = "deadline_exceeded"
+	// ReasonClientTimeout means the timeout argument of the request fired.
+	ReasonClientTimeout Reason = "client_timeout"
+	// ReasonPhaseTimeout means one of the PhaseTimeouts fired, the
+	// PhaseTimeoutError says which.
+	ReasonPhaseTimeout Reason = "phase_timeout"
+	// ReasonNetwork covers every other transport failure.
+	ReasonNetwork Reason = "network"
+)
+
+// IsCanceled reports whether err comes from a request canceled by the caller.
+func IsCanceled(err error) bool {
+	var re *ResourceError
+	if errors.As(err, &re) && re.Reason != "" {
+		return re.Reason == ReasonCanceled
+	}
+	return errors.Is(err, context.Canceled)
+}
+
+// IsDeadline reports whether err comes from a request which ran out of time,
+// through the caller's context deadline or the request timeout.
+func IsDeadline(err error) bool {
+	var re *ResourceError
+	if errors.As(err, &re) && re.Reason != "" {
+		return re.Reason == ReasonDeadlineExceeded || re.Reason == ReasonClientTimeout || re.Reason == ReasonPhaseTimeout
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// classify sets the Reason of a transport error.
+func (o *options) classify(re *ResourceError) *ResourceError {
+	switch o.context().Err() {
+	case context.Canceled:
+		re.Reason = ReasonCanceled
+		return re
+	case context.DeadlineExceeded:
+		re.Reason = ReasonDeadlineExceeded
+		return re
+	}
+
+	var phaseErr *PhaseTimeoutError
+	if errors.As(re.Err, &phaseErr) {
+		re.Reason = ReasonPhaseTimeout
+		return re
+	}
+
+	var netErr net.Error
+	if errors.Is(re.Err, context.DeadlineExceeded) || errors.As(re.Err, &netErr) && netErr.Timeout() {
+		re.Reason = ReasonClientTimeout
+		return re
+	}
+
+	re.Reason = ReasonNetwork
+	return re
+}
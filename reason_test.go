@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFailureReasons(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(3 * time.Second):
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + ln.Addr().String()
+	ln.Close()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	expiring, cancelExpiring := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelExpiring()
+
+	tests := []struct {
+		name       string
+		url        string
+		timeout    int
+		opts       []Option
+		reason     Reason
+		isCanceled bool
+		isDeadline bool
+	}{
+		{"canceled", srv.URL, 5, []Option{WithContext(canceled)}, ReasonCanceled, true, false},
+		{"deadline", srv.URL, 5, []Option{WithContext(expiring)}, ReasonDeadlineExceeded, false, true},
+		{"client timeout", srv.URL, 1, nil, ReasonClientTimeout, false, true},
+		{"network", closedURL, 5, nil, ReasonNetwork, false, false},
+	}
+	for _, tt := range tests {
+		_, _, err := HttpReqJSON("GET", tt.url, nil, nil, nil, nil, tt.timeout, nil, tt.opts...)
+
+		var re *ResourceError
+		if !errors.As(err, &re) {
+			t.Fatalf("%s: got %v, want a ResourceError", tt.name, err)
+		}
+		if re.Reason != tt.reason {
+			t.Errorf("%s: Reason %q, want %q", tt.name, re.Reason, tt.reason)
+		}
+		if IsCanceled(err) != tt.isCanceled || IsDeadline(err) != tt.isDeadline {
+			t.Errorf("%s: IsCanceled %v, IsDeadline %v", tt.name, IsCanceled(err), IsDeadline(err))
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const redactedValue = "[REDACTED]"
+
+var (
+	redactMu sync.RWMutex
+
+	redactedHeaders = map[string]struct{}{
+		"Authorization":       {},
+		"Cookie":              {},
+		"Proxy-Authorization": {},
+		"Set-Cookie":          {},
+		"X-Api-Key":           {},
+	}
+
+	redactedFields = map[string]struct{}{}
+)
+
+// SetRedactedHeaders extends the list of header names whose values are replaced
+// with "[REDACTED]" in errors, hook payloads and dumps produced by the package.
+func SetRedactedHeaders(names []string) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+
+	for _, name := range names {
+		redactedHeaders[http.CanonicalHeaderKey(strings.TrimSpace(name))] = struct{}{}
+	}
+}
+
+// SetRedactedFields sets the JSON field names (e.g. "password") whose values are
+// masked in bodies the package prints. Matching is case-insensitive.
+func SetRedactedFields(names []string) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+
+	redactedFields = make(map[string]struct{}, len(names))
+	for _, name := range names {
+		redactedFields[strings.ToLower(strings.TrimSpace(name))] = struct{}{}
+	}
+}
+
+func isRedactedHeader(name string) bool {
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+
+	_, ok := redactedHeaders[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// isRedactedField reports whether the values of the JSON field name are masked:
+// the fields of SetRedactedFields and the redacted header names, so that echoed
+// headers don't leak either.
+func isRedactedField(name string) bool {
+	if isRedactedHeader(name) {
+		return true
+	}
+
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+
+	_, ok := redactedFields[strings.ToLower(name)]
+	return ok
+}
+
+// RedactHeader returns a copy of h with the values of the redacted headers
+// replaced, for logging the headers of ResponseInfo and the like.
+func RedactHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+
+	out := make(http.Header, len(h))
+	for key, values := range h {
+		if isRedactedHeader(key) {
+			out[key] = []string{redactedValue}
+			continue
+		}
+		out[key] = append([]string(nil), values...)
+	}
+	return out
+}
+
+// redactURL hides the password of URL userinfo, leaving unparsable strings as is.
+func redactURL(urlString string) string {
+	u, err := url.Parse(urlString)
+	if err != nil || u.User == nil {
+		return urlString
+	}
+	return u.Redacted()
+}
+
+// redactValue masks the URL password and the redacted headers or JSON fields a
+// short value, such as that of a Violation, may hold.
+func redactValue(value string) string {
+	return redactURL(string(redactRaw([]byte(value))))
+}
+
+// redactBody masks the redacted fields of a JSON string or []byte body, and the
+// redacted headers of any other text body, e.g. a dumped request.
+func redactBody(body interface{}) interface{} {
+	switch b := body.(type) {
+	case string:
+		return string(redactRaw([]byte(b)))
+	case []byte:
+		return redactRaw(b)
+	}
+	return body
+}
+
+func redactRaw(body []byte) []byte {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	if len(trimmed) != 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		out, _ := redactJSON(body)
+		return out
+	}
+	return redactText(body)
+}
+
+// redactedSpan is a value of body replaced with the mask.
+type redactedSpan struct {
+	start, end int
+}
+
+// redactJSON masks the values of the redacted fields in place, keeping the rest
+// of the document byte for byte. A malformed document is masked up to the
+// error. body is returned as is when nothing was masked.
+func redactJSON(body []byte) (out []byte, spans []redactedSpan) {
+	const (
+		inArray = iota
+		awaitingKey
+		awaitingValue
+	)
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var open []int
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		state := inArray
+		if len(open) != 0 {
+			state = open[len(open)-1]
+		}
+
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				open = append(open, awaitingKey)
+			case '[':
+				open = append(open, inArray)
+			default:
+				open = open[:len(open)-1]
+				if len(open) != 0 && open[len(open)-1] == awaitingValue {
+					open[len(open)-1] = awaitingKey
+				}
+			}
+			continue
+		case string:
+			if state != awaitingKey {
+				break
+			}
+			if !isRedactedField(t) {
+				open[len(open)-1] = awaitingValue
+				continue
+			}
+
+			start := int(dec.InputOffset())
+			for start < len(body) && strings.IndexByte(" \t\r\n:", body[start]) >= 0 {
+				start++
+			}
+			if !skipValue(dec) {
+				return redactSpans(body, spans), spans
+			}
+			spans = append(spans, redactedSpan{start: start, end: int(dec.InputOffset())})
+			continue
+		}
+
+		if state == awaitingValue {
+			open[len(open)-1] = awaitingKey
+		}
+	}
+	return redactSpans(body, spans), spans
+}
+
+// skipValue reads the next value of dec, nested containers included.
+func skipValue(dec *json.Decoder) bool {
+	depth := 0
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		if delim, ok := token.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return true
+		}
+	}
+}
+
+func redactSpans(body []byte, spans []redactedSpan) []byte {
+	if len(spans) == 0 {
+		return body
+	}
+
+	out := make([]byte, 0, len(body))
+	last := 0
+	for _, span := range spans {
+		out = append(out, body[last:span.start]...)
+		out = append(out, `"`+redactedValue+`"`...)
+		last = span.end
+	}
+	return append(out, body[last:]...)
+}
+
+// redactedOffset moves an offset of the original body to the redacted one.
+func redactedOffset(offset int64, spans []redactedSpan) int64 {
+	shift := int64(0)
+	for _, span := range spans {
+		if offset < int64(span.end) {
+			if offset > int64(span.start) {
+				offset = int64(span.start)
+			}
+			break
+		}
+		shift += int64(len(redactedValue)+2) - int64(span.end-span.start)
+	}
+	return offset + shift
+}
+
+// redactText masks the values of "Name: value" lines of the redacted headers.
+func redactText(body []byte) []byte {
+	var out []byte
+	for start := 0; start < len(body); {
+		end := bytes.IndexByte(body[start:], '\n')
+		if end < 0 {
+			end = len(body)
+		} else {
+			end += start
+		}
+
+		line := body[start:end]
+		if colon := bytes.IndexByte(line, ':'); colon > 0 && isRedactedHeader(string(bytes.TrimSpace(line[:colon]))) {
+			if out == nil {
+				out = append(make([]byte, 0, len(body)), body[:start]...)
+			}
+			out = append(out, line[:colon+1]...)
+			out = append(out, " "+redactedValue...)
+			if bytes.HasSuffix(line, []byte("\r")) {
+				out = append(out, '\r')
+			}
+		} else if out != nil {
+			out = append(out, line...)
+		}
+
+		if end < len(body) && out != nil {
+			out = append(out, '\n')
+		}
+		start = end + 1
+	}
+
+	if out == nil {
+		return body
+	}
+	return out
+}
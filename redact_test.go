@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactJSONKeepsKeyOrder(t *testing.T) {
+	SetRedactedFields([]string{"password"})
+	defer SetRedactedFields(nil)
+
+	body := `{"user":"bob", "password" : {"old":"a","new":"b"},"headers":{"Authorization":"Bearer x","Accept":"*/*"},"list":[1,{"password":"c"}]}`
+	want := `{"user":"bob", "password" : "[REDACTED]","headers":{"Authorization":"[REDACTED]","Accept":"*/*"},"list":[1,{"password":"[REDACTED]"}]}`
+	if got := redactBody(body); got != want {
+		t.Errorf("redactBody() = %s\nwant %s", got, want)
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	SetRedactedHeaders([]string{"X-Session"})
+
+	body := "GET / HTTP/1.1\r\nHost: example.com\r\nx-session: s3cr3t\r\nAuthorization: Basic Ym9iOnB3\r\n\r\n"
+	want := "GET / HTTP/1.1\r\nHost: example.com\r\nx-session: [REDACTED]\r\nAuthorization: [REDACTED]\r\n\r\n"
+	if got := redactBody(body); got != want {
+		t.Errorf("redactBody() = %q\nwant %q", got, want)
+	}
+
+	h := http.Header{"X-Session": {"s3cr3t"}, "Accept": {"*/*"}}
+	if got := RedactHeader(h); got.Get("X-Session") != redactedValue || got.Get("Accept") != "*/*" {
+		t.Errorf("RedactHeader() = %v", got)
+	}
+	if h.Get("X-Session") != "s3cr3t" {
+		t.Errorf("RedactHeader changed its argument")
+	}
+}
+
+func TestResourceErrorRedactsBody(t *testing.T) {
+	SetRedactedFields([]string{"password"})
+	defer SetRedactedFields(nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	body := []byte(`{"user":"bob","password":"hunter2","headers":{"X-Api-Key":"k3y"}}`)
+	_, _, err := HttpReqJSON("POST", srv.URL, body, nil, nil, nil, 5, nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "hunter2") || strings.Contains(msg, "k3y") {
+		t.Errorf("Error() = %s", msg)
+	}
+	if !strings.Contains(msg, `{"user":"bob","password":"[REDACTED]","headers":{"X-Api-Key":"[REDACTED]"}}`) {
+		t.Errorf("Error() = %s, want the body masked in place", msg)
+	}
+}
+
+func TestDecodeErrorPositionMatchesSnippet(t *testing.T) {
+	SetRedactedFields([]string{"password"})
+	defer SetRedactedFields(nil)
+
+	body := "{\"password\":\"a-very-long-secret-value\",\n \"count\": \"x\"}"
+	var out struct{ Count int }
+	err := decodeJSON(t, body, &out)
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("err = %v, want a DecodeError", err)
+	}
+	if strings.Contains(decodeErr.Snippet, "secret") {
+		t.Errorf("snippet %q leaks the password", decodeErr.Snippet)
+	}
+
+	lines := strings.Split(decodeErr.Snippet, "\n")
+	if decodeErr.Line != 2 || decodeErr.Column > len(lines[1]) {
+		t.Fatalf("position %d:%d is outside the snippet %q", decodeErr.Line, decodeErr.Column, decodeErr.Snippet)
+	}
+	if at := lines[1][:decodeErr.Column]; !strings.HasSuffix(at, `"x"`) {
+		t.Errorf("position %d:%d points at %q", decodeErr.Line, decodeErr.Column, at)
+	}
+}
+
+func decodeJSON(t *testing.T, body string, out interface{}) error {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	_, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, out)
+	return err
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrTooManyRedirects is wrapped by the ResourceError returned when a request
+// goes over the WithMaxRedirects limit.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// WithoutRedirects returns 3xx responses to the caller instead of following
+// them. The target is in the Location header of ResponseInfo.
+func WithoutRedirects() Option {
+	return func(o *options) {
+		o.noRedirects = true
+	}
+}
+
+// WithMaxRedirects caps the number of redirects followed, 10 by default.
+func WithMaxRedirects(n int) Option {
+	return func(o *options) {
+		o.maxRedirects = &n
+	}
+}
+
+// WithRedirectAuth decides whether the token of the HttpReqAuth* wrappers, or the
+// credentials of WithBasicAuth and WithBearerToken, are sent again after a
+// redirect to the same host and to another host. By default they are kept on
+// the same host and dropped for other hosts.
+func WithRedirectAuth(sameHost, crossHost bool) Option {
+	return func(o *options) {
+		o.redirectAuth = &[2]bool{sameHost, crossHost}
+	}
+}
+
+type redirectPolicyKey struct{}
+
+// checkRedirect is the CheckRedirect of the shared http.Clients. It applies the
+// policy of the request, found in its context, or the http.Client default.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if policy, ok := req.Context().Value(redirectPolicyKey{}).(func(*http.Request, []*http.Request) error); ok {
+		return policy(req, via)
+	}
+
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// checkRedirect builds the redirect policy of the options, nil means the
+// http.Client default.
+func (o *options) checkRedirect(token string) func(*http.Request, []*http.Request) error {
+	if !o.noRedirects && o.maxRedirects == nil && o.redirectAuth == nil {
+		return nil
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if o.noRedirects {
+			return http.ErrUseLastResponse
+		}
+
+		max := 10
+		if o.maxRedirects != nil {
+			max = *o.maxRedirects
+		}
+		if len(via) > max {
+			return ErrTooManyRedirects
+		}
+
+		if o.redirectAuth != nil && token != "" {
+			allowed := o.redirectAuth[1]
+			if strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+				allowed = o.redirectAuth[0]
+			}
+
+			if allowed {
+				req.Header.Set("Authorization", token)
+			} else {
+				req.Header.Del("Authorization")
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	seen := map[string]string{}
+	end := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen["end"] = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer end.Close()
+
+	var start *httptest.Server
+	start = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen[r.URL.Path] = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, start.URL+"/next", http.StatusFound)
+		case "/next":
+			http.Redirect(w, r, end.URL+"/end", http.StatusFound)
+		}
+	}))
+	defer start.Close()
+
+	get := func(opts ...Option) (int, error) {
+		for k := range seen {
+			delete(seen, k)
+		}
+		status, _, err := HttpReqAuthJSON("GET", start.URL+"/start", "Bearer t", nil, nil, nil, nil, 5, nil, opts...)
+		return status, err
+	}
+
+	if _, err := get(WithRedirectAuth(true, false)); err != nil {
+		t.Fatal(err)
+	}
+	if seen["/next"] != "Bearer t" || seen["end"] != "" {
+		t.Errorf("same host only: sent %v", seen)
+	}
+
+	if _, err := get(WithRedirectAuth(false, true)); err != nil {
+		t.Fatal(err)
+	}
+	if seen["/next"] != "" || seen["end"] != "Bearer t" {
+		t.Errorf("cross host only: sent %v", seen)
+	}
+
+	var info ResponseInfo
+	status, err := get(WithoutRedirects(), WithResponseInfo(&info))
+	if err != nil || status != http.StatusFound || info.Header.Get("Location") != start.URL+"/next" {
+		t.Errorf("WithoutRedirects: %d, %v, Location %q", status, err, info.Header.Get("Location"))
+	}
+	if _, ok := seen["/next"]; ok {
+		t.Error("WithoutRedirects followed the redirect")
+	}
+
+	if _, err = get(WithMaxRedirects(1)); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("WithMaxRedirects(1) returned %v, want ErrTooManyRedirects", err)
+	}
+	if _, ok := seen["end"]; ok {
+		t.Error("WithMaxRedirects(1) followed two redirects")
+	}
+	if _, err = get(WithMaxRedirects(2)); err != nil {
+		t.Errorf("WithMaxRedirects(2) returned %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+)
+
+// WithResolveOverride dials to instead of from, both "host:port", like curl
+// --resolve. The Host header, TLS SNI and certificate verification keep using
+// the host of the URL. It can be passed several times for several mappings.
+func WithResolveOverride(from, to string) Option {
+	return func(o *options) {
+		if o.resolveOverrides == nil {
+			o.resolveOverrides = make(map[string]string)
+		}
+		o.resolveOverrides[strings.ToLower(from)] = to
+	}
+}
+
+// resolveKey describes the overrides for the cache of derived transports.
+func (o *options) resolveKey() string {
+	mappings := make([]string, 0, len(o.resolveOverrides))
+	for from, to := range o.resolveOverrides {
+		mappings = append(mappings, from+"="+to)
+	}
+	sort.Strings(mappings)
+	return strings.Join(mappings, ",")
+}
+
+// overrideDial wraps dial to connect to the overridden addresses.
+func overrideDial(overrides map[string]string, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if to, ok := overrides[strings.ToLower(addr)]; ok {
+			addr = to
+		}
+		return dial(ctx, network, addr)
+	}
+}
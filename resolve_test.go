@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResolveOverrideKeepsHostname(t *testing.T) {
+	var serverName string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		serverName = hello.ServerName
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The httptest certificate is valid for example.com only.
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	addr := srv.Listener.Addr().String()
+
+	_, body, err := HttpReqJSON("GET", "https://example.com/x", nil, nil, nil, transport, 5, nil,
+		WithResolveOverride("example.com:443", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "example.com" {
+		t.Errorf("Host %q, want example.com", body)
+	}
+	if serverName != "example.com" {
+		t.Errorf("SNI %q, want example.com", serverName)
+	}
+
+	_, _, err = HttpReqJSON("GET", "https://other.test/x", nil, nil, nil, transport, 5, nil,
+		WithResolveOverride("other.test:443", addr))
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("certificate for another host accepted: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"net/http"
+)
+
+// ResponseInfo describes the response of a request made with WithResponseInfo.
+type ResponseInfo struct {
+	Status int
+	Header http.Header
+
+	// Decoded reports whether the body was unmarshalled into responseStruct.
+	// It is false for empty bodies and for 204, 205 and 304 responses.
+	Decoded bool
+
+	// Format is the decoder used for the body.
+	Format Format
+
+	// Endpoint is the URL which produced the response, see WithBaseURLs.
+	Endpoint string
+
+	// IdempotencyKey is the key sent with WithIdempotencyKey.
+	IdempotencyKey string
+
+	// HookErrors reports panics recovered from hooks such as WithOnRetry.
+	HookErrors []error
+
+	// RawBody holds the body as received when it was converted to UTF-8.
+	RawBody []byte
+
+	// InsecureTLS reports that the certificate of the server was not
+	// verified, see WithInsecureSkipTLSVerify.
+	InsecureTLS bool
+
+	// Proto is the protocol of the response, e.g. "HTTP/2.0".
+	Proto string
+
+	// TLS describes the TLS connection, it is nil for plain HTTP.
+	TLS *TLSInfo
+
+	// Trailer holds the trailers of the response, which are only known once
+	// the body was read to the end. See WithTrailer for request trailers.
+	Trailer http.Header
+
+	// FileName is the name suggested by Content-Disposition, else the last
+	// segment of the URL path, without directories so that it is safe for a
+	// local file. It is empty when there is none.
+	FileName string
+
+	// Cached reports that the response is a stored one: fresh or stale ones
+	// of WithResponseCache, or ones the server confirmed with a 304.
+	Cached bool
+
+	// ContentEncoding is that of a body returned as received, because no
+	// decoder is registered for it or WithRawEncoding is set.
+	ContentEncoding string
+}
+
+// WithResponseInfo fills info once the response is received. The same info
+// must not be shared by concurrent requests.
+func WithResponseInfo(info *ResponseInfo) Option {
+	return func(o *options) {
+		o.info = info
+	}
+}
+
+// hasNoContent reports whether the status never carries a body to decode.
+func hasNoContent(status int) bool {
+	switch status {
+	case http.StatusNoContent, http.StatusResetContent, http.StatusNotModified:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecodedReportsEmptyBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/204":
+			w.WriteHeader(http.StatusNoContent)
+		case "/304":
+			w.WriteHeader(http.StatusNotModified)
+		case "/empty":
+			w.Header().Set("Content-Type", "application/json")
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name":"a"}`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path        string
+		status      int
+		wantDecoded bool
+	}{
+		{"/204", http.StatusNoContent, false},
+		{"/304", http.StatusNotModified, false},
+		{"/empty", http.StatusOK, false},
+		{"/body", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		var info ResponseInfo
+		var out struct{ Name string }
+		status, _, err := HttpReqJSON("GET", srv.URL+tt.path, nil, nil, nil, nil, 5, &out, WithResponseInfo(&info))
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if status != tt.status || info.Decoded != tt.wantDecoded {
+			t.Errorf("%s: status %d, Decoded %v, want %d, %v", tt.path, status, info.Decoded, tt.status, tt.wantDecoded)
+		}
+		if tt.wantDecoded && out.Name != "a" {
+			t.Errorf("%s: decoded %+v", tt.path, out)
+		}
+	}
+}
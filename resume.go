@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resumeValidator identifies the version of the resource a partial file holds.
+type resumeValidator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// WithResumeProgress calls fn as DownloadResume writes, with the bytes of the
+// file so far and its total size, -1 when unknown.
+func WithResumeProgress(fn func(done, total int64)) Option {
+	return func(o *options) {
+		o.resumeProgress = fn
+	}
+}
+
+// DownloadResume downloads url into the file at path, continuing a partial file
+// left by an interrupted call. The validator of the partial download is kept in
+// path+".validator" and sent as If-Range, so a changed resource, or a server
+// ignoring Range, restarts the file from scratch. It returns the bytes written by
+// this call. The requests have no timeout of their own, ctx bounds the download.
+func DownloadResume(ctx context.Context, url, path string, opts ...Option) (written int64, err error) {
+	validatorPath := path + ".validator"
+
+	var offset int64
+	if info, statErr := os.Stat(path); statErr == nil {
+		offset = info.Size()
+	}
+
+	validator, _ := readValidator(validatorPath)
+	ifRange := validator.ETag
+	if ifRange == "" || strings.HasPrefix(ifRange, "W/") {
+		// weak ETags can't be used in If-Range
+		ifRange = validator.LastModified
+	}
+	if ifRange == "" {
+		offset = 0
+	}
+
+	headers := identityEncoding(nil)
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		headers["If-Range"] = ifRange
+	}
+
+	o := newOptions(opts)
+
+	var file *os.File
+	defer func() {
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}()
+
+	begin := func(response *http.Response) (io.Writer, error) {
+		total := response.ContentLength
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if response.StatusCode == http.StatusPartialContent {
+			start, size, ok := parseContentRange(response.Header.Get("Content-Range"))
+			if !ok || start != offset {
+				return nil, fmt.Errorf("unexpected Content-Range %q for offset %d", response.Header.Get("Content-Range"), offset)
+			}
+			flags, total = os.O_WRONLY|os.O_APPEND, size
+		} else {
+			offset = 0
+		}
+
+		validator := resumeValidator{ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+		if err := writeValidator(validatorPath, validator); err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(path, flags, 0644)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+		return &progressWriter{w: f, done: offset, total: total, fn: o.resumeProgress}, nil
+	}
+
+	var info ResponseInfo
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx), withoutTimeout(), WithResponseInfo(&info))
+
+	_, written, err = httpDownload("GET", url, "", nil, &download{begin: begin}, headers, nil, nil, 0, opts)
+	if err != nil {
+		// the file is already complete
+		if info.Status == http.StatusRequestedRangeNotSatisfiable {
+			if _, size, ok := parseContentRange(info.Header.Get("Content-Range")); ok && size == offset {
+				return 0, os.Remove(validatorPath)
+			}
+		}
+		return written, err
+	}
+
+	if err = os.Remove(validatorPath); os.IsNotExist(err) {
+		err = nil
+	}
+	return written, err
+}
+
+func readValidator(path string) (v resumeValidator, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+func writeValidator(path string, v resumeValidator) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// parseContentRange parses "bytes start-end/size" and "bytes */size", size is
+// -1 when given as "*".
+func parseContentRange(value string) (start, size int64, ok bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	size = -1
+	if parts[1] != "*" {
+		var err error
+		if size, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+
+	if parts[0] == "*" {
+		return 0, size, true
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || len(bounds) != 2 {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+// progressWriter reports the bytes written through it.
+type progressWriter struct {
+	w     io.Writer
+	done  int64
+	total int64
+	fn    func(done, total int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.done += int64(n)
+	if w.fn != nil {
+		w.fn(w.done, w.total)
+	}
+	return n, err
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// dropAfter serves data with the ETag "v1", answering range requests, and
+// drops the connection after n bytes of the first response.
+func dropAfter(data []byte, n int) (handler http.HandlerFunc, requests *[][2]string) {
+	requests = new([][2]string)
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, [2]string{r.Header.Get("Range"), r.Header.Get("If-Range")})
+		w.Header().Set("ETag", `"v1"`)
+		if len(*requests) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:n])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}
+	return handler, requests
+}
+
+func TestDownloadResumesAfterDrop(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	handler, requests := dropAfter(data, 3000)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "firmware")
+	if _, err := DownloadResume(context.Background(), srv.URL, path); err == nil {
+		t.Fatal("the dropped connection went unnoticed")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 3000 {
+		t.Fatalf("partial file: %v", err)
+	}
+	if _, err := os.Stat(path + ".validator"); err != nil {
+		t.Fatalf("validator: %v", err)
+	}
+
+	var progress [2]int64
+	written, err := DownloadResume(context.Background(), srv.URL, path, WithResumeProgress(func(done, total int64) {
+		progress = [2]int64{done, total}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 7000 || progress != [2]int64{10000, 10000} {
+		t.Errorf("wrote %d bytes, progress %v", written, progress)
+	}
+	if (*requests)[1] != [2]string{"bytes=3000-", `"v1"`} {
+		t.Errorf("resumed with Range %q, If-Range %q", (*requests)[1][0], (*requests)[1][1])
+	}
+	if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, data) {
+		t.Error("the file differs from the resource")
+	}
+	if _, err := os.Stat(path + ".validator"); !os.IsNotExist(err) {
+		t.Errorf("validator kept: %v", err)
+	}
+}
+
+func TestDownloadResumeRestarts(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.URL.Path == "/ignores-range" {
+			w.Write(data)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name, path, etag string
+	}{
+		{"changed resource", "/", `"v0"`},
+		{"range ignored", "/ignores-range", `"v1"`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "firmware")
+		ioutil.WriteFile(path, []byte("stale partial content"), 0644)
+		writeValidator(path+".validator", resumeValidator{ETag: tt.etag})
+
+		written, err := DownloadResume(context.Background(), srv.URL+tt.path, path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got, _ := ioutil.ReadFile(path); written != int64(len(data)) || !bytes.Equal(got, data) {
+			t.Errorf("%s: wrote %d bytes, file of %d, want the whole resource", tt.name, written, len(got))
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy configures automatic retries of failed requests. Which failures
+// are retried is decided by DefaultRetryIf unless WithRetryIf is set.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt too, values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is doubled after each attempt, up to MaxDelay when it is set.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomizes each delay by up to this fraction of it, from 0 to 1.
+	Jitter float64
+}
+
+// WithRetry retries the request according to policy. There are no retries by default.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = &policy
+	}
+}
+
+// RetryPredicate decides whether a failed attempt is retried. status is 0 when
+// no response was received, err is then the transport error, unwrapped from
+// ResourceError, so checks like net.Error.Timeout work. err is nil when a
+// response was received.
+type RetryPredicate func(attempt int, status int, err error) bool
+
+// WithRetryIf replaces DefaultRetryIf. Returning false stops retrying and the
+// result of the last attempt is returned.
+func WithRetryIf(fn RetryPredicate) Option {
+	return func(o *options) {
+		o.retryIf = fn
+	}
+}
+
+// ErrRequestNotSent matches, with errors.Is, transport errors of retried
+// requests which happened before the request was written, such as a refused
+// connection. Such failures are safe to retry for any method.
+var ErrRequestNotSent = errors.New("request not sent")
+
+type notSentError struct {
+	err error
+}
+
+func (e *notSentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notSentError) Unwrap() error {
+	return e.err
+}
+
+func (e *notSentError) Is(target error) bool {
+	return target == ErrRequestNotSent
+}
+
+// WithRetryNonIdempotent lets the default predicate retry POST and PATCH like
+// idempotent methods, for endpoints known to be safe to repeat.
+func WithRetryNonIdempotent() Option {
+	return func(o *options) {
+		o.retryNonIdempotent = true
+	}
+}
+
+// DefaultRetryIf retries network errors and 429, 502, 503 and 504 responses.
+// It is used as is for idempotent methods (RFC 7231), other methods are only
+// retried when the request was not sent, unless WithRetryNonIdempotent is set.
+func DefaultRetryIf(attempt int, status int, err error) bool {
+	if status == 0 {
+		return err != nil
+	}
+
+	switch status {
+	case 429, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+func (o *options) shouldRetry(attempt int, method string, status int, err error) bool {
+	if o.retry == nil || attempt >= o.retry.MaxAttempts || o.context().Err() != nil {
+		return false
+	}
+
+	// a retry would write the downloaded bytes twice
+	if o.download != nil && o.download.written > 0 {
+		return false
+	}
+
+	if status != 0 && o.isSuccess(status) {
+		return false
+	}
+
+	var re *ResourceError
+	if errors.As(err, &re) {
+		err = re.Err
+	}
+	if status != 0 {
+		err = nil
+	}
+
+	if o.retryIf != nil {
+		return o.retryIf(attempt, status, err)
+	}
+	if isIdempotent(method) || o.retryNonIdempotent {
+		return DefaultRetryIf(attempt, status, err)
+	}
+	return status == 0 && errors.Is(err, ErrRequestNotSent)
+}
+
+// delay returns the wait before the attempt following the given one.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// RetryInfo describes a failed attempt about to be retried.
+type RetryInfo struct {
+	Attempt int
+	Method  string
+	URL     string
+	// Status is 0 when no response was received, Err is then the transport error.
+	Status int
+	Err    error
+	Delay  time.Duration
+}
+
+// WithOnRetry calls fn before waiting for each retry. A panic in fn is
+// recovered and reported in ResponseInfo.HookErrors.
+func WithOnRetry(fn func(info RetryInfo)) Option {
+	return func(o *options) {
+		o.onRetry = fn
+	}
+}
+
+// backoff reports the retry and waits before the next attempt, returning early
+// with the context error.
+func (o *options) backoff(attempt int, method, urlString string, status int, err error) error {
+	delay := o.retry.delay(attempt)
+
+	if o.onRetry != nil {
+		var re *ResourceError
+		if errors.As(err, &re) {
+			err = re.Err
+		}
+		if status != 0 {
+			err = nil
+		}
+
+		o.callHook("OnRetry", func() {
+			o.onRetry(RetryInfo{
+				Attempt: attempt,
+				Method:  method,
+				URL:     redactURL(urlString),
+				Status:  status,
+				Err:     err,
+				Delay:   delay,
+			})
+		})
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-o.context().Done():
+		return o.context().Err()
+	}
+}
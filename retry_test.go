@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetrySafety(t *testing.T) {
+	var requests int32
+	// the request is read, then the connection dropped without a response
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	policy := WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	tests := []struct {
+		method string
+		opts   []Option
+		want   int32
+	}{
+		{"GET", []Option{policy}, 3},
+		{"PUT", []Option{policy}, 3},
+		{"POST", []Option{policy}, 1},
+		{"PATCH", []Option{policy}, 1},
+		{"POST", []Option{policy, WithRetryNonIdempotent()}, 3},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&requests, 0)
+		_, _, err := HttpReqJSON(tt.method, srv.URL, []byte(`{}`), nil, nil, nil, 5, nil, tt.opts...)
+		if err == nil {
+			t.Fatalf("%s: expected an error", tt.method)
+		}
+		if got := atomic.LoadInt32(&requests); got != tt.want {
+			t.Errorf("%s sent %d times, want %d", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestRetryUnsentRequests(t *testing.T) {
+	// a closed port refuses the connection before anything is written
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + ln.Addr().String()
+	ln.Close()
+
+	_, _, err = HttpReqJSON("POST", url, []byte(`{}`), nil, nil, nil, 5, nil,
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+
+	var re *ResourceError
+	if !errors.As(err, &re) || re.Attempts != 3 {
+		t.Fatalf("POST to a closed port: %v, want 3 attempts", err)
+	}
+	if !errors.Is(err, ErrRequestNotSent) {
+		t.Errorf("%v does not match ErrRequestNotSent", err)
+	}
+}
+
+func TestRetryBackoffStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, nil, 5, nil, WithContext(ctx),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}),
+		WithOnRetry(func(RetryInfo) { time.AfterFunc(20*time.Millisecond, cancel) }))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("sent %d times", got)
+	}
+}
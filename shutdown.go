@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClientClosed is returned for requests sent through a closed Client.
+var ErrClientClosed = errors.New("client closed")
+
+// closeTimeout bounds how long Close waits for requests in flight.
+const closeTimeout = 30 * time.Second
+
+// Close rejects new requests with ErrClientClosed, waits up to 30s for those
+// in flight and closes the idle connections of the Client.
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	return c.Shutdown(ctx)
+}
+
+// Shutdown is Close waiting for the requests in flight until ctx is done, in
+// which case the context error is returned.
+func (c *Client) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&c.closed, 1)
+	c.closeIdleConnections()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for c.InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	c.closeIdleConnections()
+	return nil
+}
+
+// CloseIdleConnections closes the idle connections of the default client and
+// transport, which stay usable.
+func CloseIdleConnections() {
+	defaultClient.closeIdleConnections()
+	defaultTransport.CloseIdleConnections()
+}
+
+func (c *Client) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func (c *Client) closeIdleConnections() {
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+
+	for _, client := range c.clients {
+		client.CloseIdleConnections()
+	}
+	for _, transport := range c.transports {
+		transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hmacServer verifies the default HMACSigner canonical string and fails the
+// first attempt of every path with a 503.
+func hmacServer(t *testing.T, secret string, timestamps *[]string) *httptest.Server {
+	seen := make(map[string]bool)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodySum := sha256.Sum256(body)
+		timestamp := r.Header.Get("X-Timestamp")
+		*timestamps = append(*timestamps, timestamp)
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.Method + "\n" + r.URL.Path + "\n" + timestamp + "\n" + hex.EncodeToString(bodySum[:])))
+		if hex.EncodeToString(mac.Sum(nil)) != r.Header.Get("X-Signature") {
+			t.Errorf("%s %s: bad signature", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if !seen[r.URL.Path] {
+			seen[r.URL.Path] = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+}
+
+func TestHMACSignerSignsEveryAttempt(t *testing.T) {
+	var timestamps []string
+	srv := hmacServer(t, "secret", &timestamps)
+	defer srv.Close()
+
+	clock := int64(1000)
+	signer := &HMACSigner{Secret: []byte("secret"), Now: func() time.Time {
+		clock++
+		return time.Unix(clock, 0)
+	}}
+	retry := WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	status, _, err := HttpReqJSON("POST", srv.URL+"/json", []byte(`{"a":1}`), nil, nil, nil, 5, nil,
+		WithSigner(signer), WithRetryNonIdempotent(), retry)
+	if err != nil || status != http.StatusOK {
+		t.Fatal(status, err)
+	}
+	if len(timestamps) != 2 || timestamps[0] != "1001" || timestamps[1] != "1002" {
+		t.Errorf("timestamps %v, want a fresh one per attempt", timestamps)
+	}
+
+	file := FileItem{Key: "f", FileName: "x.txt", Reader: strings.NewReader("data")}
+	status, _, err = HttpReqPostFile(srv.URL+"/file", map[string]string{"a": "b"}, file, nil, nil, nil, 5, nil,
+		WithSigner(signer), WithRetryNonIdempotent(), retry)
+	if err != nil || status != http.StatusOK {
+		t.Fatal(status, err)
+	}
+}
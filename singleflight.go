@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// WithSingleflight makes concurrent identical requests share a single network
+// call. Requests are identical when method, URL, token, body, headers, cookie,
+// transport and timeout match. Only GET and HEAD are shared unless other
+// methods are given. Each caller receives its own copy of the body.
+func WithSingleflight(methods ...string) Option {
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD"}
+	}
+	return func(o *options) {
+		o.singleflight = make(map[string]struct{}, len(methods))
+		for _, method := range methods {
+			o.singleflight[strings.ToUpper(method)] = struct{}{}
+		}
+	}
+}
+
+type flight struct {
+	done chan struct{}
+
+	status int
+	body   []byte
+	err    error
+	info   ResponseInfo
+}
+
+func (o *options) flightKey(method, urlString, token string, data []byte, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int) (string, bool) {
+	if _, ok := o.singleflight[method]; !ok || o.spill != nil || o.download != nil || o.stream != nil {
+		return "", false
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n%q\n%p %d\n%x\n", method, urlString, token, transport, timeout, sha256.Sum256(data))
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %q\n", http.CanonicalHeaderKey(key), headers[key])
+	}
+	for _, h := range o.addedHeaders {
+		fmt.Fprintf(&b, "+%s: %q\n", h.key, h.value)
+	}
+	for _, h := range o.rawHeaders {
+		fmt.Fprintf(&b, "=%s: %q\n", h.key, h.value)
+	}
+	if cookie != nil {
+		fmt.Fprintf(&b, "cookie: %q\n", cookie.String())
+	}
+	if o.authorization != "" {
+		fmt.Fprintf(&b, "authorization: %q\n", o.authorization)
+	}
+	if o.tokenSource != nil {
+		fmt.Fprintf(&b, "tokens: %p\n", o.tokenSource)
+	}
+	if o.digest != nil {
+		fmt.Fprintf(&b, "digest: %q\n", o.digest[0]+":"+o.digest[1])
+	}
+	return b.String(), true
+}
+
+// shareFlight runs send unless an identical request is in flight, in which
+// case its result is waited for and copied.
+func (c *Client) shareFlight(o *options, key string, send func() (int, []byte, error)) (int, []byte, error) {
+	c.flightsMu.Lock()
+	if f, ok := c.flights[key]; ok {
+		c.flightsMu.Unlock()
+
+		select {
+		case <-f.done:
+		case <-o.context().Done():
+			return 0, nil, o.classify(&ResourceError{Err: o.context().Err(), Message: "waiting for a shared request"})
+		}
+
+		*o.info = f.info
+		return f.status, copyBytes(f.body), copyError(f.err)
+	}
+
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.flightsMu.Unlock()
+
+	status, body, err := send()
+
+	f.status, f.body, f.err, f.info = status, copyBytes(body), copyError(err), *o.info
+	c.flightsMu.Lock()
+	delete(c.flights, key)
+	c.flightsMu.Unlock()
+	close(f.done)
+
+	return status, body, err
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// copyError gives each caller its own ResourceError, which decoding may modify.
+func copyError(err error) error {
+	re, ok := err.(*ResourceError)
+	if !ok {
+		return err
+	}
+	errCopy := *re
+	return &errCopy
+}
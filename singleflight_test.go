@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSingleflightKeepsBodiesApart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		time.Sleep(50 * time.Millisecond)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithSingleflight("POST"))
+	bodies := []string{"a", "b", "a", "b"}
+	got := make([]string, len(bodies))
+
+	var wg sync.WaitGroup
+	for i, body := range bodies {
+		wg.Add(1)
+		go func(i int, body string) {
+			defer wg.Done()
+			_, response, err := HttpReqJSON("POST", srv.URL, []byte(body), nil, nil, nil, 5, nil, WithClient(client))
+			if err != nil {
+				t.Error(err)
+			}
+			got[i] = string(response)
+		}(i, body)
+	}
+	wg.Wait()
+
+	for i, body := range bodies {
+		if got[i] != body {
+			t.Errorf("request %d with body %q got %q", i, body, got[i])
+		}
+	}
+}
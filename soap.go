@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// SOAPFault is returned when the Body of a SOAP response holds a Fault,
+// whatever the status.
+type SOAPFault struct {
+	// Code is the faultcode, or the Code Value with SOAP 1.2, e.g. "soap:Server".
+	Code string
+	// Subcode is the Subcode Value of SOAP 1.2 faults.
+	Subcode string
+	// String is the faultstring, or the first Reason Text with SOAP 1.2.
+	String string
+	// Actor is the faultactor, or the Role with SOAP 1.2.
+	Actor string
+	// Detail is the XML content of the detail element, see DecodeDetail.
+	Detail string
+	// Err is the ResourceError of a response which was not successful.
+	Err error
+
+	// namespaces are the prefixes in scope of the detail element.
+	namespaces map[string]string
+}
+
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("soap fault %s: %s", f.Code, f.String)
+}
+
+func (f *SOAPFault) Unwrap() error {
+	return f.Err
+}
+
+// DecodeDetail unmarshals the first element of the detail into v, resolving
+// the namespace prefixes declared by the envelope.
+func (f *SOAPFault) DecodeDetail(v interface{}) error {
+	prefixes := make([]string, 0, len(f.namespaces))
+	for prefix := range f.namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	var buf bytes.Buffer
+	buf.WriteString("<detail")
+	for _, prefix := range prefixes {
+		name := "xmlns"
+		if prefix != "" {
+			name += ":" + prefix
+		}
+		buf.WriteString(" " + name + `="`)
+		xml.EscapeText(&buf, []byte(f.namespaces[prefix]))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">" + f.Detail + "</detail>")
+
+	decoder := xml.NewDecoder(&buf)
+	if _, _, err := nextStartElement(decoder); err != nil {
+		return err
+	}
+	start, ok, err := nextStartElement(decoder)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the fault has no detail")
+	}
+	return decoder.DecodeElement(v, &start)
+}
+
+// WithSOAP12 makes HttpReqSOAP send SOAP 1.2 envelopes, the action going in the
+// Content-Type instead of the SOAPAction header.
+func WithSOAP12() Option {
+	return func(o *options) {
+		o.soap12 = true
+	}
+}
+
+// HttpReqSOAP posts bodyPayload wrapped in a SOAP 1.1 envelope, with soapAction
+// in the SOAPAction header, and unmarshals the first element of the response
+// Body into respPayload. A []byte bodyPayload is sent as is inside the Body. A
+// Fault in the response is returned as a SOAPFault.
+func HttpReqSOAP(urlString, soapAction string, bodyPayload, respPayload interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	o := newOptions(opts)
+
+	namespace, contentType := soap11Namespace, "text/xml; charset=utf-8"
+	if o.soap12 {
+		namespace, contentType = soap12Namespace, "application/soap+xml; charset=utf-8"
+		if soapAction != "" {
+			contentType += fmt.Sprintf("; action=%q", soapAction)
+		}
+	} else if _, ok := headerKey(headers, "SOAPAction"); !ok && soapAction != "" {
+		o.rawHeaders = append(o.rawHeaders, headerValue{key: "SOAPAction", value: fmt.Sprintf("%q", soapAction)})
+	}
+
+	body, err := soapEnvelope(namespace, bodyPayload)
+	if err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err, Message: err.Error()}
+	}
+	headers = o.withContentType(headers, "POST", body, contentType)
+
+	httpStatus, responseBody, err = sendHttpReq(o, "POST", urlString, "", body, headers, cookie, transport, timeout)
+	if len(responseBody) == 0 || hasNoContent(httpStatus) {
+		return
+	}
+
+	if err != nil {
+		respPayload = nil
+	}
+	fault, decodeErr := o.decodeSOAP(responseBody, respPayload)
+	switch {
+	case fault != nil:
+		fault.Err = err
+		return httpStatus, responseBody, fault
+	case err != nil:
+		return
+	case decodeErr != nil:
+		return httpStatus, responseBody, o.decodeError(decodeErr, responseBody)
+	}
+
+	if respPayload != nil {
+		o.info.Decoded = true
+		o.info.Format = FormatXML
+	}
+	return
+}
+
+func soapEnvelope(namespace string, payload interface{}) ([]byte, error) {
+	var content []byte
+	switch p := payload.(type) {
+	case nil:
+	case []byte:
+		content = p
+	default:
+		var err error
+		if content, err = xml.Marshal(p); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + namespace + `"><soap:Body>`)
+	buf.Write(content)
+	buf.WriteString(`</soap:Body></soap:Envelope>`)
+	return buf.Bytes(), nil
+}
+
+// decodeSOAP finds the Body of the envelope in data and decodes its first
+// element into v, or returns the Fault it holds.
+func (o *options) decodeSOAP(data []byte, v interface{}) (*SOAPFault, error) {
+	decoder, err := o.xmlDecoder(bytes.TrimPrefix(data, utf8BOM))
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := map[string]string{}
+	start, _, err := nextStartElement(decoder)
+	if err != nil {
+		return nil, err
+	}
+	namespace := start.Name.Space
+	if start.Name.Local != "Envelope" || (namespace != soap11Namespace && namespace != soap12Namespace) {
+		return nil, fmt.Errorf("expected a SOAP Envelope, found %s", start.Name.Local)
+	}
+	addNamespaces(namespaces, start)
+
+	for {
+		start, ok, err := nextStartElement(decoder)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("the SOAP Envelope has no Body")
+		}
+		if start.Name.Local == "Body" && start.Name.Space == namespace {
+			addNamespaces(namespaces, start)
+			break
+		}
+		if err = decoder.Skip(); err != nil {
+			return nil, err
+		}
+	}
+
+	start, ok, err := nextStartElement(decoder)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if start.Name.Local == "Fault" && start.Name.Space == namespace {
+		addNamespaces(namespaces, start)
+		return decodeSOAPFault(decoder, namespaces)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	return nil, decoder.DecodeElement(v, &start)
+}
+
+func decodeSOAPFault(decoder *xml.Decoder, namespaces map[string]string) (*SOAPFault, error) {
+	fault := &SOAPFault{}
+	for {
+		start, ok, err := nextStartElement(decoder)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return fault, nil
+		}
+
+		switch start.Name.Local {
+		case "faultcode":
+			err = decoder.DecodeElement(&fault.Code, &start)
+		case "faultstring":
+			err = decoder.DecodeElement(&fault.String, &start)
+		case "faultactor", "Role":
+			err = decoder.DecodeElement(&fault.Actor, &start)
+		case "Code":
+			var code struct {
+				Value   string `xml:"Value"`
+				Subcode string `xml:"Subcode>Value"`
+			}
+			err = decoder.DecodeElement(&code, &start)
+			fault.Code, fault.Subcode = code.Value, strings.TrimSpace(code.Subcode)
+		case "Reason":
+			var reason struct {
+				Text []string `xml:"Text"`
+			}
+			if err = decoder.DecodeElement(&reason, &start); err == nil && len(reason.Text) != 0 {
+				fault.String = reason.Text[0]
+			}
+		case "detail", "Detail":
+			var detail struct {
+				Inner string `xml:",innerxml"`
+			}
+			err = decoder.DecodeElement(&detail, &start)
+			fault.Detail = strings.TrimSpace(detail.Inner)
+
+			fault.namespaces = make(map[string]string, len(namespaces))
+			for prefix, uri := range namespaces {
+				fault.namespaces[prefix] = uri
+			}
+			addNamespaces(fault.namespaces, start)
+		default:
+			err = decoder.Skip()
+		}
+		if err != nil {
+			return nil, err
+		}
+		fault.Code = strings.TrimSpace(fault.Code)
+		fault.String = strings.TrimSpace(fault.String)
+		fault.Actor = strings.TrimSpace(fault.Actor)
+	}
+}
+
+// nextStartElement reads up to the next child element, ok is false when the
+// parent element ends first.
+func nextStartElement(decoder *xml.Decoder) (start xml.StartElement, ok bool, err error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return start, false, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			return t, true, nil
+		case xml.EndElement:
+			return start, false, nil
+		}
+	}
+}
+
+// addNamespaces records the namespace prefixes declared by start.
+func addNamespaces(namespaces map[string]string, start xml.StartElement) {
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "xmlns":
+			namespaces[attr.Name.Local] = attr.Value
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			namespaces[""] = attr.Value
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Responses of a stock quote service, with the prefixes a server picks rather
+// than the ones the package sends.
+const (
+	soapPriceResponse = `<?xml version="1.0"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:m="http://example.com/stock">
+  <soapenv:Header><m:Trace>1</m:Trace></soapenv:Header>
+  <soapenv:Body>
+    <m:GetPriceResponse><m:Price>34.5</m:Price></m:GetPriceResponse>
+  </soapenv:Body>
+</soapenv:Envelope>`
+
+	soapFault = `<?xml version="1.0"?>
+<S:Envelope xmlns:S="http://schemas.xmlsoap.org/soap/envelope/" xmlns:st="http://example.com/stock">
+  <S:Body>
+    <S:Fault>
+      <faultcode>S:Server</faultcode>
+      <faultstring> out of stock </faultstring>
+      <detail><st:StockFault><st:Reason>none</st:Reason></st:StockFault></detail>
+    </S:Fault>
+  </S:Body>
+</S:Envelope>`
+
+	soap12Fault = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Body>
+    <env:Fault>
+      <env:Code><env:Value>env:Sender</env:Value><env:Subcode><env:Value>m:Bad</env:Value></env:Subcode></env:Code>
+      <env:Reason><env:Text xml:lang="en">bad</env:Text></env:Reason>
+      <env:Detail><x xmlns="http://example.com/stock"/></env:Detail>
+    </env:Fault>
+  </env:Body>
+</env:Envelope>`
+)
+
+type getPrice struct {
+	XMLName xml.Name `xml:"http://example.com/stock GetPrice"`
+	Item    string   `xml:"Item"`
+}
+
+type getPriceResponse struct {
+	XMLName xml.Name `xml:"http://example.com/stock GetPriceResponse"`
+	Price   float64  `xml:"http://example.com/stock Price"`
+}
+
+type stockFault struct {
+	XMLName xml.Name `xml:"http://example.com/stock StockFault"`
+	Reason  string   `xml:"http://example.com/stock Reason"`
+}
+
+// soapServer records the last request and answers with the fixture for the
+// path.
+type soapServer struct {
+	body, action, contentType string
+}
+
+func (s *soapServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.body, s.action, s.contentType = string(body), r.Header.Get("SOAPAction"), r.Header.Get("Content-Type")
+
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	switch r.URL.Path {
+	case "/fault":
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(soapFault))
+	case "/fault12":
+		w.Write([]byte(soap12Fault))
+	default:
+		w.Write([]byte(soapPriceResponse))
+	}
+}
+
+func TestSOAPEnvelope(t *testing.T) {
+	handler := &soapServer{}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	var resp getPriceResponse
+	status, _, err := HttpReqSOAP(srv.URL, "http://example.com/GetPrice", getPrice{Item: "x"}, &resp, nil, nil, nil, 5)
+	if err != nil || status != http.StatusOK {
+		t.Fatal(status, err)
+	}
+	if resp.Price != 34.5 {
+		t.Errorf("Price %v, want 34.5", resp.Price)
+	}
+	if handler.action != `"http://example.com/GetPrice"` {
+		t.Errorf("SOAPAction %s", handler.action)
+	}
+	if !strings.HasPrefix(handler.contentType, "text/xml") {
+		t.Errorf("Content-Type %s", handler.contentType)
+	}
+	if !strings.Contains(handler.body, `<soap:Body><GetPrice xmlns="http://example.com/stock"><Item>x</Item></GetPrice></soap:Body>`) {
+		t.Errorf("sent %s", handler.body)
+	}
+}
+
+func TestSOAPFault(t *testing.T) {
+	handler := &soapServer{}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	var resp getPriceResponse
+	_, _, err := HttpReqSOAP(srv.URL+"/fault", "GetPrice", nil, &resp, nil, nil, nil, 5)
+	var fault *SOAPFault
+	var resourceErr *ResourceError
+	if !errors.As(err, &fault) || !errors.As(err, &resourceErr) {
+		t.Fatalf("got %v, want a SOAPFault in a ResourceError", err)
+	}
+	if resourceErr.HTTPCode != http.StatusInternalServerError || fault.Code != "S:Server" || fault.String != "out of stock" {
+		t.Errorf("got %d %+v", resourceErr.HTTPCode, fault)
+	}
+	var detail stockFault
+	if err := fault.DecodeDetail(&detail); err != nil || detail.Reason != "none" {
+		t.Errorf("detail %+v: %v", detail, err)
+	}
+
+	_, _, err = HttpReqSOAP(srv.URL+"/fault12", "GetPrice", nil, &resp, nil, nil, nil, 5, WithSOAP12())
+	if !errors.As(err, &fault) {
+		t.Fatalf("got %v, want a SOAPFault", err)
+	}
+	if fault.Code != "env:Sender" || fault.Subcode != "m:Bad" || fault.String != "bad" {
+		t.Errorf("got %+v", fault)
+	}
+	if handler.action != "" || handler.contentType != `application/soap+xml; charset=utf-8; action="GetPrice"` {
+		t.Errorf("SOAP 1.2 sent SOAPAction %q, Content-Type %q", handler.action, handler.contentType)
+	}
+	if !strings.Contains(handler.body, soap12Namespace) {
+		t.Errorf("sent %s", handler.body)
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"syscall"
+	"time"
+)
+
+// tcpUserTimeout is TCP_USER_TIMEOUT, missing from the syscall package.
+const tcpUserTimeout = 0x12
+
+func tcpUserTimeoutControl(d time.Duration) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, int(d/time.Millisecond))
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import (
+	"syscall"
+	"time"
+)
+
+func tcpUserTimeoutControl(time.Duration) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
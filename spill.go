@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+type spill struct {
+	threshold int64
+	dir       string
+	file      **os.File
+}
+
+// WithSpillFile streams a successful response body larger than threshold bytes
+// into a temporary file in dir (os.TempDir when empty) instead of memory. The
+// file, positioned at its start, is stored in file and the returned body is
+// nil, so nothing is decoded. The caller owns the file, see RemoveSpillFile.
+// Error statuses read at most threshold bytes for the ResourceError.
+func WithSpillFile(threshold int64, dir string, file **os.File) Option {
+	return func(o *options) {
+		*file = nil
+		o.spill = &spill{threshold: threshold, dir: dir, file: file}
+	}
+}
+
+// RemoveSpillFile closes and removes a file stored by WithSpillFile, nil is a no-op.
+func RemoveSpillFile(f *os.File) error {
+	if f == nil {
+		return nil
+	}
+
+	closeErr := f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if closeErr != nil && closeErr != os.ErrClosed {
+		return closeErr
+	}
+	return nil
+}
+
+// readSpilled reads up to the threshold into memory and spills the rest of a
+// larger body, with what was already read, into a temporary file.
+func (o *options) readSpilled(body io.Reader, contentLength int64) ([]byte, error) {
+	head := &io.LimitedReader{R: body, N: o.spill.threshold + 1}
+	if contentLength > o.spill.threshold {
+		head.N, contentLength = 0, 0
+	}
+
+	buf, err := o.readBody(head, contentLength)
+	if err != nil || head.N > 0 {
+		return buf, err
+	}
+
+	f, err := ioutil.TempFile(o.spill.dir, "http-utils-*")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(f, io.MultiReader(bytes.NewReader(buf), body)); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		RemoveSpillFile(f)
+		return nil, err
+	}
+
+	*o.spill.file = f
+	return nil, nil
+}
+
+// spillRest handles a spilled body which reached WithMaxResponseBytes: the file
+// is removed, or completed when the limit is only warned about.
+func (o *options) spillRest(body io.Reader, limit int64) error {
+	f := *o.spill.file
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	tooLarge := &ResponseTooLargeError{Limit: limit, Read: info.Size(), ContentLength: -1}
+	if err = o.enforce(RuleMaxResponseSize, strconv.FormatInt(tooLarge.Read, 10)+"+", tooLarge); err != nil {
+		*o.spill.file = nil
+		RemoveSpillFile(f)
+		return err
+	}
+
+	if _, err = f.Seek(0, io.SeekEnd); err == nil {
+		if _, err = io.Copy(f, body); err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		*o.spill.file = nil
+		RemoveSpillFile(f)
+	}
+	return err
+}
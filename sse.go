@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStopSubscription is returned by a Subscribe handler to end it cleanly.
+var ErrStopSubscription = errors.New("stop subscription")
+
+// ErrStreamClosed is returned by Subscribe when the server ended the stream
+// and no reconnection is left, see WithSSEMaxReconnects.
+var ErrStreamClosed = errors.New("event stream closed by the server")
+
+const (
+	defaultSSEBackoff = 3 * time.Second
+	defaultSSEMaxWait = 30 * time.Second
+)
+
+// Event is a server-sent event received by Subscribe.
+type Event struct {
+	// ID is the last event ID sent by the server, it is kept from earlier
+	// events when this one has none.
+	ID string
+	// Type is "message" unless the event names one.
+	Type string
+	// Data joins the data lines of the event with "\n".
+	Data string
+	// Retry is the reconnection time sent with the event, 0 when there is none.
+	Retry time.Duration
+}
+
+// WithSSEBackoff sets the wait before Subscribe reconnects, doubled after each
+// consecutive failure up to max. A reconnection time sent by the server
+// replaces base. 3 and 30 seconds by default.
+func WithSSEBackoff(base, max time.Duration) Option {
+	return func(o *options) {
+		o.sseBackoff = base
+		o.sseMaxWait = max
+	}
+}
+
+// WithSSEMaxReconnects limits Subscribe to n consecutive reconnections without
+// receiving an event. There is no limit by default.
+func WithSSEMaxReconnects(n int) Option {
+	return func(o *options) {
+		o.sseMaxReconnects = n
+	}
+}
+
+// Subscribe receives the server-sent events of urlString and passes them to
+// onEvent. When the stream ends or the connection fails it reconnects after a
+// backoff, sending the last event ID in Last-Event-ID. A response other than
+// 200 with text/event-stream, 204 included, returns a ResourceError without
+// reconnecting, and a stream closed by the server once the reconnections are
+// used up returns ErrStreamClosed. Subscribe ends when ctx is done, returning
+// its error, or when onEvent returns an error, which is returned unless it is
+// ErrStopSubscription. There is no default timeout.
+func Subscribe(ctx context.Context, urlString string, onEvent func(Event) error, opts ...Option) error {
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx), withoutTimeout())
+	o := newOptions(opts)
+
+	base, max := o.sseBackoff, o.sseMaxWait
+	if base <= 0 {
+		base = defaultSSEBackoff
+	}
+	if max <= 0 {
+		max = defaultSSEMaxWait
+	}
+	maxLineSize := o.maxLineSize
+	if maxLineSize <= 0 {
+		maxLineSize = defaultMaxLineSize
+	}
+
+	parser := &sseParser{}
+	failures := 0
+	for {
+		var (
+			handlerErr error
+			rejected   *ResourceError
+			received   bool
+		)
+		consume := func(response *http.Response, body io.Reader) error {
+			mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+			if response.StatusCode != http.StatusOK || mediaType != "text/event-stream" {
+				rejected = &ResourceError{
+					URL:      urlString,
+					HTTPCode: response.StatusCode,
+					Err:      fmt.Errorf("expected a 200 text/event-stream response, got %d %q", response.StatusCode, mediaType),
+				}
+				return nil
+			}
+
+			return parser.read(body, maxLineSize, func(event Event) error {
+				received = true
+				handlerErr = onEvent(event)
+				return handlerErr
+			})
+		}
+
+		headers := map[string]string{
+			"Accept":        "text/event-stream",
+			"Cache-Control": "no-cache",
+		}
+		if parser.lastID != "" {
+			headers["Last-Event-ID"] = parser.lastID
+		}
+
+		status, _, err := httpDownload("GET", urlString, "", nil, &download{consume: consume}, headers, nil, nil, 0, opts)
+
+		var decodeErr *DecodeError
+		switch {
+		case handlerErr != nil:
+			if handlerErr == ErrStopSubscription {
+				return nil
+			}
+			return handlerErr
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case rejected != nil:
+			return rejected
+		case status != 0 && status != http.StatusOK, errors.As(err, &decodeErr):
+			return err
+		}
+
+		if received {
+			failures = 0
+		}
+		failures++
+		if o.sseMaxReconnects > 0 && failures > o.sseMaxReconnects {
+			if err == nil {
+				err = ErrStreamClosed
+			}
+			return err
+		}
+
+		first := base
+		if parser.retry > 0 {
+			first = parser.retry
+		}
+		timer := time.NewTimer(sseDelay(first, max, failures))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// sseDelay doubles first for each failure after the first one, up to max
+// unless first already exceeds it.
+func sseDelay(first, max time.Duration, failures int) time.Duration {
+	delay := first
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max && first <= max {
+		delay = max
+	}
+	return delay
+}
+
+// sseParser keeps the state which outlives a connection.
+type sseParser struct {
+	lastID string
+	retry  time.Duration
+}
+
+// read parses the event stream body, passing complete events to dispatch. An
+// event cut by the end of the stream is dropped.
+func (p *sseParser) read(body io.Reader, maxLineSize int, dispatch func(Event) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	scanner.Split(scanSSELines)
+
+	var (
+		eventType  string
+		data       strings.Builder
+		eventRetry time.Duration
+	)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, string(utf8BOM))
+			first = false
+		}
+
+		if line == "" {
+			if data.Len() != 0 {
+				event := Event{ID: p.lastID, Type: eventType, Data: strings.TrimSuffix(data.String(), "\n"), Retry: eventRetry}
+				if event.Type == "" {
+					event.Type = "message"
+				}
+				if err := dispatch(event); err != nil {
+					return err
+				}
+			}
+			eventType, eventRetry = "", 0
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				p.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				eventRetry = time.Duration(ms) * time.Millisecond
+				p.retry = eventRetry
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return &DecodeError{ContentType: "text/event-stream", HTTPCode: http.StatusOK, Err: fmt.Errorf("line longer than %d bytes", maxLineSize)}
+		}
+		return err
+	}
+	return nil
+}
+
+// scanSSELines splits lines ending with "\r\n", "\n" or "\r". A last line
+// without an ending is dropped.
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	i := bytes.IndexAny(data, "\r\n")
+	if i < 0 {
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	}
+
+	if data[i] == '\r' {
+		if i+1 == len(data) && !atEOF {
+			// the "\n" of "\r\n" may be in the next read
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+	}
+	return i + 1, data[:i], nil
+}
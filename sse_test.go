@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSEParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []Event
+	}{
+		{
+			"multi-line data",
+			"data: a\ndata:b\ndata\n\n",
+			[]Event{{Type: "message", Data: "a\nb\n"}},
+		},
+		{
+			"id, type and retry",
+			"id: 7\nevent: ping\nretry: 1500\ndata: x\n\ndata: y\n\n",
+			[]Event{
+				{ID: "7", Type: "ping", Data: "x", Retry: 1500 * time.Millisecond},
+				{ID: "7", Type: "message", Data: "y"},
+			},
+		},
+		{
+			"comments and events without data",
+			": keep-alive\n\nevent: empty\n\n:\ndata: z\n\n",
+			[]Event{{Type: "message", Data: "z"}},
+		},
+		{
+			"BOM and CR line endings",
+			"\ufeffdata: a\r\n\r\ndata: b\r\rdata: c\n\n",
+			[]Event{{Type: "message", Data: "a"}, {Type: "message", Data: "b"}, {Type: "message", Data: "c"}},
+		},
+		{
+			"invalid retry and id with NUL",
+			"id: 1\n\nid: a\x00b\nretry: soon\ndata: x\n\n",
+			[]Event{{ID: "1", Type: "message", Data: "x"}},
+		},
+		{
+			"event cut by the end of the stream",
+			"data: a\n\ndata: partial",
+			[]Event{{Type: "message", Data: "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		var got []Event
+		parser := &sseParser{}
+		err := parser.read(strings.NewReader(tt.stream), defaultMaxLineSize, func(event Event) error {
+			got = append(got, event)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubscribeReconnects(t *testing.T) {
+	var mu sync.Mutex
+	var lastIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		connection := len(lastIDs)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch connection {
+		case 1:
+			fmt.Fprint(w, "retry: 10\nid: 1\ndata: a\n\n")
+		case 2:
+			// closed without an event
+		default:
+			fmt.Fprintf(w, "id: %d\ndata: b\n\n", connection)
+		}
+	}))
+	defer srv.Close()
+
+	var events []Event
+	started := time.Now()
+	err := Subscribe(context.Background(), srv.URL, func(event Event) error {
+		events = append(events, event)
+		if len(events) == 2 {
+			return ErrStopSubscription
+		}
+		return nil
+	}, WithSSEBackoff(time.Hour, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"", "1", "1"}; !reflect.DeepEqual(lastIDs, want) {
+		t.Errorf("sent Last-Event-ID %q, want %q", lastIDs, want)
+	}
+	if len(events) != 2 || events[1].ID != "3" {
+		t.Errorf("events %+v", events)
+	}
+	// the retry of the server replaces the backoff: 10ms, then 20ms
+	if elapsed := time.Since(started); elapsed < 30*time.Millisecond || elapsed > time.Second {
+		t.Errorf("reconnected after %v", elapsed)
+	}
+}
+
+func TestSubscribeEnds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+	}))
+	defer srv.Close()
+
+	ignore := func(Event) error { return nil }
+	backoff := WithSSEBackoff(time.Millisecond, 4*time.Millisecond)
+
+	var re *ResourceError
+	err := Subscribe(context.Background(), srv.URL+"/error", ignore, backoff)
+	if !errors.As(err, &re) || re.HTTPCode != http.StatusInternalServerError {
+		t.Errorf("500: got %v", err)
+	}
+	err = Subscribe(context.Background(), srv.URL+"/html", ignore, backoff)
+	if !errors.As(err, &re) || re.HTTPCode != http.StatusOK {
+		t.Errorf("text/html: got %v", err)
+	}
+	err = Subscribe(context.Background(), srv.URL+"/closed", ignore, backoff, WithSSEMaxReconnects(2))
+	if err != ErrStreamClosed {
+		t.Errorf("closed stream: got %v, want ErrStreamClosed", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = Subscribe(ctx, srv.URL+"/closed", ignore, backoff); err != context.DeadlineExceeded {
+		t.Errorf("ctx: got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSSEDelay(t *testing.T) {
+	tests := []struct {
+		first, max time.Duration
+		failures   int
+		want       time.Duration
+	}{
+		{time.Second, 30 * time.Second, 1, time.Second},
+		{time.Second, 30 * time.Second, 3, 4 * time.Second},
+		{time.Second, 30 * time.Second, 10, 30 * time.Second},
+		// a server retry above max is kept
+		{time.Minute, 30 * time.Second, 3, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := sseDelay(tt.first, tt.max, tt.failures); got != tt.want {
+			t.Errorf("sseDelay(%v, %v, %d) = %v, want %v", tt.first, tt.max, tt.failures, got, tt.want)
+		}
+	}
+}
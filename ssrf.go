@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+)
+
+// RuleSSRF is broken by a request to a host which resolves to a loopback,
+// private, link-local or unspecified address, see WithBlockPrivateNetworks.
+const RuleSSRF Rule = "ssrf"
+
+// WithBlockPrivateNetworks rejects requests to hosts which resolve to loopback,
+// private, link-local or unspecified addresses. The host is resolved before the
+// request, through the DNSCache of WithDNSCache when set.
+func WithBlockPrivateNetworks() Option {
+	return func(o *options) {
+		o.blockPrivate = true
+	}
+}
+
+// checkPrivate applies WithBlockPrivateNetworks to host. Hosts which don't
+// resolve are let through, the dial fails for them anyway.
+func (o *options) checkPrivate(host string) error {
+	if !o.blockPrivate || o.unixSocket != "" {
+		return nil
+	}
+
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		var resolver Resolver = net.DefaultResolver
+		if o.dnsCache != nil {
+			resolver = o.dnsCache
+		}
+
+		var err error
+		if addrs, err = resolver.LookupHost(o.context(), host); err != nil {
+			return nil
+		}
+	}
+
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && isPrivateIP(ip) {
+			err := fmt.Errorf("host %q resolves to the private address %s", host, addr)
+			return o.enforce(RuleSSRF, addr, err)
+		}
+	}
+	return nil
+}
+
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
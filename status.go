@@ -0,0 +1,32 @@
+package utils
+
+// WithAcceptStatus treats the given codes as successful in addition to the
+// default ones, so no ResourceError is returned and the body is decoded.
+func WithAcceptStatus(codes ...int) Option {
+	return func(o *options) {
+		if o.acceptStatus == nil {
+			o.acceptStatus = make(map[int]struct{}, len(codes))
+		}
+		for _, code := range codes {
+			o.acceptStatus[code] = struct{}{}
+		}
+	}
+}
+
+// WithSuccessStatus replaces the default check (status < 400) with fn.
+// WithAcceptStatus is ignored when fn is set.
+func WithSuccessStatus(fn func(status int) bool) Option {
+	return func(o *options) {
+		o.successStatus = fn
+	}
+}
+
+func (o *options) isSuccess(status int) bool {
+	if o.successStatus != nil {
+		return o.successStatus(status)
+	}
+	if _, ok := o.acceptStatus[status]; ok {
+		return true
+	}
+	return status <= 399
+}
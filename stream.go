@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ErrBodyNotRewindable is returned when retries are requested for a request
+// whose body reader is not an io.ReadSeeker.
+var ErrBodyNotRewindable = errors.New("retrying needs an io.ReadSeeker body")
+
+// streamBody is a request body produced while the request is sent. open is
+// called for every attempt, a body which is not replayable can be sent once.
+type streamBody struct {
+	open       func() (io.ReadCloser, error)
+	replayable bool
+	length     int64
+}
+
+// HttpReqReaderJSON sends body as it is read instead of buffering it, and decodes
+// a JSON response. contentLength is -1 when unknown, the body is sent chunked
+// then. Retries and failover require body to be an io.ReadSeeker, it is rewound
+// to its current offset before each attempt.
+func HttpReqReaderJSON(method, urlString, token string, body io.Reader, contentLength int64, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	method = strings.TrimSpace(strings.ToUpper(method))
+
+	open, replayable, err := rewinder(body)
+	if err != nil {
+		return httpStatus, nil, &ResourceError{URL: urlString, Err: err}
+	}
+
+	opts = withStream(opts, &streamBody{
+		open:       func() (io.ReadCloser, error) { r, err := open(); return ioutil.NopCloser(r), err },
+		replayable: replayable,
+		length:     contentLength,
+	})
+	return httpReq(FormatJSON, "application/octet-stream", method, urlString, token, nil, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+func withStream(opts []Option, stream *streamBody) []Option {
+	return append(opts[:len(opts):len(opts)], func(o *options) {
+		o.stream = stream
+	})
+}
+
+// rewinder returns a func giving r for the first call and r rewound to its
+// current offset for later ones, which fail unless r is an io.Seeker.
+func rewinder(r io.Reader) (open func() (io.Reader, error), replayable bool, err error) {
+	seeker, ok := r.(io.Seeker)
+	var start int64
+	if ok {
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, false, err
+		}
+	}
+
+	opened := false
+	return func() (io.Reader, error) {
+		if opened {
+			if !ok {
+				return nil, ErrBodyNotRewindable
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		opened = true
+		return r, nil
+	}, ok, nil
+}
+
+// check rejects retries and failover with a body which can't be sent again.
+func (s *streamBody) check(o *options, endpoints int) error {
+	if s.replayable {
+		return nil
+	}
+	if (o.retry != nil && o.retry.MaxAttempts > 1) || endpoints > 1 {
+		return ErrBodyNotRewindable
+	}
+	return nil
+}
+
+// attach opens the body of request for the attempt.
+func (s *streamBody) attach(request *http.Request) error {
+	body, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	request.Body = body
+	request.ContentLength = s.length
+	if s.length == 0 {
+		body.Close()
+		request.Body = http.NoBody
+	}
+
+	// lets 307 and 308 redirects send the body again
+	if s.replayable {
+		request.GetBody = s.open
+	}
+	return nil
+}
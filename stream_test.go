@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// onlyReader hides the io.Seeker of the reader it wraps.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestStreamedBodyReplay(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	retry := WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	// a body already read in part is rewound to where it was
+	seekable := func() io.Reader {
+		r := strings.NewReader("skipped payload")
+		r.Seek(int64(len("skipped ")), io.SeekStart)
+		return r
+	}
+	notSeekable := func() io.Reader {
+		return onlyReader{strings.NewReader("payload")}
+	}
+	tests := []struct {
+		name string
+		body func() io.Reader
+		opts []Option
+		err  error
+		want []string
+	}{
+		{"sent once", notSeekable, nil, nil, []string{"payload"}},
+		{"rewound", seekable, []Option{retry}, nil, []string{"payload", "payload", "payload"}},
+		{"not seekable, retries", notSeekable, []Option{retry}, ErrBodyNotRewindable, nil},
+		{"not seekable, failover", notSeekable, []Option{WithBaseURLs(srv.URL, srv.URL)}, ErrBodyNotRewindable, nil},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		bodies = nil
+		mu.Unlock()
+
+		_, _, err := HttpReqReaderJSON("PUT", srv.URL, "", tt.body(), -1, nil, nil, nil, 5, nil, tt.opts...)
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+		mu.Lock()
+		if strings.Join(bodies, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: the server received %q, want %q", tt.name, bodies, tt.want)
+		}
+		mu.Unlock()
+	}
+}
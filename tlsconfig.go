@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// WithCABundle trusts only the CAs of pemBytes for the server certificates.
+// The transport is cloned rather than changed. Like WithDNSCache it should be
+// passed to NewClient, so the bundle is parsed once.
+func WithCABundle(pemBytes []byte) Option {
+	pool, err := certPool(pemBytes)
+	sum := sha256.Sum256(pemBytes)
+	key := hex.EncodeToString(sum[:])
+
+	return func(o *options) {
+		o.rootCAs, o.rootCAsKey, o.optionErr = pool, key, err
+	}
+}
+
+// WithCAFile is WithCABundle with the CAs read from path when the option is
+// created. Requests fail with the error of reading or parsing it.
+func WithCAFile(path string) Option {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("reading CA file: %w", err)
+		return func(o *options) {
+			o.optionErr = err
+		}
+	}
+
+	opt := WithCABundle(pemBytes)
+	return func(o *options) {
+		opt(o)
+		if o.optionErr != nil {
+			o.optionErr = fmt.Errorf("CA file %s: %w", path, o.optionErr)
+		}
+	}
+}
+
+// WithInsecureSkipTLSVerify accepts any server certificate. It is meant for
+// development only: anyone on the path can read and change the traffic. The
+// requests have InsecureTLS set in their ResponseInfo.
+func WithInsecureSkipTLSVerify() Option {
+	return func(o *options) {
+		o.insecureTLS = true
+	}
+}
+
+// WithTLSMinVersion sets the lowest TLS version accepted, e.g. tls.VersionTLS12.
+func WithTLSMinVersion(version uint16) Option {
+	return func(o *options) {
+		o.tlsMinVersion = version
+	}
+}
+
+// WithTLSMaxVersion sets the highest TLS version offered.
+func WithTLSMaxVersion(version uint16) Option {
+	return func(o *options) {
+		o.tlsMaxVersion = version
+	}
+}
+
+// WithCipherSuites restricts the cipher suites of TLS 1.0 to 1.2. Those of TLS
+// 1.3 are not configurable.
+func WithCipherSuites(suites []uint16) Option {
+	return func(o *options) {
+		o.cipherSuites = suites
+	}
+}
+
+// WithModernTLS applies the intermediate profile of Mozilla's server side TLS
+// guidelines: TLS 1.2 or later with ECDHE key exchange and AEAD ciphers.
+func WithModernTLS() Option {
+	return func(o *options) {
+		o.tlsMinVersion = tls.VersionTLS12
+		o.cipherSuites = []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		}
+	}
+}
+
+// tlsKey describes the TLS options for the variant key of derived transports.
+func (o *options) tlsKey() string {
+	var b strings.Builder
+	if o.rootCAs != nil {
+		fmt.Fprintf(&b, "ca=%s,", o.rootCAsKey)
+	}
+	if o.insecureTLS {
+		b.WriteString("insecure,")
+	}
+	if o.tlsMinVersion != 0 || o.tlsMaxVersion != 0 {
+		fmt.Fprintf(&b, "version=%x-%x,", o.tlsMinVersion, o.tlsMaxVersion)
+	}
+	if o.cipherSuites != nil {
+		fmt.Fprintf(&b, "ciphers=%x,", o.cipherSuites)
+	}
+	return b.String()
+}
+
+// tlsVariant configures a clone of the transport for the TLS options.
+func (o *options) tlsVariant(clone *http.Transport) {
+	if o.tlsKey() == "" {
+		return
+	}
+
+	if clone.TLSClientConfig == nil {
+		clone.TLSClientConfig = &tls.Config{}
+	}
+	if o.rootCAs != nil {
+		clone.TLSClientConfig.RootCAs = o.rootCAs
+	}
+	if o.insecureTLS {
+		clone.TLSClientConfig.InsecureSkipVerify = true
+	}
+	if o.tlsMinVersion != 0 {
+		clone.TLSClientConfig.MinVersion = o.tlsMinVersion
+	}
+	if o.tlsMaxVersion != 0 {
+		clone.TLSClientConfig.MaxVersion = o.tlsMaxVersion
+	}
+	if o.cipherSuites != nil {
+		clone.TLSClientConfig.CipherSuites = o.cipherSuites
+	}
+}
+
+// insecure reports whether the transport skips verifying the server. It is
+// called once a request went through transport: net/http fills in a nil TLS
+// config on first use, so reading it earlier races with other requests.
+func insecure(transport *http.Transport) bool {
+	return transport.TLSClientConfig != nil && transport.TLSClientConfig.InsecureSkipVerify
+}
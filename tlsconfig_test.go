@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSPolicy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	start := func(config *tls.Config) *httptest.Server {
+		srv := httptest.NewUnstartedServer(handler)
+		srv.TLS = config
+		srv.StartTLS()
+		return srv
+	}
+	tls11 := start(&tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11})
+	defer tls11.Close()
+	tls13 := start(&tls.Config{MinVersion: tls.VersionTLS13})
+	defer tls13.Close()
+	cbc := start(&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}})
+	defer cbc.Close()
+
+	tests := []struct {
+		name   string
+		srv    *httptest.Server
+		opt    Option
+		accept bool
+	}{
+		{"min TLS 1.0 on TLS 1.1", tls11, WithTLSMinVersion(tls.VersionTLS10), true},
+		{"modern on TLS 1.1", tls11, WithModernTLS(), false},
+		{"max TLS 1.2 on TLS 1.3", tls13, WithTLSMaxVersion(tls.VersionTLS12), false},
+		{"modern on TLS 1.3", tls13, WithModernTLS(), true},
+		{"modern on CBC", cbc, WithModernTLS(), false},
+		{"CBC suite on CBC", cbc, WithCipherSuites([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}), true},
+	}
+	for _, tt := range tests {
+		_, _, err := HttpReqJSON("GET", tt.srv.URL, nil, nil, nil, nil, 5, nil, WithInsecureSkipTLSVerify(), tt.opt)
+		if tt.accept && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.accept && err == nil {
+			t.Errorf("%s: handshake succeeded", tt.name)
+		}
+	}
+}
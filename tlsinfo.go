@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// TLSInfo describes the TLS connection of a response, without retaining the
+// certificates.
+type TLSInfo struct {
+	Version     uint16
+	CipherSuite uint16
+	ServerName  string
+
+	// Subject, Issuer and DNSNames are those of the leaf certificate.
+	Subject  string
+	Issuer   string
+	DNSNames []string
+
+	// NotAfter is the earliest expiry of the chain presented by the server.
+	NotAfter time.Time
+}
+
+// CertExpiresWithin reports whether a certificate presented for the response
+// of info expires within d. It is false for plain HTTP.
+func CertExpiresWithin(info *ResponseInfo, d time.Duration) bool {
+	if info == nil || info.TLS == nil || info.TLS.NotAfter.IsZero() {
+		return false
+	}
+	return time.Until(info.TLS.NotAfter) < d
+}
+
+func newTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		ServerName:  state.ServerName,
+	}
+	if len(state.PeerCertificates) != 0 {
+		leaf := state.PeerCertificates[0]
+		info.Subject = leaf.Subject.String()
+		info.Issuer = leaf.Issuer.String()
+		info.DNSNames = leaf.DNSNames
+	}
+	for _, cert := range state.PeerCertificates {
+		if info.NotAfter.IsZero() || cert.NotAfter.Before(info.NotAfter) {
+			info.NotAfter = cert.NotAfter
+		}
+	}
+	return info
+}
@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ChecksumMismatchError is returned by DownloadToFile when the digest of the
+// downloaded bytes differs from the expected one. Digests are hex encoded.
+type ChecksumMismatchError struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s, got %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+type checksum struct {
+	algorithm string
+	expected  string
+}
+
+// WithChecksum makes DownloadToFile verify the hex digest expected, computed with
+// algorithm "sha256" or "md5".
+func WithChecksum(algorithm, expected string) Option {
+	return func(o *options) {
+		o.checksum = &checksum{algorithm: strings.ToLower(algorithm), expected: strings.ToLower(expected)}
+	}
+}
+
+// ErrNotModified is returned by DownloadToFile and DownloadToDir when the server
+// answered a conditional download with 304: the file was left as it was.
+var ErrNotModified = errors.New("not modified")
+
+// WithIfModifiedSince makes DownloadToFile send If-Modified-Since with the mtime
+// of the file, which is the Last-Modified of the download which wrote it. Files
+// which don't exist yet or whose mtime is in the future are downloaded
+// unconditionally.
+func WithIfModifiedSince() Option {
+	return func(o *options) {
+		o.sinceFile = true
+	}
+}
+
+// WithLastModified makes DownloadToFile and DownloadToDir send If-Modified-Since
+// with lastModified, the Last-Modified of the copy the caller has. It wins over
+// WithIfModifiedSince.
+func WithLastModified(lastModified string) Option {
+	return func(o *options) {
+		o.lastModified = lastModified
+	}
+}
+
+// DownloadToFile downloads url into path+".tmp", syncs it and renames it to path
+// only when the download and checksum verification succeeded. Without
+// WithChecksum, a Content-MD5, X-Amz-Checksum-Sha256 or X-Amz-Meta-Sha256 response
+// header is verified when present. The file gets the mtime of Last-Modified. It
+// returns the bytes written and their hex digest, sha256 unless the checksum
+// verified is md5. The requests have no timeout of their own, ctx bounds it.
+// Servers sending neither validator answer conditional downloads in full.
+func DownloadToFile(ctx context.Context, url, path string, opts ...Option) (written int64, digest string, err error) {
+	_, written, digest, err = downloadToFile(ctx, url, path, func(*http.Response) (string, error) {
+		return path, nil
+	}, opts)
+	return
+}
+
+// DownloadToDir is DownloadToFile into a file of dir named as
+// ResponseInfo.FileName says. It returns the path of the file.
+func DownloadToDir(ctx context.Context, url, dir string, opts ...Option) (path string, written int64, digest string, err error) {
+	return downloadToFile(ctx, url, "", func(response *http.Response) (string, error) {
+		name := responseFileName(response)
+		if name == "" {
+			return "", fmt.Errorf("the response to %s suggests no file name", redactURL(url))
+		}
+		return filepath.Join(dir, name), nil
+	}, opts)
+}
+
+// downloadToFile implements DownloadToFile with the path picked by pathFor once
+// the response headers are known. known is the path when it is known before.
+func downloadToFile(ctx context.Context, url, known string, pathFor func(response *http.Response) (string, error), opts []Option) (path string, written int64, digest string, err error) {
+	o := newOptions(opts)
+
+	headers := identityEncoding(nil)
+	if since := o.modifiedSince(known); since != "" {
+		headers["If-Modified-Since"] = since
+	}
+	notModified := false
+
+	var (
+		tmpPath  string
+		file     *os.File
+		hasher   hash.Hash
+		expected *checksum
+		modTime  time.Time
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+		if err != nil && tmpPath != "" {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	begin := func(response *http.Response) (io.Writer, error) {
+		if response.StatusCode == http.StatusNotModified {
+			notModified = true
+			return ioutil.Discard, nil
+		}
+
+		var err error
+		if path, err = pathFor(response); err != nil {
+			return nil, err
+		}
+		tmpPath = path + ".tmp"
+
+		expected = o.checksum
+		if expected == nil {
+			expected = headerChecksum(response.Header)
+		}
+
+		algorithm := "sha256"
+		if expected != nil {
+			algorithm = expected.algorithm
+		}
+		if hasher, err = newHash(algorithm); err != nil {
+			return nil, err
+		}
+
+		modTime, _ = http.ParseTime(response.Header.Get("Last-Modified"))
+
+		if file, err = os.Create(tmpPath); err != nil {
+			return nil, err
+		}
+		return io.MultiWriter(file, hasher), nil
+	}
+
+	opts = append(opts[:len(opts):len(opts)], WithContext(ctx), withoutTimeout())
+	if _, written, err = httpDownload("GET", url, "", nil, &download{begin: begin}, headers, nil, nil, 0, opts); err != nil {
+		return path, written, "", err
+	}
+	if notModified {
+		return known, 0, "", ErrNotModified
+	}
+
+	digest = hex.EncodeToString(hasher.Sum(nil))
+	if expected != nil && expected.expected != digest {
+		return path, written, digest, &ChecksumMismatchError{Algorithm: expected.algorithm, Expected: expected.expected, Actual: digest}
+	}
+
+	if err = file.Sync(); err != nil {
+		return path, written, digest, err
+	}
+	err = file.Close()
+	file = nil
+	if err != nil {
+		return path, written, digest, err
+	}
+
+	if !modTime.IsZero() {
+		if err = os.Chtimes(tmpPath, modTime, modTime); err != nil {
+			return path, written, digest, err
+		}
+	}
+	return path, written, digest, os.Rename(tmpPath, path)
+}
+
+// modifiedSince returns the If-Modified-Since of the download to path, empty
+// for an unconditional one.
+func (o *options) modifiedSince(path string) string {
+	if o.lastModified != "" {
+		return o.lastModified
+	}
+	if !o.sinceFile || path == "" {
+		return ""
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.ModTime().After(time.Now()) {
+		return ""
+	}
+	return info.ModTime().UTC().Format(http.TimeFormat)
+}
+
+// headerChecksum returns the checksum a response announces, nil when none.
+func headerChecksum(header http.Header) *checksum {
+	if value := header.Get("Content-MD5"); value != "" {
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+			return &checksum{algorithm: "md5", expected: hex.EncodeToString(sum)}
+		}
+	}
+	if value := header.Get("X-Amz-Checksum-Sha256"); value != "" {
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil {
+			return &checksum{algorithm: "sha256", expected: hex.EncodeToString(sum)}
+		}
+	}
+	if value := header.Get("X-Amz-Meta-Sha256"); value != "" {
+		return &checksum{algorithm: "sha256", expected: strings.ToLower(value)}
+	}
+	return nil
+}
+
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadIfModifiedSince(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var since string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since = r.Header.Get("If-Modified-Since")
+		if r.URL.Path == "/plain" {
+			w.Write([]byte("plain"))
+			return
+		}
+		http.ServeContent(w, r, "data", modified, strings.NewReader("data"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	touch := func(mtime time.Time) {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A file which doesn't exist yet is downloaded with the mtime of
+	// Last-Modified.
+	n, _, err := DownloadToFile(ctx, srv.URL+"/data", path, WithIfModifiedSince())
+	if err != nil || n != 4 {
+		t.Fatal(n, err)
+	}
+	if since != "" {
+		t.Errorf("sent If-Modified-Since %q for a missing file", since)
+	}
+	if info, _ := os.Stat(path); !info.ModTime().Equal(modified) {
+		t.Errorf("mtime %v, want %v", info.ModTime(), modified)
+	}
+
+	// An unchanged file is left alone.
+	if err := ioutil.WriteFile(path, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	touch(modified)
+	_, _, err = DownloadToFile(ctx, srv.URL+"/data", path, WithIfModifiedSince())
+	if !errors.Is(err, ErrNotModified) {
+		t.Fatalf("got %v, want ErrNotModified", err)
+	}
+	if since != modified.Format(http.TimeFormat) {
+		t.Errorf("sent If-Modified-Since %q", since)
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != "keep" {
+		t.Errorf("file became %q", content)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+
+	// An mtime in the future, from a skewed clock, is not trusted.
+	touch(time.Now().Add(time.Hour))
+	if _, _, err = DownloadToFile(ctx, srv.URL+"/data", path, WithIfModifiedSince()); err != nil {
+		t.Fatal(err)
+	}
+	if since != "" {
+		t.Errorf("sent If-Modified-Since %q for a future mtime", since)
+	}
+
+	// An older file is downloaded again.
+	touch(modified.Add(-time.Hour))
+	if n, _, err = DownloadToFile(ctx, srv.URL+"/data", path, WithIfModifiedSince()); err != nil || n != 4 {
+		t.Fatal(n, err)
+	}
+
+	// A stored Last-Modified wins over the mtime of a missing file.
+	_, _, err = DownloadToFile(ctx, srv.URL+"/data", filepath.Join(dir, "other"), WithLastModified(modified.Format(http.TimeFormat)))
+	if !errors.Is(err, ErrNotModified) {
+		t.Errorf("got %v, want ErrNotModified", err)
+	}
+
+	// Servers without validators answer in full every time.
+	plain := filepath.Join(dir, "plain")
+	for i := 0; i < 2; i++ {
+		if n, _, err = DownloadToFile(ctx, srv.URL+"/plain", plain, WithIfModifiedSince()); err != nil || n != 5 {
+			t.Fatal(n, err)
+		}
+	}
+}
+
+func TestDownloadReplacesAtomically(t *testing.T) {
+	data := []byte("new firmware")
+	sum := md5.Sum(data)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dropped":
+			w.Header().Set("Content-Length", "1000")
+			w.Write(data)
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		case "/corrupt":
+			w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(make([]byte, md5.Size)))
+		default:
+			w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "firmware")
+	if err := ioutil.WriteFile(path, []byte("old firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path, want string
+		fails      bool
+	}{
+		{"/dropped", "old firmware", true},
+		{"/corrupt", "old firmware", true},
+		{"/", "new firmware", false},
+	}
+	for _, tt := range tests {
+		_, digest, err := DownloadToFile(context.Background(), srv.URL+tt.path, path)
+		if (err != nil) != tt.fails {
+			t.Errorf("%s: got %v", tt.path, err)
+		}
+		var mismatch *ChecksumMismatchError
+		if tt.path == "/corrupt" && !errors.As(err, &mismatch) {
+			t.Errorf("%s: got %v, want a ChecksumMismatchError", tt.path, err)
+		}
+		if !tt.fails && digest != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: digest %s", tt.path, digest)
+		}
+		if content, _ := ioutil.ReadFile(path); string(content) != tt.want {
+			t.Errorf("%s: file is %q, want %q", tt.path, content, tt.want)
+		}
+		if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("%s: temporary file left: %v", tt.path, err)
+		}
+	}
+}
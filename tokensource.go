@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource provides the access tokens sent with WithTokenSource.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// tokenInvalidator is implemented by sources which can drop a rejected token.
+type tokenInvalidator interface {
+	Invalidate(token string)
+}
+
+// WithTokenSource sends a Bearer token of src with every attempt. When
+// retryUnauthorized is set a 401 reply makes the request go again once with a
+// new token, dropping the rejected one from sources with an Invalidate(token
+// string) method such as ClientCredentials. The token argument of the Auth
+// wrappers, WithBasicAuth and WithBearerToken take precedence.
+func WithTokenSource(src TokenSource, retryUnauthorized bool) Option {
+	return func(o *options) {
+		o.tokenSource = src
+		o.tokenRetry = retryUnauthorized
+	}
+}
+
+// earlyRefresh is how long before its expiry a token is renewed.
+const earlyRefresh = 30 * time.Second
+
+// ClientCredentials is a TokenSource getting tokens from an OAuth2 token
+// endpoint with the client credentials grant. Tokens are cached until
+// shortly before they expire and concurrent callers share a single refresh.
+type ClientCredentials struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	opts         []Option
+	now          func() time.Time
+
+	refresh chan struct{}
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewClientCredentials returns a source authenticating to tokenURL as
+// clientID. The opts apply to the token requests.
+func NewClientCredentials(tokenURL, clientID, clientSecret string, scopes []string, opts ...Option) *ClientCredentials {
+	return &ClientCredentials{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		opts:         opts,
+		now:          time.Now,
+		refresh:      make(chan struct{}, 1),
+	}
+}
+
+// Token returns the cached token, fetching a new one when it is about to
+// expire. A failed fetch returns the ResourceError of the token request with
+// the response body in Body.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	if token, ok := c.cached(); ok {
+		return token, nil
+	}
+
+	select {
+	case c.refresh <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-c.refresh }()
+
+	// another caller may have refreshed while this one waited
+	if token, ok := c.cached(); ok {
+		return token, nil
+	}
+
+	token, expiry, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.token, c.expiry = token, expiry
+	c.mu.Unlock()
+
+	return token, nil
+}
+
+// Invalidate drops token if it is still the cached one, so the next call of
+// Token fetches a new one.
+func (c *ClientCredentials) Invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+func (c *ClientCredentials) cached() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" || !c.expiry.IsZero() && !c.now().Before(c.expiry) {
+		return "", false
+	}
+	return c.token, true
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (token string, expiry time.Time, err error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.scopes) != 0 {
+		form.Set("scope", strings.Join(c.scopes, " "))
+	}
+
+	opts := append([]Option{
+		WithBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret)),
+		WithContext(ctx),
+	}, c.opts...)
+
+	var response tokenResponse
+	started := c.now()
+	_, body, err := HttpReqPostFormJSON(c.tokenURL, []byte(form.Encode()), nil, nil, nil, 0, &response, opts...)
+	if err != nil {
+		var re *ResourceError
+		if errors.As(err, &re) && body != nil {
+			re.Body = string(body)
+		}
+		return "", time.Time{}, err
+	}
+
+	if response.AccessToken == "" {
+		return "", time.Time{}, &ResourceError{URL: c.tokenURL, Err: errors.New("no access_token in token response"), Body: string(body)}
+	}
+
+	if response.ExpiresIn > 0 {
+		lifetime := time.Duration(response.ExpiresIn) * time.Second
+		if lifetime > 2*earlyRefresh {
+			lifetime -= earlyRefresh
+		} else {
+			lifetime /= 2
+		}
+		expiry = started.Add(lifetime)
+	}
+	return response.AccessToken, expiry, nil
+}
+
+// applyTokenSource authorizes the request with a token of the source.
+func (o *options) applyTokenSource(request *http.Request, token string) (err error) {
+	if o.tokenSource == nil || token != "" || o.authorization != "" {
+		return nil
+	}
+
+	if o.sourceToken, err = o.tokenSource.Token(request.Context()); err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", bearer(o.sourceToken))
+	return nil
+}
+
+// retryWithNewToken reports whether a 401 reply should be followed by the same
+// request with a new token, dropping the rejected one.
+func (o *options) retryWithNewToken(status int) bool {
+	if status != http.StatusUnauthorized || !o.tokenRetry || o.tokenRetried || o.sourceToken == "" {
+		return false
+	}
+	if o.stream != nil && !o.stream.replayable {
+		return false
+	}
+
+	if invalidator, ok := o.tokenSource.(tokenInvalidator); ok {
+		invalidator.Invalidate(o.sourceToken)
+	}
+	o.tokenRetried = true
+	return true
+}
@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer issues the tokens t1, t2... valid for expiresIn seconds.
+type tokenServer struct {
+	expiresIn int
+	fail      bool
+
+	mu      sync.Mutex
+	fetches int
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_client"}`))
+		return
+	}
+	user, password, _ := r.BasicAuth()
+	r.ParseForm()
+	if user != "id" || password != "s%26" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "a b" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// slow enough for concurrent callers to overlap
+	time.Sleep(20 * time.Millisecond)
+	s.fetches++
+	fmt.Fprintf(w, `{"access_token":"t%d","token_type":"bearer","expires_in":%d}`, s.fetches, s.expiresIn)
+}
+
+func (s *tokenServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func newTokenSource(expiresIn int) (*tokenServer, *ClientCredentials, func()) {
+	tokens := &tokenServer{expiresIn: expiresIn}
+	srv := httptest.NewServer(tokens)
+	return tokens, NewClientCredentials(srv.URL, "id", "s&", []string{"a", "b"}), srv.Close
+}
+
+func TestClientCredentialsCachesTokens(t *testing.T) {
+	tokens, source, stop := newTokenSource(3600)
+	defer stop()
+
+	now := time.Now()
+	source.now = func() time.Time { return now }
+	token := func() string {
+		got, err := source.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := token(); got != "t1" {
+		t.Fatalf("token %q", got)
+	}
+	if got := token(); got != "t1" || tokens.count() != 1 {
+		t.Errorf("second call got %q after %d fetches, want the cached t1", got, tokens.count())
+	}
+
+	// renewed 30 seconds before it expires
+	now = now.Add(time.Hour - 31*time.Second)
+	if got := token(); got != "t1" {
+		t.Errorf("got %q before the early refresh", got)
+	}
+	now = now.Add(2 * time.Second)
+	if got := token(); got != "t2" {
+		t.Errorf("got %q at the early refresh, want t2", got)
+	}
+}
+
+func TestClientCredentialsRefreshesOnce(t *testing.T) {
+	tokens, source, stop := newTokenSource(3600)
+	defer stop()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+
+	client := NewClient(WithTokenSource(source, false))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := HttpReqJSON("GET", api.URL, nil, nil, nil, nil, 5, nil, WithClient(client)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if tokens.count() != 1 {
+		t.Errorf("%d tokens fetched, want 1", tokens.count())
+	}
+}
+
+func TestTokenSourceRetriesUnauthorizedOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		retry    bool
+		accepted string
+		requests int
+		status   int
+	}{
+		{"rotated token", true, "t2", 2, http.StatusOK},
+		{"no retry", false, "t2", 1, http.StatusUnauthorized},
+		{"rejected again", true, "none", 2, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		_, source, stop := newTokenSource(3600)
+		var seen []string
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = append(seen, r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") != "Bearer "+tt.accepted {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+
+		status, _, _ := HttpReqJSON("GET", api.URL, nil, nil, nil, nil, 5, nil, WithTokenSource(source, tt.retry))
+		api.Close()
+		stop()
+
+		if status != tt.status || len(seen) != tt.requests {
+			t.Errorf("%s: status %d after sending %q, want %d after %d requests", tt.name, status, seen, tt.status, tt.requests)
+		}
+		if tt.requests == 2 && seen[1] != "Bearer t2" {
+			t.Errorf("%s: retried with %q, want a new token", tt.name, seen[1])
+		}
+	}
+}
+
+func TestTokenFetchFailure(t *testing.T) {
+	tokens, source, stop := newTokenSource(3600)
+	defer stop()
+	tokens.fail = true
+
+	_, err := source.Token(context.Background())
+	var re *ResourceError
+	if !errors.As(err, &re) || re.HTTPCode != http.StatusBadRequest || re.Body != `{"error":"invalid_client"}` {
+		t.Errorf("got %v, want the ResourceError of the token endpoint", err)
+	}
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is the duration of each phase of a request. Phases which did not
+// happen, such as DNS and TLS on a reused connection, are zero.
+type Timings struct {
+	DNSLookup       time.Duration
+	Connect         time.Duration
+	TLSHandshake    time.Duration
+	TimeToFirstByte time.Duration
+	ContentTransfer time.Duration
+	Total           time.Duration
+	ConnReused      bool
+	RemoteAddr      string
+}
+
+// WithTimings stores the Timings of the request in t once it is done, those of
+// the last attempt when it was retried. Without it, only the phases are
+// tracked, for the errors of timeouts.
+func WithTimings(t *Timings) Option {
+	return func(o *options) {
+		o.timings = t
+	}
+}
+
+// phaseTracer records when each phase of an attempt starts and ends.
+type phaseTracer struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteHeaders time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	bodyDone     time.Time
+
+	// detailed records the connection, which costs an allocation
+	detailed   bool
+	reused     bool
+	remoteAddr string
+}
+
+func newPhaseTracer(detailed bool) *phaseTracer {
+	return &phaseTracer{start: time.Now(), detailed: detailed}
+}
+
+func (t *phaseTracer) mark(at *time.Time) func() {
+	return func() {
+		t.mu.Lock()
+		*at = time.Now()
+		t.mu.Unlock()
+	}
+}
+
+func (t *phaseTracer) withContext(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart)() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone)() },
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone:       func(string, string, error) { t.mark(&t.connectDone)() },
+		TLSHandshakeStart: t.mark(&t.tlsStart),
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.mark(&t.tlsDone)() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			if t.detailed {
+				t.reused = info.Reused
+				if info.Conn != nil {
+					t.remoteAddr = info.Conn.RemoteAddr().String()
+				}
+			}
+			t.mu.Unlock()
+		},
+		WroteHeaders:         t.mark(&t.wroteHeaders),
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest)() },
+		GotFirstResponseByte: t.mark(&t.firstByte),
+	})
+}
+
+// sent reports whether the request headers were written to a connection.
+func (t *phaseTracer) sent() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return !t.wroteHeaders.IsZero()
+}
+
+// phase names the phase the request was in when it stopped.
+func (t *phaseTracer) phase() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case !t.firstByte.IsZero():
+		return "reading body"
+	case !t.wroteRequest.IsZero():
+		return "waiting for response headers"
+	case !t.gotConn.IsZero():
+		return "writing request"
+	case !t.tlsStart.IsZero() && t.tlsDone.IsZero():
+		return "TLS handshake"
+	case !t.connectStart.IsZero() && t.connectDone.IsZero():
+		return "connect"
+	case !t.dnsStart.IsZero() && t.dnsDone.IsZero():
+		return "DNS lookup"
+	}
+	return "getting connection"
+}
+
+func span(from, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return to.Sub(from)
+}
+
+// timings summarizes the phases, ending open ones now.
+func (t *phaseTracer) timings() *Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	end := t.bodyDone
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	timings := &Timings{
+		DNSLookup:       span(t.dnsStart, t.dnsDone),
+		Connect:         span(t.connectStart, t.connectDone),
+		TLSHandshake:    span(t.tlsStart, t.tlsDone),
+		TimeToFirstByte: span(t.start, t.firstByte),
+		ContentTransfer: span(t.firstByte, end),
+		Total:           end.Sub(t.start),
+		ConnReused:      t.reused,
+		RemoteAddr:      t.remoteAddr,
+	}
+	return timings
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// annotate adds the phase and timings to timeout and cancellation errors.
+func (t *phaseTracer) annotate(re *ResourceError) *ResourceError {
+	if !isTimeout(re.Err) {
+		return re
+	}
+
+	verb := "timed out"
+	if errors.Is(re.Err, context.Canceled) {
+		verb = "canceled"
+	}
+
+	re.Phase = t.phase()
+	re.Timings = t.timings()
+	re.Message = fmt.Sprintf(
+		"%s during %s after %v (dns: %v, connect: %v, tls: %v, first byte: %v)",
+		verb,
+		re.Phase,
+		re.Timings.Total,
+		re.Timings.DNSLookup,
+		re.Timings.Connect,
+		re.Timings.TLSHandshake,
+		re.Timings.TimeToFirstByte,
+	)
+	return re
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	transport := srv.Client().Transport.(*http.Transport)
+
+	var timings Timings
+	if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, transport, 5, nil, WithTimings(&timings)); err != nil {
+		t.Fatal(err)
+	}
+	if timings.Connect <= 0 || timings.TLSHandshake <= 0 || timings.ConnReused || timings.RemoteAddr == "" {
+		t.Errorf("first request: %+v", timings)
+	}
+	if timings.TimeToFirstByte < timings.Connect+timings.TLSHandshake || timings.Total < timings.TimeToFirstByte+timings.ContentTransfer {
+		t.Errorf("phases out of order: %+v", timings)
+	}
+
+	if _, _, err := HttpReqJSON("GET", srv.URL, nil, nil, nil, transport, 5, nil, WithTimings(&timings)); err != nil {
+		t.Fatal(err)
+	}
+	if !timings.ConnReused || timings.Connect != 0 || timings.TLSHandshake != 0 {
+		t.Errorf("second request: %+v", timings)
+	}
+}
+
+func TestTimeoutReportsPhase(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/body" {
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+		}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// accepts connections but never answers the TLS handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				<-release
+				conn.Close()
+			}()
+		}
+	}()
+
+	tests := []struct {
+		url       string
+		phase     string
+		connected bool
+	}{
+		{"https://" + ln.Addr().String(), "TLS handshake", false},
+		{srv.URL + "/headers", "waiting for response headers", true},
+		{srv.URL + "/body", "reading body", true},
+	}
+	// the phase is tracked without any option, the connection with WithTimings
+	for _, timings := range []*Timings{nil, {}} {
+		for _, tt := range tests {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			opts := []Option{WithContext(ctx)}
+			if timings != nil {
+				opts = append(opts, WithTimings(timings))
+			}
+			_, _, err := HttpReqJSON("GET", tt.url, nil, nil, nil, nil, 5, nil, opts...)
+			cancel()
+
+			var re *ResourceError
+			if !errors.As(err, &re) {
+				t.Fatalf("%s: got %v, want a ResourceError", tt.url, err)
+			}
+			if re.Phase != tt.phase || re.Timings == nil || re.Timings.Total < 100*time.Millisecond {
+				t.Errorf("%s: phase %q, timings %+v, want %q", tt.url, re.Phase, re.Timings, tt.phase)
+				continue
+			}
+			if (re.Timings.RemoteAddr != "") != (tt.connected && timings != nil) {
+				t.Errorf("%s: RemoteAddr %q with WithTimings %v", tt.url, re.Timings.RemoteAddr, timings != nil)
+			}
+			if !strings.Contains(re.Message, "timed out during "+tt.phase) {
+				t.Errorf("%s: message %q", tt.url, re.Message)
+			}
+		}
+	}
+}
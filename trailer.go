@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+)
+
+type trailer struct {
+	key   string
+	value func() string
+}
+
+// WithTrailer sends a trailer named key after the request body, valued by what
+// value returns once the body was read to the end, e.g. a hash computed through
+// an io.TeeReader. Requests with trailers are sent chunked. The trailers of the
+// response are in ResponseInfo.Trailer.
+func WithTrailer(key string, value func() string) Option {
+	return func(o *options) {
+		o.trailers = append(o.trailers, trailer{key: http.CanonicalHeaderKey(key), value: value})
+	}
+}
+
+// applyTrailers declares the trailers of the request and fills them in when
+// its body reaches EOF.
+func (o *options) applyTrailers(request *http.Request) {
+	if len(o.trailers) == 0 {
+		return
+	}
+
+	request.Trailer = make(http.Header, len(o.trailers))
+	for _, t := range o.trailers {
+		request.Trailer[t.key] = nil
+	}
+
+	body := request.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	request.Body = &trailerBody{ReadCloser: body, header: request.Trailer, trailers: o.trailers}
+	// trailers only exist with chunked encoding
+	request.ContentLength = -1
+}
+
+type trailerBody struct {
+	io.ReadCloser
+	header   http.Header
+	trailers []trailer
+	done     bool
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF && !b.done {
+		b.done = true
+		for _, t := range b.trailers {
+			b.header.Set(t.key, t.value())
+		}
+	}
+	return n, err
+}
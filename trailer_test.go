@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrailers(t *testing.T) {
+	var clientSum, transferEncoding string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		clientSum = r.Trailer.Get("X-Client-Sum")
+		transferEncoding = strings.Join(r.TransferEncoding, ",")
+
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte(`{"ok":true}`))
+		w.(http.Flusher).Flush()
+		sum := sha256.Sum256(body)
+		w.Header().Set("X-Checksum", hex.EncodeToString(sum[:]))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256([]byte("payload"))
+	want := hex.EncodeToString(sum[:])
+
+	hash := sha256.New()
+	body := io.TeeReader(strings.NewReader("payload"), hash)
+	trailer := WithTrailer("x-client-sum", func() string { return hex.EncodeToString(hash.Sum(nil)) })
+	var info ResponseInfo
+	if _, _, err := HttpReqReaderJSON("POST", srv.URL, "", body, -1, nil, nil, nil, 5, nil, trailer, WithResponseInfo(&info)); err != nil {
+		t.Fatal(err)
+	}
+	if transferEncoding != "chunked" {
+		t.Errorf("sent Transfer-Encoding %q", transferEncoding)
+	}
+	if clientSum != want {
+		t.Errorf("sent trailer %q, want %q", clientSum, want)
+	}
+	if got := info.Trailer.Get("X-Checksum"); got != want {
+		t.Errorf("received trailer %q, want %q", got, want)
+	}
+
+	// Buffered bodies are sent chunked too.
+	trailer = WithTrailer("X-Client-Sum", func() string { return "sum" })
+	if _, _, err := HttpReqJSON("PUT", srv.URL, []byte("payload"), nil, nil, nil, 5, nil, trailer); err != nil {
+		t.Fatal(err)
+	}
+	if transferEncoding != "chunked" || clientSum != "sum" {
+		t.Errorf("sent Transfer-Encoding %q, trailer %q", transferEncoding, clientSum)
+	}
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TransportOption tunes the transport built by NewDefaultTransport.
+type TransportOption func(*transportConfig)
+
+type transportConfig struct {
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	forceHTTP2          bool
+	keepAlive           time.Duration
+	tcpUserTimeout      time.Duration
+}
+
+// defaultTransport serves requests which were not given a transport.
+var defaultTransport = NewDefaultTransport()
+
+// NewDefaultTransport returns a transport tuned for many concurrent requests to
+// few hosts: 100 idle connections per host kept for 90s, 10s dial and TLS
+// handshake timeouts, TCP keep-alive probes every 30s and HTTP/2 attempted.
+func NewDefaultTransport(opts ...TransportOption) *http.Transport {
+	c := transportConfig{
+		maxIdleConns:        512,
+		maxIdleConnsPerHost: 100,
+		idleConnTimeout:     90 * time.Second,
+		dialTimeout:         10 * time.Second,
+		tlsHandshakeTimeout: 10 * time.Second,
+		forceHTTP2:          true,
+		keepAlive:           30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   c.dialTimeout,
+		KeepAlive: c.keepAlive,
+	}
+	if c.tcpUserTimeout > 0 {
+		dialer.Control = tcpUserTimeoutControl(c.tcpUserTimeout)
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          c.maxIdleConns,
+		MaxIdleConnsPerHost:   c.maxIdleConnsPerHost,
+		MaxConnsPerHost:       c.maxConnsPerHost,
+		IdleConnTimeout:       c.idleConnTimeout,
+		TLSHandshakeTimeout:   c.tlsHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     c.forceHTTP2,
+	}
+}
+
+// WithIdleConns sets how many idle connections are kept in total and per host.
+func WithIdleConns(total, perHost int) TransportOption {
+	return func(c *transportConfig) {
+		c.maxIdleConns = total
+		c.maxIdleConnsPerHost = perHost
+	}
+}
+
+// WithMaxConnsPerHost limits the connections to a host, 0 means no limit.
+func WithMaxConnsPerHost(n int) TransportOption {
+	return func(c *transportConfig) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long idle connections are kept.
+func WithIdleConnTimeout(d time.Duration) TransportOption {
+	return func(c *transportConfig) {
+		c.idleConnTimeout = d
+	}
+}
+
+// WithDialTimeout bounds establishing the TCP connection.
+func WithDialTimeout(d time.Duration) TransportOption {
+	return func(c *transportConfig) {
+		c.dialTimeout = d
+	}
+}
+
+// WithKeepAlive sets the interval of TCP keep-alive probes, negative disables them.
+func WithKeepAlive(d time.Duration) TransportOption {
+	return func(c *transportConfig) {
+		c.keepAlive = d
+	}
+}
+
+// WithTCPUserTimeout sets TCP_USER_TIMEOUT on Linux, failing connections whose
+// sent data stays unacknowledged for d, e.g. when a firewall dropped them. It
+// is ignored on other systems.
+func WithTCPUserTimeout(d time.Duration) TransportOption {
+	return func(c *transportConfig) {
+		c.tcpUserTimeout = d
+	}
+}
+
+// WithTLSHandshakeTimeout bounds the TLS handshake.
+func WithTLSHandshakeTimeout(d time.Duration) TransportOption {
+	return func(c *transportConfig) {
+		c.tlsHandshakeTimeout = d
+	}
+}
+
+// WithForceHTTP2 sets whether HTTP/2 is attempted over TLS.
+func WithForceHTTP2(enabled bool) TransportOption {
+	return func(c *transportConfig) {
+		c.forceHTTP2 = enabled
+	}
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+type derivedKey struct {
+	transport *http.Transport
+	variant   string
+}
+
+// derivedTransport returns transport, or the default one when nil, changed as
+// the options which need their own transport say. The changed copies are cached
+// by the Client.
+func (o *options) derivedTransport(transport *http.Transport) *http.Transport {
+	if transport == nil {
+		transport = defaultTransport
+	}
+
+	var variant strings.Builder
+	if o.expectContinue > 0 && transport.ExpectContinueTimeout != o.expectContinue {
+		// net/http ignores Expect without a wait for the interim response
+		fmt.Fprintf(&variant, "expect=%v;", o.expectContinue)
+	}
+	if o.dnsCache != nil {
+		fmt.Fprintf(&variant, "dns=%p;", o.dnsCache)
+	}
+	if o.ipPreference != IPAny {
+		fmt.Fprintf(&variant, "ip=%d;", o.ipPreference)
+	}
+	if len(o.resolveOverrides) != 0 {
+		fmt.Fprintf(&variant, "resolve=%s;", o.resolveKey())
+	}
+	if key := o.phaseTimeoutKey(); key != "" {
+		fmt.Fprintf(&variant, "timeouts=%s;", key)
+	}
+	if key := o.tlsKey(); key != "" {
+		fmt.Fprintf(&variant, "tls=%s;", key)
+	}
+	if key := o.proxyKey(); key != "" {
+		fmt.Fprintf(&variant, "proxy=%s;", key)
+	}
+	if o.unixSocket != "" {
+		fmt.Fprintf(&variant, "unix=%s;", o.unixSocket)
+	}
+	if key := o.protocolKey(); key != "" {
+		fmt.Fprintf(&variant, "protocols=%s;", key)
+	}
+	if variant.Len() == 0 {
+		return transport
+	}
+
+	key := derivedKey{transport: transport, variant: variant.String()}
+	c := o.client
+
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+
+	if clone, ok := c.transports[key]; ok {
+		return clone
+	}
+
+	clone := transport.Clone()
+	if o.expectContinue > 0 {
+		clone.ExpectContinueTimeout = o.expectContinue
+	}
+	if o.phaseTimeouts.TLSHandshake > 0 {
+		clone.TLSHandshakeTimeout = o.phaseTimeouts.TLSHandshake
+	}
+	if o.phaseTimeouts.ResponseHeader > 0 {
+		clone.ResponseHeaderTimeout = o.phaseTimeouts.ResponseHeader
+	}
+	o.tlsVariant(clone)
+	o.proxyVariant(clone)
+	o.protocolVariant(clone)
+
+	dial := dialFunc(clone.DialContext)
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if o.unixSocket != "" {
+		// the socket replaces the host, there is nothing to resolve or proxy
+		dial = unixDial(o.unixSocket)
+		clone.Proxy = nil
+	}
+	if o.phaseTimeouts.Dial > 0 {
+		dial = timeoutDial(o.phaseTimeouts.Dial, dial)
+	}
+	if o.unixSocket == "" && (o.dnsCache != nil || o.ipPreference != IPAny) {
+		var resolver Resolver = net.DefaultResolver
+		if o.dnsCache != nil {
+			resolver = o.dnsCache
+		}
+		dial = resolvingDial(resolver, o.ipPreference, dial)
+	}
+	if len(o.resolveOverrides) != 0 {
+		overrides := make(map[string]string, len(o.resolveOverrides))
+		for from, to := range o.resolveOverrides {
+			overrides[from] = to
+		}
+		dial = overrideDial(overrides, dial)
+	}
+	clone.DialContext = dial
+
+	if len(c.transports) < maxCachedClients {
+		c.transports[key] = clone
+	}
+	return clone
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"context"
+	"net"
+)
+
+// WithUnixSocket connects to the unix domain socket at path instead of the host
+// of the URL, e.g. WithUnixSocket("/var/run/docker.sock") with
+// "http://docker/v1.41/containers/json". The host of the URL is only sent as
+// the Host header, and https URLs do TLS over the socket with it as the server
+// name.
+func WithUnixSocket(path string) Option {
+	return func(o *options) {
+		o.unixSocket = path
+	}
+}
+
+// unixDial dials path whatever address it is asked for.
+func unixDial(path string) dialFunc {
+	var dialer net.Dialer
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", path)
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// unixServer serves the request host and path as JSON on a socket in dir.
+func unixServer(t *testing.T, dir string) (srv *httptest.Server, socket string) {
+	socket = filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"host":"` + r.Host + `","path":"` + r.URL.Path + `"}`))
+	}))
+	srv.Listener = listener
+	return srv, socket
+}
+
+func TestUnixSocket(t *testing.T) {
+	srv, socket := unixServer(t, t.TempDir())
+	srv.Start()
+	defer srv.Close()
+
+	var out struct{ Host, Path string }
+	_, _, err := HttpReqJSON("GET", "http://docker/v1.41/containers/json", nil, nil, nil, nil, 5, &out, WithUnixSocket(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Host != "docker" || out.Path != "/v1.41/containers/json" {
+		t.Errorf("server saw %+v", out)
+	}
+}
+
+func TestUnixSocketTLS(t *testing.T) {
+	srv, socket := unixServer(t, t.TempDir())
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The certificate is checked against the URL host.
+	var out struct{ Host string }
+	transport := srv.Client().Transport.(*http.Transport)
+	_, _, err := HttpReqJSON("GET", "https://example.com/x", nil, nil, nil, transport, 5, &out, WithUnixSocket(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Host != "example.com" {
+		t.Errorf("Host %q, want example.com", out.Host)
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// WithRawQuery sends the query string exactly as given, which presigned URLs
+// (e.g. S3) require. It is the default, and wins over WithEncodeQuery set for
+// a Client.
+func WithRawQuery() Option {
+	return func(o *options) {
+		o.rawQuery = true
+	}
+}
+
+// WithEncodeQuery re-encodes the query string before sending it: parameters
+// are sorted by name and escaped the way url.Values does, malformed ones are
+// dropped.
+func WithEncodeQuery() Option {
+	return func(o *options) {
+		o.encodeQuery = true
+	}
+}
+
+// normalizeURL drops the fragment, which is never sent, and re-encodes the
+// query string with WithEncodeQuery.
+func (o *options) normalizeURL(urlString string) (string, error) {
+	if !o.encodeQuery || o.rawQuery {
+		if i := strings.IndexByte(urlString, '#'); i >= 0 {
+			urlString = urlString[:i]
+		}
+		return urlString, nil
+	}
+
+	if !strings.ContainsAny(urlString, "?#") {
+		return urlString, nil
+	}
+
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return urlString, err
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPresignedURLIsSentUnmodified(t *testing.T) {
+	var rawQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	// out of order, escaped in ways url.Values wouldn't, with a malformed pair
+	query := "X-Amz-Signature=ab%2Fcd&X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=AKID%2f20130524%2Fus-east-1&b=%7E&a=%zz&flag"
+
+	for _, opts := range [][]Option{nil, {WithRawQuery()}, {WithRawQuery(), WithEncodeQuery()}} {
+		if _, _, err := HttpReqJSON("GET", srv.URL+"/object?"+query+"#section", nil, nil, nil, nil, 5, nil, opts...); err != nil {
+			t.Fatal(err)
+		}
+		if rawQuery != query {
+			t.Errorf("sent query %q, want %q", rawQuery, query)
+		}
+	}
+
+	if _, _, err := HttpReqJSON("GET", srv.URL+"/object?b=2&a=1%2f#section", nil, nil, nil, nil, 5, nil, WithEncodeQuery()); err != nil {
+		t.Fatal(err)
+	}
+	if rawQuery != "a=1%2F&b=2" {
+		t.Errorf("WithEncodeQuery sent query %q", rawQuery)
+	}
+}
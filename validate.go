@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var knownMethods = map[string]struct{}{
+	"GET":     {},
+	"HEAD":    {},
+	"POST":    {},
+	"PUT":     {},
+	"DELETE":  {},
+	"CONNECT": {},
+	"OPTIONS": {},
+	"TRACE":   {},
+	"PATCH":   {},
+}
+
+// WithExtraMethods allows methods outside RFC 7231 and PATCH, such as the
+// WebDAV PROPFIND or MKCOL.
+func WithExtraMethods(methods ...string) Option {
+	return func(o *options) {
+		if o.extraMethods == nil {
+			o.extraMethods = make(map[string]struct{}, len(methods))
+		}
+		for _, method := range methods {
+			o.extraMethods[strings.TrimSpace(strings.ToUpper(method))] = struct{}{}
+		}
+	}
+}
+
+// validateRequest checks method and URL before anything is sent.
+func (o *options) validateRequest(method, urlString string) error {
+	if method == "" {
+		return fmt.Errorf("empty method")
+	}
+	if _, ok := knownMethods[method]; !ok {
+		if _, ok = o.extraMethods[method]; !ok {
+			return fmt.Errorf("unsupported method %q, allow it with WithExtraMethods", method)
+		}
+	}
+
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return fmt.Errorf("malformed URL: %v", err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+	case "":
+		return fmt.Errorf("URL %q has no scheme, expected http:// or https://", redactURL(urlString))
+	default:
+		return fmt.Errorf("URL scheme %q is not supported, expected http or https", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return fmt.Errorf("URL %q has no host", redactURL(urlString))
+	}
+	return nil
+}
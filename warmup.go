@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WarmupResult is the outcome of warming up the connection to URL.
+type WarmupResult struct {
+	URL     string
+	Latency time.Duration
+	Err     error
+}
+
+// WithTransport sets the transport of requests which were given none, most
+// useful passed to NewClient.
+func WithTransport(transport *http.Transport) Option {
+	return func(o *options) {
+		o.transport = transport
+	}
+}
+
+// Warmup opens connections to the urls concurrently with HEAD requests, leaving
+// them idle in the pool of the Client transport (see WithTransport) for the
+// requests which follow. Any status counts as success, a failing URL only
+// fails its own result.
+func (c *Client) Warmup(ctx context.Context, urls ...string) []WarmupResult {
+	results := make([]WarmupResult, len(urls))
+	site := callSite()
+
+	var wg sync.WaitGroup
+	for i, urlString := range urls {
+		wg.Add(1)
+		go func(i int, urlString string) {
+			defer wg.Done()
+
+			o := newOptions([]Option{WithClient(c), WithContext(ctx), withCallSite(site)})
+			o.successStatus = func(int) bool { return true }
+			o.truncateBody = pingBodyLimit
+
+			start := time.Now()
+			_, _, err := sendHttpReq(o, "HEAD", urlString, "", nil, nil, nil, nil, 0)
+			results[i] = WarmupResult{URL: urlString, Latency: time.Since(start), Err: err}
+		}(i, urlString)
+	}
+	wg.Wait()
+
+	return results
+}
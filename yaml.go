@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"net/http"
+)
+
+// FormatYAML is registered when the package is built with the yaml tag.
+const FormatYAML Format = "yaml"
+
+// HttpReqYAML sends body as application/yaml and decodes the response as YAML.
+// body may be nil, a []byte sent as is or a value to marshal.
+func HttpReqYAML(method, urlString string, body interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqFormat(FormatYAML, method, urlString, "", body, headers, cookie, transport, timeout, responseStruct, opts)
+}
+
+func HttpReqAuthYAML(method, urlString, token string, body interface{}, headers map[string]string, cookie *http.Cookie, transport *http.Transport, timeout int, responseStruct interface{}, opts ...Option) (httpStatus int, responseBody []byte, err error) {
+	return httpReqFormat(FormatYAML, method, urlString, token, body, headers, cookie, transport, timeout, responseStruct, opts)
+}
@@ -0,0 +1,61 @@
+//go:build yaml
+// +build yaml
+
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Building with the yaml tag registers FormatYAML; the module using this
+// package must require gopkg.in/yaml.v3.
+func init() {
+	RegisterFormat(FormatYAML, Codec{
+		MediaTypes: []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"},
+		Suffix:     "+yaml",
+		Marshal:    yaml.Marshal,
+		Unmarshal:  unmarshalYAML,
+	})
+}
+
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// yamlError carries the line yaml.v3 mentions in its messages.
+type yamlError struct {
+	err  error
+	line int
+}
+
+func (e *yamlError) Error() string {
+	return e.err.Error()
+}
+
+func (e *yamlError) Unwrap() error {
+	return e.err
+}
+
+func (e *yamlError) Position() (line, column int) {
+	return e.line, 0
+}
+
+func unmarshalYAML(data []byte, v interface{}) error {
+	err := yaml.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) != 0 {
+		message = typeErr.Errors[0]
+	}
+	if m := yamlLine.FindStringSubmatch(message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &yamlError{err: err, line: line}
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build zstd
+// +build zstd
+
+package utils
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Building with the zstd tag decodes Content-Encoding: zstd; the module using
+// this package must require github.com/klauspost/compress.
+func init() {
+	RegisterEncoding("zstd", func(r io.Reader) (io.Reader, error) {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{d: d}, nil
+	})
+}
+
+// zstdReader releases the decoder once the body is read to the end or fails.
+type zstdReader struct {
+	d *zstd.Decoder
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	n, err := r.d.Read(p)
+	if err != nil {
+		r.d.Close()
+	}
+	return n, err
+}